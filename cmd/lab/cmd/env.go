@@ -1,13 +1,19 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"sync"
 	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/teekennedy/homelab/cmd/lab/config"
 	"github.com/teekennedy/homelab/cmd/lab/env"
+	"github.com/teekennedy/homelab/cmd/lab/kubeconfig"
 )
 
 var (
@@ -36,6 +42,11 @@ func newEnvCmd() *cobra.Command {
 	cmd.AddCommand(newEnvDeleteCmd())
 	cmd.AddCommand(newEnvStatusCmd())
 	cmd.AddCommand(newEnvKubeconfigCmd())
+	cmd.AddCommand(newEnvExecCmd())
+	cmd.AddCommand(newEnvWaitCmd())
+	cmd.AddCommand(newEnvSnapshotCmd())
+	cmd.AddCommand(newEnvRestoreCmd())
+	cmd.AddCommand(newEnvHistoryCmd())
 
 	return cmd
 }
@@ -265,6 +276,26 @@ func newEnvStatusCmd() *cobra.Command {
 			if e.Config.Workers > 0 {
 				fmt.Printf("Workers:    %d\n", e.Config.Workers)
 			}
+			if e.RestoredFrom != "" {
+				fmt.Printf("Restored:   %s\n", e.RestoredFrom)
+			}
+			if len(e.Snapshots) > 0 {
+				fmt.Println("Snapshots:")
+				for _, snap := range e.Snapshots {
+					fmt.Printf("  - %s (%s, %d resources)\n", snap.Tag, snap.CreatedAt.Format("2006-01-02 15:04:05"), snap.Resources)
+				}
+			}
+			for _, t := range []env.WaitTarget{env.WaitNodes, env.WaitPods, env.WaitApps} {
+				r, ok := e.Readiness[t]
+				if !ok {
+					continue
+				}
+				state := "not ready"
+				if r.Ready {
+					state = "ready"
+				}
+				fmt.Printf("Ready/%-5s %s (%s, checked %s)\n", t+":", state, r.Message, r.CheckedAt.Format("2006-01-02 15:04:05"))
+			}
 
 			return nil
 		},
@@ -292,3 +323,292 @@ func newEnvKubeconfigCmd() *cobra.Command {
 		},
 	}
 }
+
+func newEnvExecCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "exec <name> -- <command> [args...]",
+		Short: "Run a command against an environment",
+		Long: `Run a command with KUBECONFIG pointing at the environment's kubeconfig.
+
+LAB_ENV and LAB_DOMAIN are set from the CUE environment the environment was
+created from (or the environment itself, for production). The command's exit
+code is passed through.
+
+Examples:
+  lab env exec staging -- kubectl get pods -A
+  lab env exec production -- k9s`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if cmd.ArgsLenAtDash() != 1 || len(args) < 2 {
+				return fmt.Errorf("usage: lab env exec <name> -- <command> [args...]")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			cmd.SilenceUsage = true
+
+			kc, sourceEnv, err := envKubeconfig(cmd.Context(), name)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = kc.Close() }()
+
+			cfg, err := config.LoadEnvironment(getConfigDir(), sourceEnv)
+			if err != nil {
+				return fmt.Errorf("load environment: %w", err)
+			}
+
+			child := kc.Command(cmd.Context(), args[1], args[2:]...)
+			child.Env = append(child.Env,
+				"LAB_ENV="+cfg.Name,
+				"LAB_DOMAIN="+cfg.Cluster.Domain,
+			)
+			child.Stdin = os.Stdin
+			child.Stdout = os.Stdout
+			child.Stderr = os.Stderr
+
+			if err := child.Run(); err != nil {
+				var exitErr *exec.ExitError
+				if errors.As(err, &exitErr) {
+					cmd.SilenceErrors = true
+					return &ExitError{Code: exitErr.ExitCode()}
+				}
+				return fmt.Errorf("run %s: %w", args[1], err)
+			}
+			return nil
+		},
+	}
+}
+
+// envKubeconfig returns a kubeconfig handle for environment name along with
+// the CUE environment it was created from. Kind environments use the
+// kubeconfig in their state dir; production decrypts its kubeconfig, which
+// closing the handle removes again.
+func envKubeconfig(ctx context.Context, name string) (*kubeconfig.Handle, string, error) {
+	if name == "production" {
+		kc, err := setupKubeconfig(ctx, name)
+		if err != nil {
+			return nil, "", err
+		}
+		return kc, name, nil
+	}
+
+	mgr := getEnvManager()
+	e, err := mgr.Get(ctx, name)
+	if err != nil {
+		return nil, "", fmt.Errorf("get environment: %w", err)
+	}
+	path, err := mgr.GetKubeconfig(name)
+	if err != nil {
+		return nil, "", fmt.Errorf("get kubeconfig: %w", err)
+	}
+
+	sourceEnv := e.FromEnv
+	if sourceEnv == "" {
+		sourceEnv = "production"
+	}
+	return kubeconfig.NewHandle(name, path), sourceEnv, nil
+}
+
+func newEnvWaitCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "wait <name>",
+		Short: "Wait for an environment to become ready",
+		Long: `Block until an environment's cluster is ready for use.
+
+Targets:
+  nodes  every node reports Ready
+  pods   every kube-system deployment is available (CoreDNS etc.)
+  apps   every ArgoCD Application is Healthy
+
+The last observed status of each target is saved in the environment state.
+
+Examples:
+  lab env wait staging                          # Wait for nodes and pods
+  lab env wait pr-123 --for nodes,pods,apps --timeout 15m`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr := getEnvManager()
+			name := args[0]
+			forTargets, _ := cmd.Flags().GetStringSlice("for")
+			timeout, _ := cmd.Flags().GetDuration("timeout")
+			interval, _ := cmd.Flags().GetDuration("interval")
+			if interval <= 0 {
+				return fmt.Errorf("--interval must be positive, got %s", interval)
+			}
+			cmd.SilenceUsage = true
+
+			targets := make([]env.WaitTarget, 0, len(forTargets))
+			for _, f := range forTargets {
+				t, err := env.ParseWaitTarget(f)
+				if err != nil {
+					return err
+				}
+				targets = append(targets, t)
+			}
+
+			if !jsonOutput {
+				fmt.Printf("Waiting for environment %q (%v, timeout %s)...\n", name, forTargets, timeout)
+			}
+
+			waitErr := mgr.Wait(cmd.Context(), name, targets, timeout, interval)
+
+			if jsonOutput {
+				e, err := mgr.Get(cmd.Context(), name)
+				if err != nil {
+					return fmt.Errorf("get environment: %w", err)
+				}
+				if err := printJSON(e.Readiness); err != nil {
+					return err
+				}
+			}
+			if waitErr != nil {
+				return fmt.Errorf("wait for environment: %w", waitErr)
+			}
+
+			if !jsonOutput {
+				fmt.Printf("Environment %q is ready.\n", name)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSlice("for", []string{"nodes", "pods"}, "Readiness targets to wait for (nodes, pods, apps)")
+	cmd.Flags().Duration("timeout", 5*time.Minute, "Maximum time to wait")
+	cmd.Flags().Duration("interval", 5*time.Second, "Polling interval")
+
+	return cmd
+}
+
+func newEnvSnapshotCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "snapshot <name> <tag>",
+		Short: "Snapshot an environment",
+		Long: `Save the resources and PVC data of a running Kind environment.
+
+Namespaces, CRDs, bound PersistentVolumes and all namespaced resources not owned
+by a controller are exported, and local-path PVC data is archived from every
+node. Snapshots are listed in 'lab env status' and restored with 'lab env restore'.
+Deleting the environment deletes its snapshots.
+
+Examples:
+  lab env snapshot staging tuned`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr := getEnvManager()
+			name, tag := args[0], args[1]
+			cmd.SilenceUsage = true
+
+			if !jsonOutput {
+				fmt.Printf("Snapshotting environment %q as %q...\n", name, tag)
+			}
+
+			snap, err := mgr.Snapshot(cmd.Context(), name, tag)
+			if err != nil {
+				return fmt.Errorf("snapshot environment: %w", err)
+			}
+
+			if jsonOutput {
+				return printJSON(snap)
+			}
+			fmt.Printf("Snapshot %q saved (%d resources, PVC data from %d nodes).\n", tag, snap.Resources, len(snap.Nodes))
+			return nil
+		},
+	}
+}
+
+func newEnvRestoreCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "restore <name> <tag> <new-name>",
+		Short: "Restore a snapshot into a new environment",
+		Long: `Create a new Kind environment from a snapshot of another environment.
+
+The new cluster gets the same number of workers, PVC data is copied back onto
+the matching nodes, and the saved resources are applied.
+
+Examples:
+  lab env restore staging tuned pr-123`,
+		Args: cobra.ExactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr := getEnvManager()
+			name, tag, newName := args[0], args[1], args[2]
+			cmd.SilenceUsage = true
+
+			if !jsonOutput {
+				fmt.Printf("Restoring snapshot %q of %q as environment %q...\n", tag, name, newName)
+			}
+
+			e, err := mgr.Restore(cmd.Context(), name, tag, newName)
+			if err != nil {
+				return fmt.Errorf("restore environment: %w", err)
+			}
+
+			if jsonOutput {
+				return printJSON(e)
+			}
+			fmt.Printf("Environment %q restored successfully.\n", newName)
+			fmt.Println("\nTo use this environment:")
+			fmt.Printf("  export KUBECONFIG=%s\n", e.Config.Kubeconfig)
+			return nil
+		},
+	}
+}
+
+func newEnvHistoryCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history <name>",
+		Short: "Show environment activity history",
+		Long: `Show the lifecycle events recorded for an environment.
+
+Every create, start, stop, delete, snapshot and restore, as well as
+'lab k8s bootstrap' and 'lab k8s sync' runs against the environment, is logged
+with its time, user, host and result. The log survives deleting the environment.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr := getEnvManager()
+			name := args[0]
+			limit, _ := cmd.Flags().GetInt("limit")
+			cmd.SilenceUsage = true
+
+			events, err := mgr.History(name)
+			if err != nil {
+				return fmt.Errorf("read history: %w", err)
+			}
+			if limit > 0 && len(events) > limit {
+				events = events[len(events)-limit:]
+			}
+
+			if jsonOutput {
+				return printJSON(events)
+			}
+
+			if len(events) == 0 {
+				fmt.Printf("No history recorded for environment %q\n", name)
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			if _, err := fmt.Fprintln(w, "TIME\tACTION\tUSER\tHOST\tRESULT\tDETAIL"); err != nil {
+				return fmt.Errorf("writing header: %w", err)
+			}
+			for _, e := range events {
+				detail := e.Detail
+				if e.Error != "" {
+					detail = e.Error
+				}
+				if _, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+					e.Time.Format("2006-01-02 15:04:05"), e.Action, e.User, e.Host, e.Result, detail); err != nil {
+					return fmt.Errorf("writing row: %w", err)
+				}
+			}
+			if err := w.Flush(); err != nil {
+				return fmt.Errorf("flushing output: %w", err)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().IntP("limit", "n", 0, "Show only the most recent N events")
+
+	return cmd
+}
@@ -5,22 +5,29 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"slices"
+	"reflect"
 	"strings"
 	"sync"
+	"text/tabwriter"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/cobra"
 	"github.com/teekennedy/homelab/cmd/lab/config"
+	labenv "github.com/teekennedy/homelab/cmd/lab/env"
+	"github.com/teekennedy/homelab/cmd/lab/internal/argocd"
 	"github.com/teekennedy/homelab/cmd/lab/internal/helm"
+	"github.com/teekennedy/homelab/cmd/lab/internal/kube"
 	"github.com/teekennedy/homelab/cmd/lab/internal/paths"
 	"github.com/teekennedy/homelab/cmd/lab/kubeconfig"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
 var (
@@ -32,24 +39,57 @@ func getKubeconfigManager() *kubeconfig.Manager {
 	kubeconfigMgrOnce.Do(func() {
 		kubeconfigMgr = kubeconfig.NewManager(
 			kubeconfig.WithConfigDir(paths.ProjectConfigDir()),
+			kubeconfig.WithCacheTTL(kubeconfigCacheTTL()),
 		)
 	})
 	return kubeconfigMgr
 }
 
-func setupKubeconfig(ctx context.Context, envName string) (func(), error) {
+// kubeconfigCacheTTL returns how long decrypted kubeconfigs may stay cached,
+// from LAB_KUBECONFIG_TTL (a Go duration, 0 to disable) or the default
+func kubeconfigCacheTTL() time.Duration {
+	value := os.Getenv("LAB_KUBECONFIG_TTL")
+	if value == "" {
+		return kubeconfig.DefaultCacheTTL
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: invalid LAB_KUBECONFIG_TTL %q, using %s: %v\n", value, kubeconfig.DefaultCacheTTL, err)
+		return kubeconfig.DefaultCacheTTL
+	}
+	return ttl
+}
+
+// expireKubeconfigCache removes decrypted kubeconfigs older than the cache TTL.
+// It runs before every command so forgotten copies, and those of killed
+// processes, don't outlive the TTL.
+func expireKubeconfigCache() {
+	removed, err := getKubeconfigManager().ExpireCache()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not expire cached kubeconfigs: %v\n", err)
+	}
+	if verbose {
+		for _, path := range removed {
+			fmt.Fprintf(os.Stderr, "Removed expired kubeconfig %s\n", path)
+		}
+	}
+}
+
+// setupKubeconfig decrypts the kubeconfig for envName and returns a handle for
+// running commands against it. Close the handle to remove the decrypted file.
+func setupKubeconfig(ctx context.Context, envName string) (*kubeconfig.Handle, error) {
 	mgr := getKubeconfigManager()
 
 	if !mgr.Exists(envName) {
 		return nil, fmt.Errorf("no kubeconfig found for environment %q (expected at %s)", envName, mgr.GetEncryptedPath(envName))
 	}
 
-	cleanup, err := mgr.Setup(ctx, envName)
+	kc, err := mgr.Setup(ctx, envName)
 	if err != nil {
 		return nil, fmt.Errorf("setup kubeconfig: %w", err)
 	}
 
-	return cleanup, nil
+	return kc, nil
 }
 
 func newK8sCmd() *cobra.Command {
@@ -67,6 +107,14 @@ and are automatically decrypted using sops when needed.`,
 	cmd.AddCommand(newK8sBootstrapCmd())
 	cmd.AddCommand(newK8sDiffCmd())
 	cmd.AddCommand(newK8sSyncCmd())
+	cmd.AddCommand(newK8sRenderCmd())
+	cmd.AddCommand(newK8sHistoryCmd())
+	cmd.AddCommand(newK8sRollbackCmd())
+	cmd.AddCommand(newK8sDevCmd())
+	cmd.AddCommand(newK8sImagesCmd())
+	cmd.AddCommand(newK8sCapacityCmd())
+	cmd.AddCommand(newK8sDriftCmd())
+	cmd.AddCommand(newK8sNewCmd())
 	cmd.AddCommand(newK8sListCmd())
 	cmd.AddCommand(newK8sStatusCmd())
 	cmd.AddCommand(newK8sGenerateCmd())
@@ -75,215 +123,116 @@ and are automatically decrypted using sops when needed.`,
 	return cmd
 }
 
-func newK8sBootstrapCmd() *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "bootstrap",
-		Short: "Bootstrap Kubernetes cluster",
-		Long: `Bootstrap the Kubernetes cluster with foundation components.
-
-This command installs the foundation tier applications in the correct order:
-1. secret-system (SOPS secrets operator)
-2. cert-system (cert-manager)
-3. metallb (load balancer)
-4. argocd (GitOps controller)
-5. Remaining foundation apps
-
-After bootstrap, ArgoCD will manage all applications.`,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			envName, _ := cmd.Flags().GetString("env")
-			dryRun, _ := cmd.Flags().GetBool("dry-run")
-			skipArgo, _ := cmd.Flags().GetBool("skip-argocd")
-
-			configDir := getConfigDir()
-			env, err := config.LoadEnvironment(configDir, envName)
-			if err != nil {
-				return fmt.Errorf("load environment: %w", err)
-			}
-
-			cleanup, err := setupKubeconfig(cmd.Context(), envName)
-			if err != nil {
-				return err
-			}
-			defer cleanup()
-
-			if !jsonOutput {
-				fmt.Printf("Bootstrapping Kubernetes cluster for %s environment\n", envName)
-				if dryRun {
-					fmt.Println("(dry-run mode)")
-				}
-			}
-
-			if err := installFoundationApps(cmd.Context(), env, bootstrapOrder(skipArgo), dryRun); err != nil {
-				return err
-			}
-
-			if !skipArgo && !dryRun {
-				applyArgoAppOfApps(cmd.Context())
-			}
-
-			if !jsonOutput && !dryRun {
-				printBootstrapComplete()
-			}
-
-			return nil
-		},
-	}
-
-	cmd.Flags().Bool("dry-run", false, "Show what would be installed without making changes")
-	cmd.Flags().Bool("skip-argocd", false, "Skip ArgoCD installation (for debugging)")
-
-	return cmd
-}
-
-// installFoundationApp installs a single foundation-tier app at appPath, either via
-// `kubectl apply -k` (if it has no Chart.yaml) or via Helm (building dependencies first
-// if needed).
-// bootstrapOrder returns the foundation apps in the order they must be installed,
-// omitting argocd if skipArgo is set.
-func bootstrapOrder(skipArgo bool) []string {
-	order := []string{"secret-system", "cert-system", "metallb"}
-	if !skipArgo {
-		order = append(order, "argocd")
-	}
-	return order
-}
-
-// installFoundationApps installs each app in order that is both enabled in env's
-// foundation tier and present on disk under k8s/foundation/.
-func installFoundationApps(ctx context.Context, env *config.Environment, order []string, dryRun bool) error {
-	for _, app := range order {
-		if !slices.Contains(env.Apps.Foundation, app) {
-			continue
-		}
-
-		appPath := filepath.Join("k8s/foundation", app)
-		if _, err := os.Stat(appPath); os.IsNotExist(err) {
-			continue
-		}
-
-		if !jsonOutput {
-			fmt.Printf("\nInstalling %s...\n", app)
-		}
-
-		if err := installFoundationApp(ctx, app, appPath, dryRun); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func installFoundationApp(ctx context.Context, app, appPath string, dryRun bool) error {
-	chartPath := filepath.Join(appPath, "Chart.yaml")
-	if _, err := os.Stat(chartPath); os.IsNotExist(err) {
-		if err := applyKustomization(ctx, appPath, dryRun); err != nil {
-			return fmt.Errorf("install %s: %w", app, err)
-		}
-		return nil
-	}
-
-	needs, err := helm.NeedsDependencyBuild(appPath)
-	if err != nil {
-		return fmt.Errorf("check deps for %s: %w", app, err)
-	}
-	if needs {
-		depCmd := exec.CommandContext(ctx, "helm", "dependency", "build", appPath)
-		depCmd.Stdout = os.Stdout
-		depCmd.Stderr = os.Stderr
-		if err := depCmd.Run(); err != nil {
-			return fmt.Errorf("build deps for %s: %w", app, err)
-		}
-	}
-
-	helmArgs := []string{
-		"upgrade", "--install", app, appPath,
-		"--namespace", app,
-		"--create-namespace",
-	}
-	if dryRun {
-		helmArgs = append(helmArgs, "--dry-run")
-	}
-
-	clusterValues := filepath.Join(getConfigDir(), "gen", "cluster-values.yaml")
-	if _, err := os.Stat(clusterValues); err == nil {
-		helmArgs = append(helmArgs, "--values", clusterValues)
-	}
-
-	helmCmd := exec.CommandContext(ctx, "helm", helmArgs...)
-	helmCmd.Stdout = os.Stdout
-	helmCmd.Stderr = os.Stderr
-	if err := helmCmd.Run(); err != nil {
-		return fmt.Errorf("install %s: %w", app, err)
-	}
-	return nil
-}
-
-// applyArgoAppOfApps applies the foundation tier's ArgoCD app-of-apps manifest.
-// Failures are logged as warnings rather than returned, since ArgoCD itself isn't
-// required for the rest of bootstrap to have succeeded.
-func applyArgoAppOfApps(ctx context.Context) {
-	if !jsonOutput {
-		fmt.Println("\nApplying ArgoCD app-of-apps...")
-	}
-
-	kubectlCmd := exec.CommandContext(ctx, "kubectl", "apply", "-f", "k8s/foundation/application.yaml")
-	kubectlCmd.Stdout = os.Stdout
-	kubectlCmd.Stderr = os.Stderr
-	if err := kubectlCmd.Run(); err != nil {
-		fmt.Printf("Warning: failed to apply foundation app-of-apps: %v\n", err)
-	}
-}
-
-// printBootstrapComplete prints the post-bootstrap success message and next steps.
-func printBootstrapComplete() {
-	fmt.Println("\nBootstrap complete!")
-	fmt.Println("ArgoCD will now manage the remaining applications.")
-	fmt.Println("\nTo access ArgoCD UI:")
-	fmt.Println("  kubectl port-forward svc/argocd-server -n argocd 8080:443")
-	fmt.Println("  open https://localhost:8080")
-}
-
 func newK8sDiffCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "diff [app]",
 		Short: "Show pending Kubernetes changes",
 		Long: `Show what would change for Kubernetes resources.
 
-Uses helm template piped through kubectl diff for semantic comparison.
+Only apps enabled for --env in the CUE config are diffed. Charts under k8s/
+that the config doesn't declare, and enabled apps with no chart directory, are
+reported as warnings.
+
+Renders each chart with helm template and runs a server-side apply dry run for
+every resource, so defaulting, admission webhooks and field ownership are taken
+into account. Each resource is reported as added, changed, unchanged or pruned
+(live resources with the app's ArgoCD tracking label that are no longer
+rendered). Secret values are masked: like kubectl diff, the diff only shows
+which keys were added, removed or changed. With --json the per-resource
+results are printed instead of diffs.
+
+With --against <ref>, no cluster is contacted. Charts changed since ref,
+including untracked ones and those using a changed library chart from
+k8s/charts (all charts if the CUE config changed), are rendered both in the
+working tree and at ref, checked out into a temporary git worktree, and
+compared resource by resource. Helm's chart and version labels and checksum/
+annotations are ignored, so only resources whose content changed are reported.
+Apps enabled at ref but not in the working tree are reported as removed.
+
+Up to --concurrency apps are diffed at once. Each app's output is printed as a
+block once it finishes, followed by a summary table when more than one app was
+diffed. Like kubectl diff, the exit code is 0 when nothing would change, 1 when
+something would, and 2 if any app couldn't be diffed.
 
 Examples:
   lab k8s diff                    # Diff all tiers
   lab k8s diff foundation         # Diff entire foundation tier
   lab k8s diff platform/forgejo   # Diff specific app
   lab k8s diff forgejo            # Diff app (auto-detect tier)
+  lab k8s diff --concurrency 8    # Diff 8 apps at a time
+  lab k8s diff --against main     # Diff against main without a cluster
   lab k8s diff --watch            # Watch for changes and re-diff
   lab k8s diff forgejo --watch    # Watch specific app`,
 		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
 			envName, _ := cmd.Flags().GetString("env")
 			watch, _ := cmd.Flags().GetBool("watch")
 			debounce, _ := cmd.Flags().GetDuration("debounce")
-
-			cleanup, err := setupKubeconfig(cmd.Context(), envName)
-			if err != nil {
-				return err
-			}
-			defer cleanup()
+			concurrency, _ := cmd.Flags().GetInt("concurrency")
+			against, _ := cmd.Flags().GetString("against")
 
 			target := ""
 			if len(args) > 0 {
 				target = args[0]
 			}
 
-			if !watch {
-				return runDiff(cmd.Context(), target)
+			env, err := config.LoadEnvironment(getConfigDir(), envName)
+			if err != nil {
+				return fmt.Errorf("load environment: %w", err)
+			}
+
+			var diffs []appDiff
+			if against != "" {
+				if watch {
+					return errors.New("--watch cannot be combined with --against")
+				}
+				diffs, err = runCompare(cmd.Context(), env, against, target, concurrency)
+				if err != nil {
+					return err
+				}
+			} else {
+				kc, err := setupKubeconfig(cmd.Context(), envName)
+				if err != nil {
+					return err
+				}
+				defer func() { _ = kc.Close() }()
+
+				differ, err := newDiffer(kc)
+				if err != nil {
+					return err
+				}
+
+				if watch {
+					return watchAndDiff(cmd.Context(), differ, env, target, concurrency, debounce)
+				}
+
+				diffs, err = runDiff(cmd.Context(), differ, env, target, concurrency)
+				if err != nil {
+					return err
+				}
+			}
+
+			if jsonOutput {
+				if err := printJSON(diffs); err != nil {
+					return err
+				}
+			} else if len(diffs) > 1 {
+				printAppSummary(diffSummary(diffs))
 			}
 
-			return watchAndDiff(cmd.Context(), target, debounce)
+			if code := diffExitCode(diffs); code != 0 {
+				cmd.SilenceErrors = true
+				return &ExitError{Code: code}
+			}
+			return nil
 		},
 	}
 
 	cmd.Flags().Bool("watch", false, "Watch for file changes and re-diff automatically")
 	cmd.Flags().Duration("debounce", 50*time.Millisecond, "Debounce duration for watch mode")
+	cmd.Flags().Int("concurrency", defaultK8sConcurrency, "Number of apps to diff in parallel")
+	cmd.Flags().String("against", "", "Diff rendered manifests against a git ref instead of the cluster")
 
 	return cmd
 }
@@ -294,48 +243,91 @@ func newK8sSyncCmd() *cobra.Command {
 		Short: "Sync Kubernetes resources",
 		Long: `Force sync Kubernetes resources via Helm or ArgoCD.
 
+When syncing a tier, only apps enabled for --env in the CUE config are synced,
+and up to --concurrency apps are synced at once via Helm. Each
+app's output is printed as a block once it finishes, followed by a summary
+table. The command fails if any app failed to sync.
+
+With --argocd, the app (or the tier's app-of-apps) is synced through the ArgoCD
+API, reached via the cluster's API server, and the command waits up to
+--timeout for it to become synced and healthy, listing unhealthy resources if it
+doesn't. The API token is taken from ARGOCD_AUTH_TOKEN, or obtained by logging
+in with the password in the argocd-initial-admin-secret Secret. Automated sync
+suspended by 'lab k8s rollback --suspend-auto-sync' is switched back on.
+
 Examples:
   lab k8s sync foundation         # Sync entire foundation tier
+  lab k8s sync apps --concurrency 8
   lab k8s sync platform/forgejo   # Sync specific app
   lab k8s sync forgejo --argocd   # Sync via ArgoCD`,
 		Args: cobra.MaximumNArgs(1),
-		RunE: func(cmd *cobra.Command, args []string) error {
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			cmd.SilenceUsage = true
 			envName, _ := cmd.Flags().GetString("env")
 
-			cleanup, err := setupKubeconfig(cmd.Context(), envName)
-			if err != nil {
-				return err
-			}
-			defer cleanup()
-
 			target := ""
 			if len(args) > 0 {
 				target = args[0]
 			}
+			defer func() { getEnvManager().Record(envName, labenv.ActionSync, target, err) }()
+
+			kc, err := setupKubeconfig(cmd.Context(), envName)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = kc.Close() }()
 
 			useArgo, _ := cmd.Flags().GetBool("argocd")
 			prune, _ := cmd.Flags().GetBool("prune")
+			concurrency, _ := cmd.Flags().GetInt("concurrency")
 
 			tier, app := parseK8sTarget(target)
 
 			if useArgo {
-				return syncViaArgoCD(cmd.Context(), tier, app, prune)
+				timeout, _ := cmd.Flags().GetDuration("timeout")
+				return syncViaArgoCD(cmd.Context(), kc, tier, app, prune, timeout)
 			}
 
 			if tier == "" && app == "" {
 				return fmt.Errorf("please specify a tier or app to sync")
 			}
 
-			if app == "" {
-				return syncTier(cmd.Context(), tier)
+			env, err := config.LoadEnvironment(getConfigDir(), envName)
+			if err != nil {
+				return fmt.Errorf("load environment: %w", err)
 			}
 
-			return syncApp(cmd.Context(), tier, app)
+			if app != "" {
+				if err := checkAppEnabled(env, tier, app); err != nil {
+					return err
+				}
+				return syncApp(cmd.Context(), kc, os.Stdout, tier, app)
+			}
+
+			charts, err := chartsForTarget(env, tier)
+			if err != nil {
+				return err
+			}
+			syncs := syncTier(cmd.Context(), kc, charts, concurrency)
+			if jsonOutput {
+				if err := printJSON(syncs); err != nil {
+					return err
+				}
+			} else {
+				printAppSummary(syncSummary(syncs))
+			}
+
+			if failed := failedSyncs(syncs); failed > 0 {
+				return fmt.Errorf("%d of %d apps failed to sync", failed, len(syncs))
+			}
+			return nil
 		},
 	}
 
 	cmd.Flags().Bool("argocd", false, "Use ArgoCD for sync instead of Helmfile")
 	cmd.Flags().Bool("prune", false, "Prune resources not in the current configuration")
+	cmd.Flags().Duration("timeout", 5*time.Minute, "How long to wait for an ArgoCD sync to become healthy")
+	cmd.Flags().Int("concurrency", defaultK8sConcurrency, "Number of apps to sync in parallel")
 
 	return cmd
 }
@@ -346,6 +338,10 @@ func newK8sListCmd() *cobra.Command {
 		Short: "List Kubernetes applications",
 		Long: `List applications configured for Kubernetes deployment.
 
+Shows the apps the CUE config enables for --env, marking any without a chart
+directory under k8s/. Charts under k8s/ that the CUE config doesn't declare
+are listed separately.
+
 Examples:
   lab k8s list              # List all apps by tier
   lab k8s list foundation   # List foundation apps
@@ -382,10 +378,12 @@ Examples:
 func printK8sListJSON(env *config.Environment, envName, tier string, hasKubeconfig bool) error {
 	var output any
 	if tier == "" {
+		_, mismatches := enabledCharts(env, config.Tiers...)
 		output = map[string]any{
 			"environment":   envName,
 			"hasKubeconfig": hasKubeconfig,
 			"apps":          env.Apps,
+			"mismatches":    mismatches,
 		}
 	} else {
 		switch tier {
@@ -434,53 +432,182 @@ func printK8sListText(env *config.Environment, envName, tier string, hasKubeconf
 	printTier("foundation", env.Apps.Foundation)
 	printTier("platform", env.Apps.Platform)
 	printTier("apps", env.Apps.Apps)
+
+	tiers := config.Tiers
+	if tier != "" {
+		tiers = []string{tier}
+	}
+	_, mismatches := enabledCharts(env, tiers...)
+	var undeclared []appMismatch
+	for _, m := range mismatches {
+		if m.Problem == mismatchNotInConfig {
+			undeclared = append(undeclared, m)
+		}
+	}
+	if len(undeclared) > 0 {
+		fmt.Println("\nNot in CUE config:")
+		for _, m := range undeclared {
+			fmt.Printf("  ? %s/%s\n", m.Tier, m.App)
+		}
+	}
 }
 
 func newK8sStatusCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "status",
 		Short: "Show cluster status",
-		Long:  `Show the status of the Kubernetes cluster and deployed applications.`,
+		Long: `Show the status of the Kubernetes cluster and deployed applications.
+
+Lists nodes with their readiness, roles and kubelet version, and ArgoCD
+Applications with their sync and health state, plus a summary of both. With
+--json the same information is printed as a single JSON object whose
+"summary" counts are suitable for dashboard widgets.
+
+With --watch the status is re-read every --interval and printed again
+whenever it changes; --json --watch prints one compact JSON object per line.
+
+Examples:
+  lab k8s status
+  lab k8s status --json | jq .summary
+  lab k8s status --watch --interval 5s`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			envName, _ := cmd.Flags().GetString("env")
+			watch, _ := cmd.Flags().GetBool("watch")
+			interval, _ := cmd.Flags().GetDuration("interval")
+			if watch && interval <= 0 {
+				return fmt.Errorf("--interval must be positive, got %s", interval)
+			}
+			cmd.SilenceUsage = true
 
-			cleanup, err := setupKubeconfig(cmd.Context(), envName)
+			kc, err := setupKubeconfig(cmd.Context(), envName)
 			if err != nil {
 				return err
 			}
-			defer cleanup()
+			defer func() { _ = kc.Close() }()
 
-			if !jsonOutput {
-				fmt.Printf("Cluster Status (%s environment):\n", envName)
+			restConfig, err := restConfigFor(kc)
+			if err != nil {
+				return err
 			}
-
-			if !jsonOutput {
-				fmt.Println("\nNodes:")
+			reader, err := kube.NewStatusReader(restConfig)
+			if err != nil {
+				return fmt.Errorf("create status reader: %w", err)
 			}
-			kubectlCmd := exec.CommandContext(cmd.Context(), "kubectl", "get", "nodes", "-o", "wide")
-			kubectlCmd.Stdout = os.Stdout
-			kubectlCmd.Stderr = os.Stderr
-			if err := kubectlCmd.Run(); err != nil {
-				return fmt.Errorf("get nodes: %w", err)
+
+			if watch {
+				return watchK8sStatus(cmd.Context(), reader, envName, interval)
 			}
 
-			if !jsonOutput {
-				fmt.Println("\nArgoCD Applications:")
+			status, err := reader.Status(cmd.Context())
+			if err != nil {
+				return fmt.Errorf("read cluster status: %w", err)
 			}
-			argoCmd := exec.CommandContext(cmd.Context(), "argocd", "app", "list", "--grpc-web")
-			argoCmd.Stdout = os.Stdout
-			argoCmd.Stderr = os.Stderr
-			if err := argoCmd.Run(); err != nil {
-				kubectlCmd := exec.CommandContext(cmd.Context(), "kubectl", "get", "applications", "-n", "argocd",
-					"-o", "custom-columns=NAME:.metadata.name,SYNC:.status.sync.status,HEALTH:.status.health.status")
-				kubectlCmd.Stdout = os.Stdout
-				kubectlCmd.Stderr = os.Stderr
-				_ = kubectlCmd.Run()
+			out := k8sStatusOutput{Environment: envName, CheckedAt: time.Now().UTC(), ClusterStatus: status}
+			if jsonOutput {
+				return printJSON(out)
 			}
-
+			printK8sStatus(out)
 			return nil
 		},
 	}
+
+	cmd.Flags().Bool("watch", false, "Keep polling and print the status whenever it changes")
+	cmd.Flags().Duration("interval", 10*time.Second, "Polling interval for --watch")
+
+	return cmd
+}
+
+// k8sStatusOutput is the JSON document printed by `lab k8s status`
+type k8sStatusOutput struct {
+	Environment string    `json:"environment"`
+	CheckedAt   time.Time `json:"checked_at"`
+	*kube.ClusterStatus
+}
+
+// watchK8sStatus polls the cluster status every interval until ctx is done,
+// printing it whenever it differs from the last one printed
+func watchK8sStatus(ctx context.Context, reader *kube.StatusReader, envName string, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last *kube.ClusterStatus
+	for {
+		status, err := reader.Status(ctx)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			fmt.Fprintf(os.Stderr, "Error: read cluster status: %v\n", err)
+		case err == nil && !reflect.DeepEqual(status, last):
+			last = status
+			out := k8sStatusOutput{Environment: envName, CheckedAt: time.Now().UTC(), ClusterStatus: status}
+			if jsonOutput {
+				data, err := json.Marshal(out)
+				if err != nil {
+					return fmt.Errorf("marshal status: %w", err)
+				}
+				fmt.Println(string(data))
+			} else {
+				fmt.Printf("\n--- %s ---\n", out.CheckedAt.Local().Format(time.DateTime))
+				printK8sStatus(out)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// formatAge formats d like kubectl's AGE column: days, hours or minutes
+func formatAge(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+}
+
+// printK8sStatus prints nodes, Applications and a summary as tables
+func printK8sStatus(out k8sStatusOutput) {
+	fmt.Printf("Cluster Status (%s environment):\n", out.Environment)
+
+	fmt.Println("\nNodes:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "NAME\tSTATUS\tROLES\tVERSION\tINTERNAL-IP\tAGE")
+	for _, n := range out.Nodes {
+		status := "NotReady"
+		if n.Ready {
+			status = "Ready"
+		}
+		roles := strings.Join(n.Roles, ",")
+		if roles == "" {
+			roles = "<none>"
+		}
+		age := formatAge(out.CheckedAt.Sub(n.Created))
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", n.Name, status, roles, n.Version, n.InternalIP, age)
+	}
+	_ = w.Flush()
+
+	fmt.Println("\nArgoCD Applications:")
+	if out.ApplicationsError != "" {
+		fmt.Printf("  (%s)\n", out.ApplicationsError)
+	} else {
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "NAME\tSYNC\tHEALTH\tMESSAGE")
+		for _, a := range out.Applications {
+			msg, _, _ := strings.Cut(a.Message, "\n")
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", a.Name, a.Sync, a.Health, msg)
+		}
+		_ = w.Flush()
+	}
+
+	sum := out.Summary
+	fmt.Printf("\n%d/%d nodes ready, %d/%d apps synced, %d/%d apps healthy\n",
+		sum.NodesReady, sum.Nodes, sum.AppsSynced, sum.Applications, sum.AppsHealthy, sum.Applications)
 }
 
 func newK8sGenerateCmd() *cobra.Command {
@@ -552,121 +679,6 @@ This exports the environment configuration to formats usable by Helm charts.`,
 	return cmd
 }
 
-func newK8sKubeconfigCmd() *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "kubeconfig",
-		Short: "Manage kubeconfig files",
-		Long:  `Commands for managing kubeconfig files for different environments.`,
-	}
-
-	cmd.AddCommand(newK8sKubeconfigDecryptCmd())
-	cmd.AddCommand(newK8sKubeconfigCleanupCmd())
-	cmd.AddCommand(newK8sKubeconfigListCmd())
-
-	return cmd
-}
-
-func newK8sKubeconfigDecryptCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "decrypt [environment]",
-		Short: "Decrypt kubeconfig for an environment",
-		Long: `Decrypt the kubeconfig for the specified environment and make it available.
-
-The decrypted kubeconfig is stored in .lab/kubeconfig/<env>.yaml`,
-		Args: cobra.MaximumNArgs(1),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			envName := "production"
-			if len(args) > 0 {
-				envName = args[0]
-			}
-
-			mgr := getKubeconfigManager()
-
-			if err := mgr.SetupPersistent(cmd.Context(), envName); err != nil {
-				return fmt.Errorf("setting up persistent kubeconfig: %w", err)
-			}
-
-			decPath := mgr.GetDecryptedPath(envName)
-			if !jsonOutput {
-				fmt.Printf("Kubeconfig decrypted for %s environment\n", envName)
-				fmt.Printf("Path: %s\n", decPath)
-				fmt.Printf("\nTo use:\n")
-				fmt.Printf("  export KUBECONFIG=%s\n", decPath)
-			} else {
-				result := map[string]string{
-					"environment": envName,
-					"path":        decPath,
-				}
-				out, _ := json.Marshal(result)
-				fmt.Println(string(out))
-			}
-
-			return nil
-		},
-	}
-}
-
-func newK8sKubeconfigCleanupCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "cleanup",
-		Short: "Remove decrypted kubeconfig files",
-		Long:  `Remove all decrypted kubeconfig files from the cache directory.`,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			mgr := getKubeconfigManager()
-
-			if err := mgr.CleanupAll(); err != nil {
-				return fmt.Errorf("cleanup: %w", err)
-			}
-
-			if !jsonOutput {
-				fmt.Println("Decrypted kubeconfig files cleaned up")
-			}
-
-			return nil
-		},
-	}
-}
-
-func newK8sKubeconfigListCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "list",
-		Short: "List available kubeconfig files",
-		Long:  `List all environments that have kubeconfig files available.`,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			mgr := getKubeconfigManager()
-
-			envs, err := mgr.ListEnvironments()
-			if err != nil {
-				return fmt.Errorf("list environments: %w", err)
-			}
-
-			if jsonOutput {
-				out, _ := json.Marshal(envs)
-				fmt.Println(string(out))
-				return nil
-			}
-
-			if len(envs) == 0 {
-				fmt.Println("No kubeconfig files found")
-				fmt.Printf("Expected location: %s\n", filepath.Join(getConfigDir(), "kubeconfig", "<env>.enc.yaml"))
-				return nil
-			}
-
-			fmt.Println("Available kubeconfigs:")
-			for _, env := range envs {
-				decPath := mgr.GetDecryptedPath(env)
-				status := "encrypted"
-				if _, err := os.Stat(decPath); err == nil {
-					status = "decrypted"
-				}
-				fmt.Printf("  - %s (%s)\n", env, status)
-			}
-
-			return nil
-		},
-	}
-}
-
 func parseK8sTarget(target string) (tier, app string) {
 	if target == "" {
 		return "", ""
@@ -691,85 +703,194 @@ func parseK8sTarget(target string) (tier, app string) {
 	return "", parts[0]
 }
 
-func runDiff(ctx context.Context, target string) error {
-	tier, app := parseK8sTarget(target)
+// appDiff is the dry-run diff result for one app
+type appDiff struct {
+	Tier      string              `json:"tier"`
+	App       string              `json:"app"`
+	Resources []kube.ResourceDiff `json:"resources"`
+	Error     string              `json:"error,omitempty"`
+}
 
-	if tier == "" && app == "" {
-		for _, t := range []string{"foundation", "platform", "apps"} {
-			if !jsonOutput {
-				fmt.Printf("\n=== %s ===\n", strings.ToUpper(t))
-			}
-			if err := diffTier(ctx, t); err != nil {
-				fmt.Printf("Warning: %v\n", err)
-			}
+// changedCount returns how many resources would be added, changed, pruned or
+// removed
+func (d appDiff) changedCount() int {
+	n := 0
+	for _, r := range d.Resources {
+		if r.Change != kube.ChangeUnchanged {
+			n++
 		}
-		return nil
 	}
+	return n
+}
 
-	if app == "" {
-		return diffTier(ctx, tier)
+// restConfigFor returns a client-go config for the cluster behind kc
+func restConfigFor(kc *kubeconfig.Handle) (*rest.Config, error) {
+	restConfig, err := clientcmd.BuildConfigFromFlags("", kc.Path)
+	if err != nil {
+		return nil, fmt.Errorf("load kubeconfig: %w", err)
 	}
+	return restConfig, nil
+}
 
-	return diffApp(ctx, tier, app)
+// newDiffer returns a dry-run diff engine for the cluster behind kc
+func newDiffer(kc *kubeconfig.Handle) (*kube.Differ, error) {
+	restConfig, err := restConfigFor(kc)
+	if err != nil {
+		return nil, err
+	}
+	differ, err := kube.NewDiffer(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("create diff engine: %w", err)
+	}
+	return differ, nil
 }
 
-func diffTier(ctx context.Context, tier string) error {
-	tierPath := filepath.Join("k8s", tier)
-	charts, err := helm.DiscoverCharts(tierPath)
+// runDiff diffs every app env enables in target (all tiers, one tier or a
+// single app) with up to concurrency apps in flight. Per-app failures are
+// recorded in the results rather than returned.
+func runDiff(ctx context.Context, differ *kube.Differ, env *config.Environment, target string, concurrency int) ([]appDiff, error) {
+	charts, err := chartsForTarget(env, target)
 	if err != nil {
-		return fmt.Errorf("discovering charts: %w", err)
+		return nil, err
 	}
 
-	for _, chart := range charts {
-		if err := diffApp(ctx, chart.Tier, chart.Name); err != nil {
-			fmt.Printf("Warning: %s/%s: %v\n", chart.Tier, chart.Name, err)
+	return runAppsParallel(ctx, appOutput(), charts, concurrency, func(ctx context.Context, w io.Writer, chart helm.ChartInfo) appDiff {
+		d, err := diffApp(ctx, w, differ, chart.Tier, chart.Name)
+		if err != nil {
+			if !jsonOutput {
+				_, _ = fmt.Fprintf(w, "Error: %v\n", err)
+			}
+			d.Error = err.Error()
 		}
-	}
-	return nil
+		return d
+	}), nil
 }
 
-func diffApp(ctx context.Context, tier, app string) error {
+// diffApp renders an app's chart and dry-run applies it against the cluster,
+// writing progress and the diff to w. Live resources carrying the app's ArgoCD
+// tracking label that are no longer rendered are reported as pruned.
+func diffApp(ctx context.Context, w io.Writer, differ *kube.Differ, tier, app string) (appDiff, error) {
 	chartDir := filepath.Join("k8s", tier, app)
+	result := appDiff{Tier: tier, App: app}
+
+	if !jsonOutput {
+		_, _ = fmt.Fprintf(w, "\n--- %s/%s ---\n", tier, app)
+	}
 
 	info, err := helm.ParseChartInfo(chartDir)
 	if err != nil {
-		return fmt.Errorf("parse chart info: %w", err)
+		return result, fmt.Errorf("parse chart info: %w", err)
 	}
 
-	if err := buildChartDependenciesIfNeeded(ctx, tier, app, chartDir); err != nil {
-		return err
+	if err := buildChartDependenciesIfNeeded(ctx, w, tier, app, chartDir); err != nil {
+		return result, err
+	}
+
+	manifests, err := renderChart(ctx, w, info)
+	if err != nil {
+		return result, err
+	}
+
+	objs, err := kube.ParseManifests(manifests)
+	if err != nil {
+		return result, fmt.Errorf("parse rendered manifests: %w", err)
+	}
+
+	result.Resources, err = differ.Diff(ctx, objs, kube.DiffOptions{
+		Namespace:     info.Namespace,
+		PruneSelector: "app.kubernetes.io/instance=" + info.Name,
+	})
+	if err != nil {
+		return result, fmt.Errorf("diff %s/%s: %w", tier, app, err)
 	}
 
 	if !jsonOutput {
-		fmt.Printf("\n--- %s/%s ---\n", tier, app)
+		printAppDiff(w, result)
 	}
+	return result, nil
+}
 
+// renderChart runs `helm template` for a chart with the generated cluster
+// values. Helm's warnings are written to stderr.
+func renderChart(ctx context.Context, stderr io.Writer, info helm.ChartInfo) ([]byte, error) {
+	clusterValues := filepath.Join(getConfigDir(), "gen", "cluster-values.yaml")
+	if _, statErr := os.Stat(clusterValues); statErr != nil {
+		clusterValues = ""
+	}
+	return helmTemplate(ctx, stderr, info, clusterValues)
+}
+
+// helmTemplate renders a chart with helm template, layering valuesFile (if
+// set) over the chart's own values. Extra arguments are passed to helm as-is.
+func helmTemplate(ctx context.Context, stderr io.Writer, info helm.ChartInfo, valuesFile string, extraArgs ...string) ([]byte, error) {
 	templateArgs := []string{
-		"template", info.ReleaseName, chartDir,
+		"template", info.ReleaseName, info.Path,
 		"--namespace", info.Namespace,
 	}
-
-	clusterValues := filepath.Join(getConfigDir(), "gen", "cluster-values.yaml")
-	if _, statErr := os.Stat(clusterValues); statErr == nil {
-		templateArgs = append(templateArgs, "--values", clusterValues)
+	if valuesFile != "" {
+		templateArgs = append(templateArgs, "--values", valuesFile)
 	}
+	templateArgs = append(templateArgs, extraArgs...)
 
 	helmCmd := exec.CommandContext(ctx, "helm", templateArgs...)
-	kubectlCmd := exec.CommandContext(ctx, "kubectl", "diff", "-f", "-")
-
-	changed, err := runHelmDiffPipe(helmCmd, kubectlCmd)
+	helmCmd.Stderr = stderr
+	out, err := helmCmd.Output()
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("helm template: %w", err)
 	}
+	return out, nil
+}
 
-	if !jsonOutput && !changed {
-		fmt.Println("  (no changes)")
+// printAppDiff writes the resources an app's sync would touch to w, with a
+// unified diff for each changed resource
+func printAppDiff(w io.Writer, d appDiff) {
+	if d.changedCount() == 0 {
+		_, _ = fmt.Fprintln(w, "  (no changes)")
+		if !verbose {
+			return
+		}
 	}
-	return nil
+
+	for _, r := range d.Resources {
+		switch r.Change {
+		case kube.ChangeAdded:
+			_, _ = fmt.Fprintf(w, "  + %s (added)\n", r)
+		case kube.ChangeChanged:
+			_, _ = fmt.Fprintf(w, "  ~ %s (changed)\n", r)
+			_, _ = fmt.Fprint(w, indentLines(r.Diff, "    "))
+		case kube.ChangePruned:
+			_, _ = fmt.Fprintf(w, "  - %s (would be pruned)\n", r)
+		case kube.ChangeRemoved:
+			_, _ = fmt.Fprintf(w, "  - %s (removed)\n", r)
+		case kube.ChangeUnchanged:
+			if verbose {
+				_, _ = fmt.Fprintf(w, "    %s (unchanged)\n", r)
+			}
+		}
+		if r.Message != "" {
+			_, _ = fmt.Fprintf(w, "      note: %s\n", r.Message)
+		}
+	}
+}
+
+// indentLines prefixes every line of s with indent
+func indentLines(s, indent string) string {
+	if s == "" {
+		return ""
+	}
+	lines := strings.SplitAfter(s, "\n")
+	var b strings.Builder
+	for _, line := range lines {
+		if line != "" {
+			b.WriteString(indent + line)
+		}
+	}
+	return b.String()
 }
 
-// buildChartDependenciesIfNeeded runs `helm dependency build` for chartDir if needed.
-func buildChartDependenciesIfNeeded(ctx context.Context, tier, app, chartDir string) error {
+// buildChartDependenciesIfNeeded runs `helm dependency build` for chartDir if
+// needed, writing its output to w.
+func buildChartDependenciesIfNeeded(ctx context.Context, w io.Writer, tier, app, chartDir string) error {
 	needs, err := helm.NeedsDependencyBuild(chartDir)
 	if err != nil {
 		return fmt.Errorf("checking dependency build: %w", err)
@@ -779,55 +900,18 @@ func buildChartDependenciesIfNeeded(ctx context.Context, tier, app, chartDir str
 	}
 
 	if !jsonOutput {
-		fmt.Printf("Building dependencies for %s/%s...\n", tier, app)
+		_, _ = fmt.Fprintf(w, "Building dependencies for %s/%s...\n", tier, app)
 	}
 	depCmd := exec.CommandContext(ctx, "helm", "dependency", "build", chartDir)
-	depCmd.Stdout = os.Stdout
-	depCmd.Stderr = os.Stderr
+	depCmd.Stdout = w
+	depCmd.Stderr = w
 	if err := depCmd.Run(); err != nil {
 		return fmt.Errorf("helm dependency build: %w", err)
 	}
 	return nil
 }
 
-// runHelmDiffPipe runs helmCmd piped into kubectlCmd (a `kubectl diff -f -`), returning
-// whether kubectl reported any changes. A kubectl exit code of 1 (changes found) is not
-// treated as an error.
-func runHelmDiffPipe(helmCmd, kubectlCmd *exec.Cmd) (changed bool, err error) {
-	pipe, err := helmCmd.StdoutPipe()
-	if err != nil {
-		return false, fmt.Errorf("create pipe: %w", err)
-	}
-	kubectlCmd.Stdin = pipe
-	kubectlCmd.Stdout = os.Stdout
-	kubectlCmd.Stderr = os.Stderr
-
-	if err := kubectlCmd.Start(); err != nil {
-		helmCmd.Stdout = os.Stdout
-		helmCmd.Stderr = os.Stderr
-		if err := helmCmd.Run(); err != nil {
-			return false, fmt.Errorf("helm template: %w", err)
-		}
-		return false, nil
-	}
-
-	if err := helmCmd.Run(); err != nil {
-		_ = kubectlCmd.Wait()
-		return false, fmt.Errorf("helm template: %w", err)
-	}
-
-	if err := kubectlCmd.Wait(); err != nil {
-		var exitErr *exec.ExitError
-		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
-			return true, nil
-		}
-		return false, fmt.Errorf("kubectl diff: %w", err)
-	}
-
-	return false, nil
-}
-
-func watchAndDiff(ctx context.Context, target string, debounce time.Duration) error {
+func watchAndDiff(ctx context.Context, differ *kube.Differ, env *config.Environment, target string, concurrency int, debounce time.Duration) error {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return fmt.Errorf("create watcher: %w", err)
@@ -839,11 +923,13 @@ func watchAndDiff(ctx context.Context, target string, debounce time.Duration) er
 	}
 
 	fmt.Println("Watching for changes... (Ctrl+C to stop)")
-	if err := runDiff(ctx, target); err != nil {
-		fmt.Printf("Error: %v\n", err)
+	diffs, err := runDiff(ctx, differ, env, target, concurrency)
+	if err != nil {
+		return err
 	}
+	printWatchedDiffs(diffs)
 
-	runWatchLoop(ctx, watcher, target, debounce)
+	runWatchLoop(ctx, differ, watcher, env, target, concurrency, debounce)
 	return nil
 }
 
@@ -901,14 +987,16 @@ func isRelevantWatchEvent(event fsnotify.Event) bool {
 }
 
 // handleWatchedChange re-diffs the app (or target) affected by a debounced file change.
-func handleWatchedChange(ctx context.Context, changedFile, target string) {
+func handleWatchedChange(ctx context.Context, differ *kube.Differ, env *config.Environment, changedFile, target string, concurrency int) {
 	fmt.Printf("\n--- File changed: %s ---\n", changedFile)
 
 	chartDir := findChartDir(changedFile)
 	if chartDir == "" {
-		if err := runDiff(ctx, target); err != nil {
+		diffs, err := runDiff(ctx, differ, env, target, concurrency)
+		if err != nil {
 			fmt.Printf("Error: %v\n", err)
 		}
+		printWatchedDiffs(diffs)
 		return
 	}
 
@@ -918,15 +1006,34 @@ func handleWatchedChange(ctx context.Context, changedFile, target string) {
 		return
 	}
 
-	if err := diffApp(ctx, info.Tier, info.Name); err != nil {
+	if err := checkAppEnabled(env, info.Tier, info.Name); err != nil {
+		fmt.Printf("Skipping: %v\n", err)
+		return
+	}
+
+	d, err := diffApp(ctx, appOutput(), differ, info.Tier, info.Name)
+	if err != nil {
 		fmt.Printf("Error: %v\n", err)
+	} else {
+		printWatchedDiffs([]appDiff{d})
 	}
 	fmt.Println("\nWatching for changes... (Ctrl+C to stop)")
 }
 
+// printWatchedDiffs prints diff results as JSON in watch mode; text output is
+// printed as each app is diffed
+func printWatchedDiffs(diffs []appDiff) {
+	if !jsonOutput || len(diffs) == 0 {
+		return
+	}
+	if err := printJSON(diffs); err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+}
+
 // runWatchLoop processes fsnotify events for watcher until its channels close,
 // debouncing relevant changes into calls to handleWatchedChange.
-func runWatchLoop(ctx context.Context, watcher *fsnotify.Watcher, target string, debounce time.Duration) {
+func runWatchLoop(ctx context.Context, differ *kube.Differ, watcher *fsnotify.Watcher, env *config.Environment, target string, concurrency int, debounce time.Duration) {
 	var timer *time.Timer
 
 	for {
@@ -942,7 +1049,7 @@ func runWatchLoop(ctx context.Context, watcher *fsnotify.Watcher, target string,
 				timer.Stop()
 			}
 			changedFile := event.Name
-			timer = time.AfterFunc(debounce, func() { handleWatchedChange(ctx, changedFile, target) })
+			timer = time.AfterFunc(debounce, func() { handleWatchedChange(ctx, differ, env, changedFile, target, concurrency) })
 
 		case err, ok := <-watcher.Errors:
 			if !ok {
@@ -964,22 +1071,34 @@ func findChartDir(filePath string) string {
 	return ""
 }
 
-func syncTier(ctx context.Context, tier string) error {
-	tierPath := filepath.Join("k8s", tier)
-	charts, err := helm.DiscoverCharts(tierPath)
-	if err != nil {
-		return fmt.Errorf("discovering charts: %w", err)
-	}
-
-	for _, chart := range charts {
-		if err := syncApp(ctx, chart.Tier, chart.Name); err != nil {
-			fmt.Printf("Warning: %s/%s: %v\n", chart.Tier, chart.Name, err)
+// syncTier syncs charts via Helm with up to concurrency apps in flight.
+// Per-app failures are recorded in the results rather than returned.
+func syncTier(ctx context.Context, kc *kubeconfig.Handle, charts []helm.ChartInfo, concurrency int) []appSync {
+	return runAppsParallel(ctx, appOutput(), charts, concurrency, func(ctx context.Context, w io.Writer, chart helm.ChartInfo) appSync {
+		result := appSync{Tier: chart.Tier, App: chart.Name}
+		if err := syncApp(ctx, kc, w, chart.Tier, chart.Name); err != nil {
+			if !jsonOutput {
+				_, _ = fmt.Fprintf(w, "Error: %s/%s: %v\n", chart.Tier, chart.Name, err)
+			}
+			result.Error = err.Error()
 		}
+		return result
+	})
+}
+
+// syncApp runs `helm upgrade --install` for an app with the cluster values
+// `lab k8s generate` last wrote, writing its output to w
+func syncApp(ctx context.Context, kc *kubeconfig.Handle, w io.Writer, tier, app string) error {
+	clusterValues := filepath.Join(getConfigDir(), "gen", "cluster-values.yaml")
+	if _, err := os.Stat(clusterValues); err != nil {
+		clusterValues = ""
 	}
-	return nil
+	return syncAppWithValues(ctx, kc, w, tier, app, clusterValues)
 }
 
-func syncApp(ctx context.Context, tier, app string) error {
+// syncAppWithValues runs `helm upgrade --install` for an app with the cluster
+// values in valuesFile, if set, writing its output to w
+func syncAppWithValues(ctx context.Context, kc *kubeconfig.Handle, w io.Writer, tier, app, valuesFile string) error {
 	chartDir := filepath.Join("k8s", tier, app)
 
 	info, err := helm.ParseChartInfo(chartDir)
@@ -987,12 +1106,12 @@ func syncApp(ctx context.Context, tier, app string) error {
 		return fmt.Errorf("parse chart info: %w", err)
 	}
 
-	if err := buildChartDependenciesIfNeeded(ctx, tier, app, chartDir); err != nil {
+	if err := buildChartDependenciesIfNeeded(ctx, w, tier, app, chartDir); err != nil {
 		return err
 	}
 
 	if !jsonOutput {
-		fmt.Printf("Syncing %s/%s via Helm...\n", tier, app)
+		_, _ = fmt.Fprintf(w, "Syncing %s/%s via Helm...\n", tier, app)
 	}
 
 	upgradeArgs := []string{
@@ -1001,21 +1120,24 @@ func syncApp(ctx context.Context, tier, app string) error {
 		"--create-namespace",
 	}
 
-	clusterValues := filepath.Join(getConfigDir(), "gen", "cluster-values.yaml")
-	if _, err := os.Stat(clusterValues); err == nil {
-		upgradeArgs = append(upgradeArgs, "--values", clusterValues)
+	if valuesFile != "" {
+		upgradeArgs = append(upgradeArgs, "--values", valuesFile)
 	}
 
-	helmCmd := exec.CommandContext(ctx, "helm", upgradeArgs...)
-	helmCmd.Stdout = os.Stdout
-	helmCmd.Stderr = os.Stderr
+	helmCmd := kc.Command(ctx, "helm", upgradeArgs...)
+	helmCmd.Stdout = w
+	helmCmd.Stderr = w
 	if err := helmCmd.Run(); err != nil {
 		return fmt.Errorf("helm upgrade: %w", err)
 	}
 	return nil
 }
 
-func syncViaArgoCD(ctx context.Context, tier, app string, prune bool) error {
+// syncViaArgoCD syncs an ArgoCD Application (an app, or a tier's
+// app-of-apps) and waits up to timeout for it to become synced and healthy.
+// If it doesn't, the resources that aren't healthy are listed. Automated sync
+// suspended by `lab k8s rollback` is switched back on first.
+func syncViaArgoCD(ctx context.Context, kc *kubeconfig.Handle, tier, app string, prune bool, timeout time.Duration) error {
 	var appName string
 	switch {
 	case app != "":
@@ -1026,38 +1148,93 @@ func syncViaArgoCD(ctx context.Context, tier, app string, prune bool) error {
 		return fmt.Errorf("please specify an app or tier to sync")
 	}
 
+	client, err := newArgoClient(ctx, kc)
+	if err != nil {
+		return err
+	}
+
+	restConfig, err := restConfigFor(kc)
+	if err != nil {
+		return err
+	}
+	autoSync, err := kube.NewAutoSync(restConfig)
+	if err != nil {
+		return fmt.Errorf("create ArgoCD client: %w", err)
+	}
+	resumed, err := autoSync.Resume(ctx, appName)
+	if err != nil {
+		return fmt.Errorf("resume ArgoCD auto-sync: %w", err)
+	}
+	if resumed && !jsonOutput {
+		fmt.Printf("Resumed ArgoCD auto-sync for %s\n", appName)
+	}
+
 	if !jsonOutput {
 		fmt.Printf("Syncing %s via ArgoCD...\n", appName)
 	}
-
-	args := []string{"app", "sync", appName, "--grpc-web"}
-	if prune {
-		args = append(args, "--prune")
+	if err := client.Sync(ctx, appName, argocd.SyncOptions{Prune: prune}); err != nil {
+		return fmt.Errorf("argocd sync: %w", err)
 	}
 
-	argoCmd := exec.CommandContext(ctx, "argocd", args...)
-	argoCmd.Stdout = os.Stdout
-	argoCmd.Stderr = os.Stderr
-	if err := argoCmd.Run(); err != nil {
+	state, err := client.WaitHealthy(ctx, appName, timeout)
+	if jsonOutput && state != nil {
+		if printErr := printJSON(state); printErr != nil {
+			return printErr
+		}
+	}
+	if err != nil {
+		if !jsonOutput {
+			printUnhealthyResources(ctx, client, appName)
+		}
 		return fmt.Errorf("argocd sync: %w", err)
 	}
+
+	if !jsonOutput {
+		fmt.Printf("%s is %s and %s at %s\n", appName, state.Sync, state.Health, state.Revision)
+	}
 	return nil
 }
 
-func applyKustomization(ctx context.Context, path string, dryRun bool) error {
-	kustomizePath := filepath.Join(path, "kustomization.yaml")
-	if _, err := os.Stat(kustomizePath); err == nil {
-		args := []string{"apply", "-k", path}
-		if dryRun {
-			args = append(args, "--dry-run=client")
+// newArgoClient returns an ArgoCD API client for the cluster behind kc,
+// authenticated with ARGOCD_AUTH_TOKEN if it's set and the initial admin
+// password otherwise
+func newArgoClient(ctx context.Context, kc *kubeconfig.Handle) (*argocd.Client, error) {
+	restConfig, err := restConfigFor(kc)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []argocd.ClientOption
+	for _, kv := range kc.Env {
+		if token, ok := strings.CutPrefix(kv, argocd.TokenEnvVar+"="); ok && token != "" {
+			opts = append(opts, argocd.WithToken(token))
 		}
-		kubectlCmd := exec.CommandContext(ctx, "kubectl", args...)
-		kubectlCmd.Stdout = os.Stdout
-		kubectlCmd.Stderr = os.Stderr
-		if err := kubectlCmd.Run(); err != nil {
-			return fmt.Errorf("kubectl apply: %w", err)
+	}
+
+	client, err := argocd.NewClientForCluster(ctx, restConfig, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("connect to argocd: %w", err)
+	}
+	return client, nil
+}
+
+// printUnhealthyResources lists the resources of an Application that ArgoCD
+// doesn't consider healthy, to show why a sync didn't settle
+func printUnhealthyResources(ctx context.Context, client *argocd.Client, appName string) {
+	nodes, err := client.ResourceTree(ctx, appName)
+	if err != nil {
+		fmt.Printf("Warning: could not read resource tree: %v\n", err)
+		return
+	}
+
+	for _, n := range nodes {
+		if n.Health == "" || n.Health == "Healthy" {
+			continue
+		}
+		if n.HealthMessage != "" {
+			fmt.Printf("  %s: %s (%s)\n", n, n.Health, n.HealthMessage)
+		} else {
+			fmt.Printf("  %s: %s\n", n, n.Health)
 		}
-		return nil
 	}
-	return nil
 }
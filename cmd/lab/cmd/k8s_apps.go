@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/teekennedy/homelab/cmd/lab/config"
+	"github.com/teekennedy/homelab/cmd/lab/internal/helm"
+)
+
+// Problems reported by enabledCharts when k8s/ and the CUE config disagree
+const (
+	mismatchNotInConfig = "chart is not declared in the CUE config"
+	mismatchNoChart     = "app is enabled but has no directory under k8s/"
+)
+
+// appMismatch is an app that exists on disk or in the CUE config but not both
+type appMismatch struct {
+	Tier    string `json:"tier"`
+	App     string `json:"app"`
+	Problem string `json:"problem"`
+}
+
+// enabledCharts returns the charts under k8s/<tier> for each tier that env
+// enables, in tier order. Charts the CUE config doesn't declare at all and
+// enabled apps without a directory are returned as mismatches; charts that are
+// declared but disabled for env are skipped silently.
+func enabledCharts(env *config.Environment, tiers ...string) ([]helm.ChartInfo, []appMismatch) {
+	var charts []helm.ChartInfo
+	var mismatches []appMismatch
+	for _, tier := range tiers {
+		enabled, _ := env.Apps.Tier(tier)
+
+		found, err := helm.DiscoverCharts(filepath.Join("k8s", tier))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			if !jsonOutput {
+				fmt.Printf("Warning: discovering charts in %s: %v\n", tier, err)
+			}
+			continue
+		}
+
+		for _, chart := range found {
+			switch {
+			case slices.Contains(enabled, chart.Name):
+				charts = append(charts, chart)
+			case !env.Apps.Declared(tier, chart.Name):
+				mismatches = append(mismatches, appMismatch{Tier: tier, App: chart.Name, Problem: mismatchNotInConfig})
+			}
+		}
+
+		for _, app := range enabled {
+			if _, err := os.Stat(filepath.Join("k8s", tier, app)); os.IsNotExist(err) {
+				mismatches = append(mismatches, appMismatch{Tier: tier, App: app, Problem: mismatchNoChart})
+			}
+		}
+	}
+	return charts, mismatches
+}
+
+// warnAppMismatches prints a warning for each mismatch between k8s/ and the
+// CUE config
+func warnAppMismatches(mismatches []appMismatch) {
+	if jsonOutput {
+		return
+	}
+	for _, m := range mismatches {
+		fmt.Printf("Warning: %s/%s: %s\n", m.Tier, m.App, m.Problem)
+	}
+}
+
+// chartsForTarget returns the charts that target (all tiers, one tier or a
+// single app) selects for env, warning about mismatches between k8s/ and the
+// CUE config along the way. Naming an app env doesn't enable is an error.
+func chartsForTarget(env *config.Environment, target string) ([]helm.ChartInfo, error) {
+	tier, app := parseK8sTarget(target)
+
+	if app == "" {
+		tiers := config.Tiers
+		if tier != "" {
+			if _, ok := env.Apps.Tier(tier); !ok {
+				return nil, fmt.Errorf("unknown tier: %s", tier)
+			}
+			tiers = []string{tier}
+		}
+		charts, mismatches := enabledCharts(env, tiers...)
+		warnAppMismatches(mismatches)
+		return charts, nil
+	}
+
+	if err := checkAppEnabled(env, tier, app); err != nil {
+		return nil, err
+	}
+	return []helm.ChartInfo{{Tier: tier, Name: app}}, nil
+}
+
+// checkAppEnabled returns an error unless env enables app in tier
+func checkAppEnabled(env *config.Environment, tier, app string) error {
+	enabled, ok := env.Apps.Tier(tier)
+	switch {
+	case !ok:
+		return fmt.Errorf("app %s not found under k8s/<tier>", app)
+	case slices.Contains(enabled, app):
+		return nil
+	case env.Apps.Declared(tier, app):
+		return fmt.Errorf("%s/%s is disabled for environment %s", tier, app, env.Name)
+	default:
+		return fmt.Errorf("%s/%s is not declared in the CUE config", tier, app)
+	}
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/teekennedy/homelab/cmd/lab/config"
+	"github.com/teekennedy/homelab/cmd/lab/internal/helm"
+)
+
+// testEnvironment decodes apps the way the CUE export does
+func testEnvironment(t *testing.T, apps string) *config.Environment {
+	t.Helper()
+	env := &config.Environment{Name: "staging"}
+	require.NoError(t, env.Apps.UnmarshalJSON([]byte(apps)))
+	return env
+}
+
+// writeAppCharts creates a chart directory under k8s/ for each of dirs and
+// changes into the directory holding k8s/
+func writeAppCharts(t *testing.T, dirs ...string) {
+	t.Helper()
+	root := t.TempDir()
+	for _, dir := range dirs {
+		chartDir := filepath.Join(root, "k8s", dir)
+		require.NoError(t, os.MkdirAll(chartDir, 0o750))
+		chart := "apiVersion: v2\nname: " + filepath.Base(dir) + "\nversion: 0.1.0\n"
+		require.NoError(t, os.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte(chart), 0o600))
+	}
+	t.Chdir(root)
+}
+
+func TestEnabledCharts(t *testing.T) {
+	writeAppCharts(t,
+		"foundation/metallb",
+		"foundation/traefik",
+		"platform/longhorn",
+		"platform/stray",
+		"apps/forgejo",
+	)
+
+	tests := []struct {
+		name           string
+		apps           string
+		tiers          []string
+		wantCharts     []string
+		wantMismatches []appMismatch
+	}{
+		{
+			name:       "enabled apps in tier order",
+			apps:       `{"foundation": {"metallb": true, "traefik": true}, "platform": {"longhorn": true, "stray": false}, "apps": {"forgejo": true}}`,
+			tiers:      config.Tiers,
+			wantCharts: []string{"foundation/metallb", "foundation/traefik", "platform/longhorn", "apps/forgejo"},
+		},
+		{
+			name:       "disabled apps are skipped silently",
+			apps:       `{"foundation": {"metallb": true, "traefik": false}}`,
+			tiers:      []string{"foundation"},
+			wantCharts: []string{"foundation/metallb"},
+		},
+		{
+			name:       "undeclared chart",
+			apps:       `{"platform": {"longhorn": true}}`,
+			tiers:      []string{"platform"},
+			wantCharts: []string{"platform/longhorn"},
+			wantMismatches: []appMismatch{
+				{Tier: "platform", App: "stray", Problem: mismatchNotInConfig},
+			},
+		},
+		{
+			name:       "enabled app without a directory",
+			apps:       `{"apps": {"forgejo": true, "vaultwarden": true}}`,
+			tiers:      []string{"apps"},
+			wantCharts: []string{"apps/forgejo"},
+			wantMismatches: []appMismatch{
+				{Tier: "apps", App: "vaultwarden", Problem: mismatchNoChart},
+			},
+		},
+		{
+			name:       "list form has no disabled apps",
+			apps:       `{"foundation": ["metallb"]}`,
+			tiers:      []string{"foundation"},
+			wantCharts: []string{"foundation/metallb"},
+			wantMismatches: []appMismatch{
+				{Tier: "foundation", App: "traefik", Problem: mismatchNotInConfig},
+			},
+		},
+		{
+			name:  "tier without a directory",
+			apps:  `{"extras": {"demo": true}}`,
+			tiers: []string{"extras"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			charts, mismatches := enabledCharts(testEnvironment(t, tt.apps), tt.tiers...)
+			assert.Equal(t, tt.wantCharts, chartNames(charts))
+			assert.Equal(t, tt.wantMismatches, mismatches)
+		})
+	}
+}
+
+func TestCheckAppEnabled(t *testing.T) {
+	env := testEnvironment(t, `{"foundation": {"metallb": true, "traefik": false}, "apps": ["forgejo"]}`)
+
+	tests := []struct {
+		name    string
+		tier    string
+		app     string
+		wantErr string
+	}{
+		{name: "enabled", tier: "foundation", app: "metallb"},
+		{name: "enabled in list form", tier: "apps", app: "forgejo"},
+		{name: "disabled", tier: "foundation", app: "traefik", wantErr: "foundation/traefik is disabled for environment staging"},
+		{name: "undeclared", tier: "platform", app: "longhorn", wantErr: "platform/longhorn is not declared in the CUE config"},
+		{name: "unknown tier", tier: "extras", app: "demo", wantErr: "app demo not found under k8s/<tier>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkAppEnabled(env, tt.tier, tt.app)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+// chartNames returns tier/name for each chart
+func chartNames(charts []helm.ChartInfo) []string {
+	var names []string
+	for _, c := range charts {
+		names = append(names, c.Tier+"/"+c.Name)
+	}
+	return names
+}
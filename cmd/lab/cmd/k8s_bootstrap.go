@@ -0,0 +1,495 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/teekennedy/homelab/cmd/lab/config"
+	labenv "github.com/teekennedy/homelab/cmd/lab/env"
+	"github.com/teekennedy/homelab/cmd/lab/internal/helm"
+	"github.com/teekennedy/homelab/cmd/lab/internal/kube"
+	"github.com/teekennedy/homelab/cmd/lab/internal/paths"
+	"github.com/teekennedy/homelab/cmd/lab/kubeconfig"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Bootstrap step actions
+const (
+	bootstrapActionInstall   = "install"
+	bootstrapActionWait      = "wait"
+	bootstrapActionAppOfApps = "app-of-apps"
+)
+
+// Bootstrap step statuses
+const (
+	bootstrapStepDone    = "done"
+	bootstrapStepFailed  = "failed"
+	bootstrapStepSkipped = "skipped"
+)
+
+// bootstrapStep is one action taken during bootstrap
+type bootstrapStep struct {
+	App      string    `json:"app"`
+	Action   string    `json:"action"`
+	Status   string    `json:"status"`
+	Started  time.Time `json:"started"`
+	Duration string    `json:"duration"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// bootstrapReport records a bootstrap run. It doubles as the checkpoint file
+// read by --resume: apps in Completed are skipped.
+type bootstrapReport struct {
+	Environment string          `json:"environment"`
+	DryRun      bool            `json:"dry_run,omitempty"`
+	Order       []string        `json:"order"`
+	Completed   []string        `json:"completed"`
+	Steps       []bootstrapStep `json:"steps"`
+	Success     bool            `json:"success"`
+}
+
+// run times fn and records it as a step
+func (r *bootstrapReport) run(app, action string, fn func() error) error {
+	step := bootstrapStep{App: app, Action: action, Started: time.Now()}
+	err := fn()
+	step.Duration = time.Since(step.Started).Round(time.Millisecond).String()
+	step.Status = bootstrapStepDone
+	if err != nil {
+		step.Status = bootstrapStepFailed
+		step.Error = err.Error()
+	}
+	r.Steps = append(r.Steps, step)
+	return err
+}
+
+// skip records that app was completed by an earlier run
+func (r *bootstrapReport) skip(app, action string) {
+	r.Steps = append(r.Steps, bootstrapStep{App: app, Action: action, Status: bootstrapStepSkipped, Started: time.Now()})
+	r.Completed = append(r.Completed, app)
+}
+
+func newK8sBootstrapCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bootstrap",
+		Short: "Bootstrap Kubernetes cluster",
+		Long: `Bootstrap the Kubernetes cluster with foundation components.
+
+This command installs every foundation tier app enabled for --env. The order
+comes from each app's application.yaml: an app is installed after the apps
+listed in its lab.homelab/depends-on annotation (comma separated), and apps
+that set argocd.argoproj.io/sync-wave install in wave order, lowest first.
+Dependency cycles and dependencies that aren't enabled are reported before
+anything is installed.
+
+After installing an app, bootstrap waits up to --timeout for it to be usable
+before moving on: Deployments rolled out, CRDs established and admission
+webhooks backed by ready endpoints with a CA bundle.
+
+Progress is checkpointed to ~/.local/state/lab/k8s/bootstrap-<env>.json after
+every app. If bootstrap fails, fix the problem and re-run with --resume to
+skip the apps that already completed. The checkpoint is also the final report
+of every step, printed with --json.
+
+After bootstrap, ArgoCD will manage all applications.`,
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			cmd.SilenceUsage = true
+			envName, _ := cmd.Flags().GetString("env")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			skipArgo, _ := cmd.Flags().GetBool("skip-argocd")
+			resume, _ := cmd.Flags().GetBool("resume")
+			timeout, _ := cmd.Flags().GetDuration("timeout")
+			if !dryRun {
+				defer func() { getEnvManager().Record(envName, labenv.ActionBootstrap, "", err) }()
+			}
+
+			configDir := getConfigDir()
+			env, err := config.LoadEnvironment(configDir, envName)
+			if err != nil {
+				return fmt.Errorf("load environment: %w", err)
+			}
+
+			order, err := bootstrapOrder(env, skipArgo)
+			if err != nil {
+				return err
+			}
+
+			report := &bootstrapReport{Environment: envName, DryRun: dryRun, Order: order}
+			checkpoint := bootstrapCheckpointPath(envName)
+			var completed []string
+			if resume && !dryRun {
+				prev, err := loadBootstrapReport(checkpoint)
+				if err != nil {
+					return err
+				}
+				if prev != nil {
+					completed = prev.Completed
+				}
+			}
+
+			kc, err := setupKubeconfig(cmd.Context(), envName)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = kc.Close() }()
+
+			var checker *kube.ReadyChecker
+			if !dryRun {
+				restConfig, err := restConfigFor(kc)
+				if err != nil {
+					return err
+				}
+				if checker, err = kube.NewReadyChecker(restConfig); err != nil {
+					return fmt.Errorf("create readiness checker: %w", err)
+				}
+			}
+
+			if !jsonOutput {
+				fmt.Printf("Bootstrapping Kubernetes cluster for %s environment\n", envName)
+				if dryRun {
+					fmt.Println("(dry-run mode)")
+				}
+				fmt.Printf("Install order: %s\n", strings.Join(order, ", "))
+			}
+
+			runErr := runBootstrap(cmd.Context(), kc, checker, report, completed, timeout, dryRun, !skipArgo)
+			report.Success = runErr == nil
+
+			if !dryRun {
+				if err := saveBootstrapReport(checkpoint, report); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+				}
+			}
+
+			if jsonOutput {
+				if err := printJSON(report); err != nil {
+					return err
+				}
+				return runErr
+			}
+
+			printBootstrapReport(report)
+			if !dryRun {
+				fmt.Printf("\nCheckpoint: %s\n", checkpoint)
+			}
+			if runErr != nil {
+				if !dryRun {
+					fmt.Println("Fix the failure and re-run with --resume to continue.")
+				}
+				return runErr
+			}
+			if !dryRun {
+				printBootstrapComplete()
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().Bool("dry-run", false, "Show what would be installed without making changes")
+	cmd.Flags().Bool("skip-argocd", false, "Skip ArgoCD installation (for debugging)")
+	cmd.Flags().Bool("resume", false, "Skip apps completed by the previous bootstrap of this environment")
+	cmd.Flags().Duration("timeout", 5*time.Minute, "How long to wait for each app to become ready")
+
+	return cmd
+}
+
+// runBootstrap installs the apps in report.Order, waiting for each to become
+// ready, and then applies the ArgoCD app-of-apps if applyArgo is set. Apps in
+// completed are skipped. The checkpoint is saved after every app so a failed
+// run can be resumed.
+func runBootstrap(ctx context.Context, kc *kubeconfig.Handle, checker *kube.ReadyChecker, report *bootstrapReport, completed []string, timeout time.Duration, dryRun, applyArgo bool) error {
+	w := appOutput()
+	checkpoint := bootstrapCheckpointPath(report.Environment)
+
+	for _, app := range report.Order {
+		if slices.Contains(completed, app) {
+			if !jsonOutput {
+				fmt.Printf("\nSkipping %s (completed by previous run)\n", app)
+			}
+			report.skip(app, bootstrapActionInstall)
+			continue
+		}
+
+		if !jsonOutput {
+			fmt.Printf("\nInstalling %s...\n", app)
+		}
+
+		appPath := filepath.Join("k8s", "foundation", app)
+		if err := report.run(app, bootstrapActionInstall, func() error {
+			return installFoundationApp(ctx, kc, w, app, appPath, dryRun)
+		}); err != nil {
+			return err
+		}
+
+		if !dryRun {
+			if !jsonOutput {
+				fmt.Printf("Waiting for %s to become ready...\n", app)
+			}
+			if err := report.run(app, bootstrapActionWait, func() error {
+				return waitFoundationApp(ctx, kc, checker, app, appPath, timeout)
+			}); err != nil {
+				return err
+			}
+
+			report.Completed = append(report.Completed, app)
+			if err := saveBootstrapReport(checkpoint, report); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+		}
+	}
+
+	if applyArgo && !dryRun {
+		// A failed app-of-apps is recorded but doesn't fail bootstrap, since
+		// ArgoCD itself isn't required for the rest of bootstrap to have succeeded
+		_ = report.run("argocd", bootstrapActionAppOfApps, func() error {
+			return applyArgoAppOfApps(ctx, kc, w)
+		})
+	}
+
+	return nil
+}
+
+// bootstrapOrder returns the foundation apps enabled in env in the order they
+// must be installed, omitting argocd if skipArgo is set. Enabled apps without a
+// directory under k8s/foundation/ are skipped with a warning.
+func bootstrapOrder(env *config.Environment, skipArgo bool) ([]string, error) {
+	var nodes []helm.AppNode
+	for _, app := range env.Apps.Foundation {
+		if skipArgo && app == "argocd" {
+			continue
+		}
+
+		appPath := filepath.Join("k8s", "foundation", app)
+		if _, err := os.Stat(appPath); os.IsNotExist(err) {
+			if !jsonOutput {
+				fmt.Printf("Warning: foundation/%s: %s\n", app, mismatchNoChart)
+			}
+			continue
+		}
+
+		node, err := helm.ReadAppNode(appPath)
+		if err != nil {
+			return nil, fmt.Errorf("read foundation/%s: %w", app, err)
+		}
+		if skipArgo {
+			node.DependsOn = slices.DeleteFunc(node.DependsOn, func(dep string) bool { return dep == "argocd" })
+		}
+		nodes = append(nodes, node)
+	}
+
+	order, err := helm.InstallOrder(nodes)
+	if err != nil {
+		return nil, fmt.Errorf("order foundation apps: %w", err)
+	}
+	return order, nil
+}
+
+// installFoundationApp installs a single foundation-tier app at appPath, either via
+// `kubectl apply -k` (if it has no Chart.yaml) or via Helm (building dependencies first
+// if needed). Command output is written to w.
+func installFoundationApp(ctx context.Context, kc *kubeconfig.Handle, w io.Writer, app, appPath string, dryRun bool) error {
+	chartPath := filepath.Join(appPath, "Chart.yaml")
+	if _, err := os.Stat(chartPath); os.IsNotExist(err) {
+		if err := applyKustomization(ctx, kc, w, appPath, dryRun); err != nil {
+			return fmt.Errorf("install %s: %w", app, err)
+		}
+		return nil
+	}
+
+	info, err := helm.ParseChartInfo(appPath)
+	if err != nil {
+		return fmt.Errorf("parse chart info for %s: %w", app, err)
+	}
+
+	needs, err := helm.NeedsDependencyBuild(appPath)
+	if err != nil {
+		return fmt.Errorf("check deps for %s: %w", app, err)
+	}
+	if needs {
+		depCmd := exec.CommandContext(ctx, "helm", "dependency", "build", appPath)
+		depCmd.Stdout = w
+		depCmd.Stderr = w
+		if err := depCmd.Run(); err != nil {
+			return fmt.Errorf("build deps for %s: %w", app, err)
+		}
+	}
+
+	helmArgs := []string{
+		"upgrade", "--install", info.ReleaseName, appPath,
+		"--namespace", info.Namespace,
+		"--create-namespace",
+	}
+	if dryRun {
+		helmArgs = append(helmArgs, "--dry-run")
+	}
+
+	clusterValues := filepath.Join(getConfigDir(), "gen", "cluster-values.yaml")
+	if _, err := os.Stat(clusterValues); err == nil {
+		helmArgs = append(helmArgs, "--values", clusterValues)
+	}
+
+	helmCmd := kc.Command(ctx, "helm", helmArgs...)
+	helmCmd.Stdout = w
+	helmCmd.Stderr = w
+	if err := helmCmd.Run(); err != nil {
+		return fmt.Errorf("install %s: %w", app, err)
+	}
+	return nil
+}
+
+// waitFoundationApp waits up to timeout for the resources an installed app
+// created to become ready
+func waitFoundationApp(ctx context.Context, kc *kubeconfig.Handle, checker *kube.ReadyChecker, app, appPath string, timeout time.Duration) error {
+	objs, namespace, err := installedObjects(ctx, kc, appPath)
+	if err != nil {
+		return fmt.Errorf("list resources of %s: %w", app, err)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := checker.WaitReady(waitCtx, objs, namespace); err != nil {
+		return fmt.Errorf("wait for %s: %w", app, err)
+	}
+	return nil
+}
+
+// installedObjects returns the objects an app installed and the namespace
+// they default to: the Helm release manifest for charts, or the rendered
+// kustomization otherwise
+func installedObjects(ctx context.Context, kc *kubeconfig.Handle, appPath string) ([]*unstructured.Unstructured, string, error) {
+	info, err := helm.ParseChartInfo(appPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("parse chart info: %w", err)
+	}
+
+	_, chartErr := os.Stat(filepath.Join(appPath, "Chart.yaml"))
+	_, kustomizeErr := os.Stat(filepath.Join(appPath, "kustomization.yaml"))
+
+	var c *exec.Cmd
+	switch {
+	case chartErr == nil:
+		c = kc.Command(ctx, "helm", "get", "manifest", info.ReleaseName, "--namespace", info.Namespace)
+	case kustomizeErr == nil:
+		c = kc.Command(ctx, "kubectl", "kustomize", appPath)
+	default:
+		return nil, info.Namespace, nil
+	}
+
+	var stderr strings.Builder
+	c.Stderr = &stderr
+	out, err := c.Output()
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w: %s", strings.Join(c.Args[:2], " "), err, strings.TrimSpace(stderr.String()))
+	}
+
+	objs, err := kube.ParseManifests(out)
+	if err != nil {
+		return nil, "", fmt.Errorf("parse manifests: %w", err)
+	}
+	return objs, info.Namespace, nil
+}
+
+// applyArgoAppOfApps applies the foundation tier's ArgoCD app-of-apps manifest
+func applyArgoAppOfApps(ctx context.Context, kc *kubeconfig.Handle, w io.Writer) error {
+	if !jsonOutput {
+		fmt.Println("\nApplying ArgoCD app-of-apps...")
+	}
+
+	kubectlCmd := kc.Command(ctx, "kubectl", "apply", "-f", "k8s/foundation/application.yaml")
+	kubectlCmd.Stdout = w
+	kubectlCmd.Stderr = w
+	if err := kubectlCmd.Run(); err != nil {
+		if !jsonOutput {
+			fmt.Printf("Warning: failed to apply foundation app-of-apps: %v\n", err)
+		}
+		return fmt.Errorf("apply foundation app-of-apps: %w", err)
+	}
+	return nil
+}
+
+func applyKustomization(ctx context.Context, kc *kubeconfig.Handle, w io.Writer, path string, dryRun bool) error {
+	kustomizePath := filepath.Join(path, "kustomization.yaml")
+	if _, err := os.Stat(kustomizePath); err == nil {
+		args := []string{"apply", "-k", path}
+		if dryRun {
+			args = append(args, "--dry-run=client")
+		}
+		kubectlCmd := kc.Command(ctx, "kubectl", args...)
+		kubectlCmd.Stdout = w
+		kubectlCmd.Stderr = w
+		if err := kubectlCmd.Run(); err != nil {
+			return fmt.Errorf("kubectl apply: %w", err)
+		}
+		return nil
+	}
+	return nil
+}
+
+// bootstrapCheckpointPath returns where bootstrap progress for env is saved
+func bootstrapCheckpointPath(env string) string {
+	return filepath.Join(paths.StateDir("k8s"), "bootstrap-"+env+".json")
+}
+
+// loadBootstrapReport reads a checkpoint, returning nil if there isn't one
+func loadBootstrapReport(path string) (*bootstrapReport, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // path is derived from the XDG state dir + env name
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read bootstrap checkpoint: %w", err)
+	}
+
+	var report bootstrapReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("parse bootstrap checkpoint %s: %w", path, err)
+	}
+	return &report, nil
+}
+
+// saveBootstrapReport writes report to the checkpoint file at path
+func saveBootstrapReport(path string, report *bootstrapReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal bootstrap checkpoint: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create state directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("write bootstrap checkpoint: %w", err)
+	}
+	return nil
+}
+
+// printBootstrapReport prints a table of the steps bootstrap took
+func printBootstrapReport(report *bootstrapReport) {
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "APP\tACTION\tSTATUS\tDURATION\tERROR")
+	for _, s := range report.Steps {
+		errMsg, _, _ := strings.Cut(s.Error, "\n")
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.App, s.Action, s.Status, s.Duration, errMsg)
+	}
+	_ = w.Flush()
+}
+
+// printBootstrapComplete prints the post-bootstrap success message and next steps.
+func printBootstrapComplete() {
+	fmt.Println("\nBootstrap complete!")
+	fmt.Println("ArgoCD will now manage the remaining applications.")
+	fmt.Println("\nTo access ArgoCD UI:")
+	fmt.Println("  kubectl port-forward svc/argocd-server -n argocd 8080:443")
+	fmt.Println("  open https://localhost:8080")
+}
@@ -0,0 +1,355 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/teekennedy/homelab/cmd/lab/config"
+	"github.com/teekennedy/homelab/cmd/lab/internal/helm"
+	"github.com/teekennedy/homelab/cmd/lab/internal/kube"
+)
+
+// capacityUsage is the resources of one namespace or app
+type capacityUsage struct {
+	Name string `json:"name"`
+	kube.Resources
+}
+
+// capacityReport is the output of `lab k8s capacity`
+type capacityReport struct {
+	Environment string               `json:"environment"`
+	Apps        []capacityUsage      `json:"apps"`
+	Namespaces  []capacityUsage      `json:"namespaces"`
+	Total       kube.Resources       `json:"total"`
+	Nodes       []kube.NodeCapacity  `json:"nodes"`
+	Capacity    kube.ClusterCapacity `json:"capacity"`
+	Warnings    []string             `json:"warnings"`
+	// Errors lists apps that couldn't be rendered, by tier/app
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// appResources is the result of rendering one app for its resources
+type appResources struct {
+	App string
+	// Namespaces holds the app's resources by the namespace they run in
+	Namespaces map[string]kube.Resources
+	Error      string
+}
+
+func newK8sCapacityCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "capacity [app]",
+		Short: "Compare the resources charts request with node capacity",
+		Long: `Total the CPU and memory the enabled charts request and limit, and
+compare the requests with what the nodes offer.
+
+Every chart enabled for --env in the CUE config is rendered the same way as
+'lab k8s render'. Each workload's pod resources are multiplied by its replicas,
+or by the number of nodes for DaemonSets, and totalled per app and namespace.
+
+Node capacity is read from the nixos-facter report of each host in the
+environment (nix/hosts/<host>/facter.json), which is the raw hardware. With
+--live, the allocatable resources the nodes of the running cluster report are
+used instead.
+
+A warning is printed when requests exceed the total capacity, or what is left
+after losing the largest node, since pods wouldn't all be scheduled again
+while that node is down.
+
+Examples:
+  lab k8s capacity                  # All enabled apps against facter.json
+  lab k8s capacity --live           # Against the cluster's allocatable resources
+  lab k8s capacity platform         # One tier
+  lab k8s capacity --json`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			envName, _ := cmd.Flags().GetString("env")
+			concurrency, _ := cmd.Flags().GetInt("concurrency")
+			live, _ := cmd.Flags().GetBool("live")
+
+			target := ""
+			if len(args) > 0 {
+				target = args[0]
+			}
+
+			env, err := config.LoadEnvironment(getConfigDir(), envName)
+			if err != nil {
+				return fmt.Errorf("load environment: %w", err)
+			}
+
+			var nodes []kube.NodeCapacity
+			if live {
+				nodes, err = liveNodeCapacities(cmd.Context(), envName)
+			} else {
+				nodes, err = facterNodeCapacities(env)
+			}
+			if err != nil {
+				return err
+			}
+
+			report, err := collectCapacity(cmd.Context(), env, target, nodes, concurrency)
+			if err != nil {
+				return err
+			}
+
+			if jsonOutput {
+				if err := printJSON(report); err != nil {
+					return err
+				}
+			} else {
+				printCapacityReport(report)
+			}
+
+			if len(report.Errors) > 0 {
+				return fmt.Errorf("%d apps failed to render", len(report.Errors))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().Int("concurrency", defaultK8sConcurrency, "Number of apps to render in parallel")
+	cmd.Flags().Bool("live", false, "Read node capacity from the running cluster instead of facter.json")
+
+	return cmd
+}
+
+// liveNodeCapacities reads the allocatable resources of the cluster's nodes
+func liveNodeCapacities(ctx context.Context, envName string) ([]kube.NodeCapacity, error) {
+	kc, err := setupKubeconfig(ctx, envName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = kc.Close() }()
+
+	restConfig, err := restConfigFor(kc)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := kube.NewStatusReader(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("create status reader: %w", err)
+	}
+	nodes, err := reader.NodeCapacities(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read node capacity: %w", err)
+	}
+	return nodes, nil
+}
+
+// facterNodeCapacities reads the hardware of each of env's hosts from its
+// nixos-facter report
+func facterNodeCapacities(env *config.Environment) ([]kube.NodeCapacity, error) {
+	nodes := make([]kube.NodeCapacity, 0, len(env.Hosts))
+	for _, host := range env.Hosts {
+		path := filepath.Join("nix", "hosts", host.Name, "facter.json")
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil, fmt.Errorf("host %s has no %s; use --live to read capacity from the cluster", host.Name, path)
+		}
+		node, err := kube.FacterCapacity(host.Name, path)
+		if err != nil {
+			return nil, fmt.Errorf("host %s: %w", host.Name, err)
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// collectCapacity renders the apps target selects for env and totals their
+// resources per app and namespace against the capacity of nodes
+func collectCapacity(ctx context.Context, env *config.Environment, target string, nodes []kube.NodeCapacity, concurrency int) (*capacityReport, error) {
+	charts, err := chartsForTarget(env, target)
+	if err != nil {
+		return nil, err
+	}
+
+	valuesFile, cleanup, err := writeClusterValues(getConfigDir(), env.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	// Rendering progress isn't interesting here; failures are reported below
+	results := runAppsParallel(ctx, io.Discard, charts, concurrency, func(ctx context.Context, w io.Writer, chart helm.ChartInfo) appResources {
+		result := appResources{App: chart.Tier + "/" + chart.Name, Namespaces: map[string]kube.Resources{}}
+		chartDir := filepath.Join("k8s", chart.Tier, chart.Name)
+		info, err := helm.ParseChartInfo(chartDir)
+		if err != nil {
+			result.Error = fmt.Sprintf("parse chart info: %v", err)
+			return result
+		}
+		objs, err := renderAppObjects(ctx, w, chartDir, valuesFile)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		for _, obj := range objs {
+			used := kube.WorkloadResources(obj, len(nodes))
+			if used == (kube.Resources{}) {
+				continue
+			}
+			namespace := obj.GetNamespace()
+			if namespace == "" {
+				namespace = info.Namespace
+			}
+			total := result.Namespaces[namespace]
+			total.Add(used)
+			result.Namespaces[namespace] = total
+		}
+		return result
+	})
+
+	report := &capacityReport{
+		Environment: env.Name,
+		Apps:        []capacityUsage{},
+		Namespaces:  []capacityUsage{},
+		Nodes:       nodes,
+		Capacity:    kube.TotalCapacity(nodes),
+		Warnings:    []string{},
+	}
+	byNamespace := map[string]kube.Resources{}
+	for _, r := range results {
+		if r.Error != "" {
+			if report.Errors == nil {
+				report.Errors = map[string]string{}
+			}
+			report.Errors[r.App] = r.Error
+			continue
+		}
+		app := capacityUsage{Name: r.App}
+		for namespace, used := range r.Namespaces {
+			app.Add(used)
+			total := byNamespace[namespace]
+			total.Add(used)
+			byNamespace[namespace] = total
+		}
+		report.Apps = append(report.Apps, app)
+		report.Total.Add(app.Resources)
+	}
+	for _, namespace := range slices.Sorted(maps.Keys(byNamespace)) {
+		report.Namespaces = append(report.Namespaces, capacityUsage{Name: namespace, Resources: byNamespace[namespace]})
+	}
+	slices.SortFunc(report.Apps, func(a, b capacityUsage) int { return strings.Compare(a.Name, b.Name) })
+
+	report.Warnings = capacityWarnings(report.Total, report.Capacity, len(nodes))
+	return report, nil
+}
+
+// capacityWarnings explains where requests don't fit into capacity, either
+// at all or after losing the largest of nodes
+func capacityWarnings(total kube.Resources, capacity kube.ClusterCapacity, nodes int) []string {
+	warnings := []string{}
+	check := func(resource string, requested, available, spare int64, format func(int64) string) {
+		switch {
+		case requested > available:
+			warnings = append(warnings, fmt.Sprintf("%s requests (%s) exceed the capacity of all %d nodes (%s)",
+				resource, format(requested), nodes, format(available)))
+		case requested > spare:
+			warnings = append(warnings, fmt.Sprintf("%s requests (%s) exceed what is left after losing the largest node (%s)",
+				resource, format(requested), format(spare)))
+		}
+	}
+	check("CPU", total.CPURequests, capacity.CPU, capacity.SpareCPU, formatCPU)
+	check("Memory", total.MemoryRequests, capacity.Memory, capacity.SpareMemory, formatMemory)
+	return warnings
+}
+
+// printCapacityReport prints per-app and per-namespace tables, node capacity
+// and how the requests compare with it
+func printCapacityReport(report *capacityReport) {
+	if len(report.Apps) == 0 {
+		fmt.Println("No apps rendered")
+	} else {
+		printCapacityUsage("APP", report.Apps)
+		fmt.Println()
+		printCapacityUsage("NAMESPACE", report.Namespaces)
+		fmt.Println()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "NODE\tCPU\tMEMORY\tSOURCE")
+	for _, n := range report.Nodes {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", n.Name, formatCPU(n.CPU), formatMemory(n.Memory), n.Source)
+	}
+	_ = w.Flush()
+
+	c := report.Capacity
+	fmt.Printf("\nCPU requests:    %s of %s (%s); %s without the largest node\n",
+		formatCPU(report.Total.CPURequests), formatCPU(c.CPU), percentOf(report.Total.CPURequests, c.CPU), formatCPU(c.SpareCPU))
+	fmt.Printf("Memory requests: %s of %s (%s); %s without the largest node\n",
+		formatMemory(report.Total.MemoryRequests), formatMemory(c.Memory), percentOf(report.Total.MemoryRequests, c.Memory), formatMemory(c.SpareMemory))
+
+	for _, warning := range report.Warnings {
+		fmt.Printf("Warning: %s\n", warning)
+	}
+	for _, app := range slices.Sorted(maps.Keys(report.Errors)) {
+		errMsg, _, _ := strings.Cut(report.Errors[app], "\n")
+		fmt.Printf("Error: %s: %s\n", app, errMsg)
+	}
+}
+
+// printCapacityUsage prints one table of resources with a total row
+func printCapacityUsage(heading string, rows []capacityUsage) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(w, "%s\tCPU REQ\tCPU LIM\tMEM REQ\tMEM LIM\n", heading)
+	var total kube.Resources
+	for _, r := range rows {
+		printResourcesRow(w, r.Name, r.Resources)
+		total.Add(r.Resources)
+	}
+	printResourcesRow(w, "TOTAL", total)
+	_ = w.Flush()
+}
+
+// printResourcesRow prints one table row of resources
+func printResourcesRow(w io.Writer, name string, r kube.Resources) {
+	_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", name,
+		formatCPU(r.CPURequests), formatCPU(r.CPULimits), formatMemory(r.MemoryRequests), formatMemory(r.MemoryLimits))
+}
+
+// formatCPU formats millicores as whole or fractional cores, or millicores
+// below one core
+func formatCPU(millis int64) string {
+	switch {
+	case millis == 0:
+		return "-"
+	case millis < 1000:
+		return fmt.Sprintf("%dm", millis)
+	case millis%1000 == 0:
+		return fmt.Sprintf("%d", millis/1000)
+	default:
+		return fmt.Sprintf("%.2f", float64(millis)/1000)
+	}
+}
+
+// formatMemory formats bytes in the largest binary unit up to Gi that keeps
+// the number at least one
+func formatMemory(bytes int64) string {
+	switch {
+	case bytes == 0:
+		return "-"
+	case bytes >= 1<<30:
+		return fmt.Sprintf("%.1fGi", float64(bytes)/(1<<30))
+	case bytes >= 1<<20:
+		return fmt.Sprintf("%dMi", bytes>>20)
+	default:
+		return fmt.Sprintf("%dKi", bytes>>10)
+	}
+}
+
+// percentOf formats part as a percentage of whole
+func percentOf(part, whole int64) string {
+	if whole == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", float64(part)*100/float64(whole))
+}
@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/teekennedy/homelab/cmd/lab/config"
+	"github.com/teekennedy/homelab/cmd/lab/internal/helm"
+	"github.com/teekennedy/homelab/cmd/lab/internal/kube"
+	"github.com/teekennedy/homelab/cmd/lab/internal/paths"
+)
+
+// compareSide is one side of an offline diff: a checkout of the repo and the
+// apps env enables in it
+type compareSide struct {
+	root       string
+	valuesFile string
+	enabled    map[string]bool
+}
+
+// render renders chart on this side, or returns no objects if the app isn't
+// enabled or has no chart here
+func (s compareSide) render(ctx context.Context, w io.Writer, chart helm.ChartInfo) ([]*unstructured.Unstructured, error) {
+	if !s.enabled[chart.Tier+"/"+chart.Name] {
+		return nil, nil
+	}
+	chartDir := filepath.Join(s.root, "k8s", chart.Tier, chart.Name)
+	if _, err := os.Stat(filepath.Join(chartDir, "Chart.yaml")); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return renderAppObjects(ctx, w, chartDir, s.valuesFile)
+}
+
+// runCompare diffs the manifests the working tree renders for target against
+// those rendered at ref, without contacting a cluster. Only charts changed
+// since ref, untracked ones included, and charts depending on a changed
+// library chart are rendered, unless the CUE config changed, in which case
+// every chart is. Apps enabled at ref but not in the working tree are reported as
+// removed.
+func runCompare(ctx context.Context, env *config.Environment, ref, target string, concurrency int) ([]appDiff, error) {
+	charts, err := chartsForTarget(env, target)
+	if err != nil {
+		return nil, err
+	}
+
+	changed, err := helm.ChangedChartPaths(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("find charts changed since %s: %w", ref, err)
+	}
+
+	worktree, removeWorktree, err := addWorktree(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	defer removeWorktree()
+
+	baseConfigDir := filepath.Join(worktree, paths.ProjectConfigDir())
+	baseEnv, err := config.LoadEnvironment(baseConfigDir, env.Name)
+	if err != nil {
+		return nil, fmt.Errorf("load environment at %s: %w", ref, err)
+	}
+
+	tier, app := parseK8sTarget(target)
+	tiers := config.Tiers
+	if tier != "" {
+		tiers = []string{tier}
+	}
+	head := compareSide{root: ".", enabled: enabledSet(env, tiers)}
+	base := compareSide{root: worktree, enabled: enabledSet(baseEnv, tiers)}
+
+	if !slices.Equal(changed, []string{"k8s"}) {
+		charts = slices.DeleteFunc(charts, func(c helm.ChartInfo) bool {
+			return !slices.Contains(changed, filepath.Join("k8s", c.Tier, c.Name))
+		})
+	}
+	for _, key := range slices.Sorted(maps.Keys(base.enabled)) {
+		baseTier, baseApp, _ := strings.Cut(key, "/")
+		if !head.enabled[key] && (app == "" || app == baseApp) {
+			charts = append(charts, helm.ChartInfo{Tier: baseTier, Name: baseApp})
+		}
+	}
+	slices.SortStableFunc(charts, func(a, b helm.ChartInfo) int {
+		return slices.Index(config.Tiers, a.Tier) - slices.Index(config.Tiers, b.Tier)
+	})
+
+	if len(charts) == 0 {
+		if !jsonOutput {
+			fmt.Printf("No charts changed since %s\n", ref)
+		}
+		return []appDiff{}, nil
+	}
+
+	var cleanupHead, cleanupBase func()
+	if head.valuesFile, cleanupHead, err = writeClusterValues(getConfigDir(), env.Name); err != nil {
+		return nil, err
+	}
+	defer cleanupHead()
+	if base.valuesFile, cleanupBase, err = writeClusterValues(baseConfigDir, env.Name); err != nil {
+		return nil, fmt.Errorf("at %s: %w", ref, err)
+	}
+	defer cleanupBase()
+
+	return runAppsParallel(ctx, appOutput(), charts, concurrency, func(ctx context.Context, w io.Writer, chart helm.ChartInfo) appDiff {
+		d := appDiff{Tier: chart.Tier, App: chart.Name}
+		if !jsonOutput {
+			_, _ = fmt.Fprintf(w, "\n--- %s/%s ---\n", chart.Tier, chart.Name)
+		}
+
+		resources, err := compareApp(ctx, w, base, head, chart)
+		if err != nil {
+			if !jsonOutput {
+				_, _ = fmt.Fprintf(w, "Error: %v\n", err)
+			}
+			d.Error = err.Error()
+			return d
+		}
+
+		d.Resources = resources
+		if !jsonOutput {
+			printAppDiff(w, d)
+		}
+		return d
+	}), nil
+}
+
+// compareApp renders chart on both sides and diffs the results
+func compareApp(ctx context.Context, w io.Writer, base, head compareSide, chart helm.ChartInfo) ([]kube.ResourceDiff, error) {
+	baseObjs, err := base.render(ctx, w, chart)
+	if err != nil {
+		return nil, fmt.Errorf("render base: %w", err)
+	}
+	headObjs, err := head.render(ctx, w, chart)
+	if err != nil {
+		return nil, fmt.Errorf("render head: %w", err)
+	}
+
+	resources, err := kube.CompareManifests(baseObjs, headObjs)
+	if err != nil {
+		return nil, fmt.Errorf("compare %s/%s: %w", chart.Tier, chart.Name, err)
+	}
+	return resources, nil
+}
+
+// enabledSet returns the tier/app names env enables in tiers
+func enabledSet(env *config.Environment, tiers []string) map[string]bool {
+	set := map[string]bool{}
+	for _, tier := range tiers {
+		apps, _ := env.Apps.Tier(tier)
+		for _, app := range apps {
+			set[tier+"/"+app] = true
+		}
+	}
+	return set
+}
+
+// addWorktree checks ref out into a temporary git worktree. The returned
+// cleanup removes the worktree again. Registrations of worktrees whose
+// directory is gone, e.g. after lab was killed mid-diff, are pruned first.
+func addWorktree(ctx context.Context, ref string) (string, func(), error) {
+	_ = exec.CommandContext(ctx, "git", "worktree", "prune").Run()
+
+	dir, err := os.MkdirTemp("", "lab-diff-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("create worktree directory: %w", err)
+	}
+
+	gitCmd := exec.CommandContext(ctx, "git", "worktree", "add", "--detach", "--quiet", dir, ref)
+	gitCmd.Stderr = os.Stderr
+	if err := gitCmd.Run(); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("check out %s: %w", ref, err)
+	}
+
+	cleanup := func() {
+		// Runs after ctx may have been cancelled, e.g. by Ctrl-C, which
+		// Execute turns into a cancellation so this still runs
+		_ = exec.CommandContext(context.WithoutCancel(ctx), "git", "worktree", "remove", "--force", dir).Run()
+		_ = os.RemoveAll(dir)
+	}
+	return dir, cleanup, nil
+}
@@ -0,0 +1,260 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/cobra"
+
+	"github.com/teekennedy/homelab/cmd/lab/config"
+	labenv "github.com/teekennedy/homelab/cmd/lab/env"
+	"github.com/teekennedy/homelab/cmd/lab/internal/helm"
+	"github.com/teekennedy/homelab/cmd/lab/kubeconfig"
+)
+
+const (
+	// devInstanceLabel selects the resources a Helm release created
+	devInstanceLabel = "app.kubernetes.io/instance"
+	// devMaxLogStreams caps how many containers are followed at once
+	devMaxLogStreams = 20
+)
+
+func newK8sDevCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dev <app>",
+		Short: "Live-sync an app to a Kind environment while editing it",
+		Long: `Run a development loop for one app against a Kind environment.
+
+The app is synced via Helm to the Kind environment named by --env (see
+'lab env create'), then its chart directory is watched. Whenever a chart file
+changes, the app is synced again. After each sync the rollout status of the
+app's Deployments, StatefulSets and DaemonSets is shown, followed by the logs
+of its pods until the next change. Apps are checked against, and rendered with
+the cluster values of, the CUE environment the Kind environment was created
+from.
+
+Only Kind environments are accepted, so the loop can't touch production.
+
+Examples:
+  lab k8s dev forgejo --env dev
+  lab k8s dev platform/forgejo --env dev --rollout-timeout 5m`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			envName, _ := cmd.Flags().GetString("env")
+			debounce, _ := cmd.Flags().GetDuration("debounce")
+			rolloutTimeout, _ := cmd.Flags().GetDuration("rollout-timeout")
+
+			if !cmd.Flags().Changed("env") {
+				return errors.New("lab k8s dev needs a Kind environment; pass --env (see 'lab env list')")
+			}
+
+			info, err := resolveRelease(args[0])
+			if err != nil {
+				return err
+			}
+
+			kc, configEnv, err := devKubeconfig(cmd.Context(), envName)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = kc.Close() }()
+
+			env, err := config.LoadEnvironment(getConfigDir(), configEnv)
+			if err != nil {
+				return fmt.Errorf("load environment: %w", err)
+			}
+			if err := checkAppEnabled(env, info.Tier, info.Name); err != nil {
+				return err
+			}
+
+			loop := &devLoop{kc: kc, info: info, configEnv: configEnv, rolloutTimeout: rolloutTimeout}
+			return loop.run(cmd.Context(), debounce)
+		},
+	}
+
+	cmd.Flags().Duration("debounce", 500*time.Millisecond, "How long to wait for edits to settle before syncing")
+	cmd.Flags().Duration("rollout-timeout", 2*time.Minute, "How long to wait for workloads to roll out after a sync")
+
+	return cmd
+}
+
+// devKubeconfig returns a kubeconfig handle for a running Kind environment,
+// along with the CUE environment it was created from
+func devKubeconfig(ctx context.Context, envName string) (*kubeconfig.Handle, string, error) {
+	env, err := getEnvManager().Get(ctx, envName)
+	if err != nil {
+		return nil, "", fmt.Errorf("get environment %s: %w", envName, err)
+	}
+	if env.Type != labenv.TypeKind {
+		return nil, "", fmt.Errorf("environment %s is not a Kind environment", envName)
+	}
+	if env.Status != labenv.StatusRunning {
+		return nil, "", fmt.Errorf("environment %s is %s; start it with 'lab env start %s'", envName, env.Status, envName)
+	}
+
+	path, err := getEnvManager().GetKubeconfig(envName)
+	if err != nil {
+		return nil, "", fmt.Errorf("get kubeconfig for %s: %w", envName, err)
+	}
+
+	configEnv := env.FromEnv
+	if configEnv == "" {
+		configEnv = "staging"
+	}
+	return kubeconfig.NewHandle(envName, path), configEnv, nil
+}
+
+// devLoop syncs an app on every change and follows its rollout and logs
+type devLoop struct {
+	kc   *kubeconfig.Handle
+	info helm.ChartInfo
+	// configEnv is the CUE environment the Kind environment was created from
+	configEnv      string
+	rolloutTimeout time.Duration
+
+	// valuesFile holds configEnv's cluster values, exported once per run
+	valuesFile string
+
+	// cancelLogs ends the log stream of the previous sync
+	cancelLogs context.CancelFunc
+	logsDone   sync.WaitGroup
+}
+
+// run syncs once, then again after every debounced chart change until ctx ends
+func (l *devLoop) run(ctx context.Context, debounce time.Duration) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("create watcher: %w", err)
+	}
+	defer func() { _ = watcher.Close() }()
+
+	if err := addWatchTargets(watcher, l.info.Tier+"/"+l.info.Name); err != nil {
+		return err
+	}
+	defer l.stopLogs()
+
+	// config/gen holds whichever environment was generated last, usually
+	// production, so export the Kind environment's own values
+	valuesFile, cleanup, err := writeClusterValues(getConfigDir(), l.configEnv)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	l.valuesFile = valuesFile
+
+	changes := make(chan string, 1)
+	var timer *time.Timer
+	l.syncOnce(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if !isRelevantWatchEvent(event) {
+				continue
+			}
+			if timer != nil {
+				timer.Stop()
+			}
+			changedFile := event.Name
+			timer = time.AfterFunc(debounce, func() {
+				select {
+				case changes <- changedFile:
+				default: // a sync is already queued and will pick this change up
+				}
+			})
+
+		case changedFile := <-changes:
+			fmt.Printf("\n--- File changed: %s ---\n", changedFile)
+			l.syncOnce(ctx)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Printf("Watch error: %v\n", err)
+		}
+	}
+}
+
+// syncOnce stops the current log stream, syncs the app and, if that worked,
+// waits for the rollout and starts following logs again
+func (l *devLoop) syncOnce(ctx context.Context) {
+	l.stopLogs()
+
+	if err := syncAppWithValues(ctx, l.kc, os.Stdout, l.info.Tier, l.info.Name, l.valuesFile); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println("\nWatching for changes... (Ctrl+C to stop)")
+		return
+	}
+
+	if err := l.rolloutStatus(ctx); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	fmt.Println("\nFollowing logs; watching for changes... (Ctrl+C to stop)")
+	l.followLogs(ctx)
+}
+
+// rolloutStatus waits for the release's workloads to finish rolling out,
+// printing kubectl's progress
+func (l *devLoop) rolloutStatus(ctx context.Context) error {
+	kubectl := l.kc.Command(ctx, "kubectl", "rollout", "status",
+		"deployment,statefulset,daemonset",
+		"--namespace", l.info.Namespace,
+		"--selector", devInstanceLabel+"="+l.info.ReleaseName,
+		"--timeout", l.rolloutTimeout.String())
+	kubectl.Stdout = os.Stdout
+	kubectl.Stderr = os.Stderr
+	if err := kubectl.Run(); err != nil {
+		return fmt.Errorf("rollout status: %w", err)
+	}
+	return nil
+}
+
+// stopLogs ends the running log stream, if any, and waits for it to exit
+func (l *devLoop) stopLogs() {
+	if l.cancelLogs == nil {
+		return
+	}
+	l.cancelLogs()
+	l.logsDone.Wait()
+	l.cancelLogs = nil
+}
+
+// followLogs streams the logs of the release's current pods until stopLogs is
+// called or ctx ends. kubectl logs only follows the pods that exist when it
+// starts, so the stream is restarted after every rollout.
+func (l *devLoop) followLogs(ctx context.Context) {
+	logCtx, cancel := context.WithCancel(ctx)
+	l.cancelLogs = cancel
+
+	kubectl := l.kc.Command(logCtx, "kubectl", "logs",
+		"--namespace", l.info.Namespace,
+		"--selector", devInstanceLabel+"="+l.info.ReleaseName,
+		"--all-containers",
+		"--follow",
+		"--prefix",
+		"--since", "10s",
+		"--max-log-requests", strconv.Itoa(devMaxLogStreams))
+	kubectl.Stdout = os.Stdout
+	kubectl.Stderr = os.Stderr
+
+	l.logsDone.Go(func() {
+		if err := kubectl.Run(); err != nil && logCtx.Err() == nil {
+			fmt.Printf("Warning: log stream for %s ended: %v\n", l.info.Namespace+"/"+l.info.ReleaseName, err)
+		}
+	})
+}
@@ -0,0 +1,277 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/teekennedy/homelab/cmd/lab/config"
+	"github.com/teekennedy/homelab/cmd/lab/internal/helm"
+	"github.com/teekennedy/homelab/cmd/lab/internal/kube"
+)
+
+// Exit codes for `lab k8s drift`, matching those of diff for changes and
+// failures
+const (
+	driftExitFound = diffExitChanges
+	driftExitError = diffExitError
+)
+
+// driftNamespace is the drift in one namespace; cluster-scoped objects have
+// an empty namespace
+type driftNamespace struct {
+	Namespace string             `json:"namespace"`
+	Objects   []kube.DriftObject `json:"objects"`
+}
+
+// appObjects is the result of rendering one app for the objects it produces
+type appObjects struct {
+	App     string
+	Objects []*unstructured.Unstructured
+	Error   string
+}
+
+func newK8sDriftCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "drift",
+		Short: "List live resources that git doesn't produce",
+		Long: `List resources in the cluster that no rendered chart or ArgoCD
+Application produces, such as leftovers of a manual 'kubectl apply' or of a
+deleted app.
+
+Every chart enabled for --env in the CUE config is rendered the same way as
+'lab k8s render'. Together with the tier and app application.yaml files and
+the resources ArgoCD Applications report, those are the objects git accounts
+for. Every listable resource in the cluster is then compared against them.
+
+Objects with owner references are skipped, since a controller created them,
+as are objects Kubernetes and controllers create without one: default service
+accounts, Helm release records, StatefulSet volume claims, cert-manager
+certificate Secrets, objects k3s applies from its server manifests and volumes
+Longhorn provisions. Anything else that is expected can be listed under
+drift.ignore in the CUE config, matching by kind, namespace and name globs.
+
+Exits 0 when there is no drift, 1 if drift is found, and 2 if the check
+itself failed, e.g. because a chart couldn't be rendered or the cluster
+couldn't be scanned.
+
+Examples:
+  lab k8s drift
+  lab k8s drift --env staging
+  lab k8s drift --json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			envName, _ := cmd.Flags().GetString("env")
+			concurrency, _ := cmd.Flags().GetInt("concurrency")
+
+			found, err := runDrift(cmd.Context(), envName, concurrency)
+			switch {
+			case err != nil:
+				return &ExitError{Code: driftExitError, Err: err}
+			case found:
+				cmd.SilenceErrors = true
+				return &ExitError{Code: driftExitFound}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().Int("concurrency", defaultK8sConcurrency, "Number of apps to render in parallel")
+
+	return cmd
+}
+
+// runDrift scans the cluster of envName for objects git doesn't account for,
+// prints them and reports whether there were any
+func runDrift(ctx context.Context, envName string, concurrency int) (bool, error) {
+	env, err := config.LoadEnvironment(getConfigDir(), envName)
+	if err != nil {
+		return false, fmt.Errorf("load environment: %w", err)
+	}
+
+	expected, err := gitObjects(ctx, env, concurrency)
+	if err != nil {
+		return false, err
+	}
+
+	kc, err := setupKubeconfig(ctx, envName)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = kc.Close() }()
+
+	restConfig, err := restConfigFor(kc)
+	if err != nil {
+		return false, err
+	}
+	scanner, err := kube.NewDriftScanner(restConfig)
+	if err != nil {
+		return false, fmt.Errorf("create drift scanner: %w", err)
+	}
+
+	if !jsonOutput {
+		fmt.Printf("Scanning the cluster for resources not in git (%d expected)...\n", len(expected))
+	}
+	drift, err := scanner.Scan(ctx, kube.DriftOptions{
+		Expected: expected,
+		Ignore:   driftIgnorer(env.Drift.Ignore),
+	})
+	if err != nil {
+		return false, fmt.Errorf("scan for drift: %w", err)
+	}
+
+	byNamespace := groupDrift(drift)
+	if jsonOutput {
+		if err := printJSON(byNamespace); err != nil {
+			return false, err
+		}
+	} else {
+		printDrift(byNamespace, len(drift))
+	}
+	return len(drift) > 0, nil
+}
+
+// gitObjects renders every chart env enables and parses the Application
+// manifests ArgoCD deploys them with. Namespaced objects that leave their
+// namespace to the release get the release namespace. Any render failure is
+// an error, since its objects would otherwise all be reported as drift.
+func gitObjects(ctx context.Context, env *config.Environment, concurrency int) ([]*unstructured.Unstructured, error) {
+	charts, mismatches := enabledCharts(env, config.Tiers...)
+	warnAppMismatches(mismatches)
+
+	valuesFile, cleanup, err := writeClusterValues(getConfigDir(), env.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	results := runAppsParallel(ctx, io.Discard, charts, concurrency, func(ctx context.Context, w io.Writer, chart helm.ChartInfo) appObjects {
+		result := appObjects{App: chart.Tier + "/" + chart.Name}
+		chartDir := filepath.Join("k8s", chart.Tier, chart.Name)
+		info, err := helm.ParseChartInfo(chartDir)
+		if err != nil {
+			result.Error = fmt.Sprintf("parse chart info: %v", err)
+			return result
+		}
+		objs, err := renderAppObjects(ctx, w, chartDir, valuesFile)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		for _, obj := range objs {
+			if obj.GetNamespace() == "" {
+				obj.SetNamespace(info.Namespace)
+			}
+		}
+		result.Objects = objs
+		return result
+	})
+
+	var objs []*unstructured.Unstructured
+	failed := map[string]string{}
+	for _, r := range results {
+		if r.Error != "" {
+			failed[r.App] = r.Error
+			continue
+		}
+		objs = append(objs, r.Objects...)
+	}
+	if len(failed) > 0 {
+		for _, app := range slices.Sorted(maps.Keys(failed)) {
+			errMsg, _, _ := strings.Cut(failed[app], "\n")
+			fmt.Fprintf(os.Stderr, "Error: %s: %s\n", app, errMsg)
+		}
+		return nil, fmt.Errorf("%d apps failed to render; their resources would all show as drift", len(failed))
+	}
+
+	applications, err := applicationManifests(charts)
+	if err != nil {
+		return nil, err
+	}
+	return append(objs, applications...), nil
+}
+
+// applicationManifests parses the tier app-of-apps manifests and the
+// application.yaml of each chart
+func applicationManifests(charts []helm.ChartInfo) ([]*unstructured.Unstructured, error) {
+	paths := make([]string, 0, len(config.Tiers)+len(charts))
+	for _, tier := range config.Tiers {
+		paths = append(paths, filepath.Join("k8s", tier, "application.yaml"))
+	}
+	for _, chart := range charts {
+		paths = append(paths, filepath.Join("k8s", chart.Tier, chart.Name, "application.yaml"))
+	}
+
+	var objs []*unstructured.Unstructured
+	for _, path := range paths {
+		data, err := os.ReadFile(path) //nolint:gosec // paths are built from tier and chart directory names
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", path, err)
+		}
+		parsed, err := kube.ParseManifests(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		objs = append(objs, parsed...)
+	}
+	return objs, nil
+}
+
+// driftIgnorer returns a DriftOptions.Ignore func for the CUE ignore rules
+func driftIgnorer(rules []config.DriftIgnore) func(kind, group, namespace, name string) bool {
+	return func(kind, group, namespace, name string) bool {
+		return slices.ContainsFunc(rules, func(r config.DriftIgnore) bool {
+			return r.Matches(kind, group, namespace, name)
+		})
+	}
+}
+
+// groupDrift groups drift by namespace, cluster-scoped objects first, with
+// the objects in each keeping Scan's order
+func groupDrift(drift []kube.DriftObject) []driftNamespace {
+	groups := []driftNamespace{}
+	for _, obj := range drift {
+		if len(groups) == 0 || groups[len(groups)-1].Namespace != obj.Namespace {
+			groups = append(groups, driftNamespace{Namespace: obj.Namespace})
+		}
+		last := &groups[len(groups)-1]
+		last.Objects = append(last.Objects, obj)
+	}
+	return groups
+}
+
+// printDrift prints one table per namespace
+func printDrift(groups []driftNamespace, total int) {
+	if total == 0 {
+		fmt.Println("No drift: every resource in the cluster is accounted for by git")
+		return
+	}
+
+	for _, group := range groups {
+		if group.Namespace == "" {
+			fmt.Println("\nCluster-scoped:")
+		} else {
+			fmt.Printf("\nNamespace %s:\n", group.Namespace)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, obj := range group.Objects {
+			_, _ = fmt.Fprintf(w, "  %s\t%s\tcreated %s\n", obj.String(), obj.APIVersion, obj.Created.Local().Format("2006-01-02 15:04"))
+		}
+		_ = w.Flush()
+	}
+
+	fmt.Printf("\n%d resources not in git\n", total)
+}
@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/teekennedy/homelab/cmd/lab/config"
+	"github.com/teekennedy/homelab/cmd/lab/internal/helm"
+	"github.com/teekennedy/homelab/cmd/lab/internal/kube"
+)
+
+// imageUse is one image in the inventory and the apps that run it
+type imageUse struct {
+	kube.ImageRef
+	Apps   []string `json:"apps"`
+	Issues []string `json:"issues"`
+}
+
+// imageInventory is the output of `lab k8s images`
+type imageInventory struct {
+	Environment string     `json:"environment"`
+	Images      []imageUse `json:"images"`
+	// Errors lists apps that couldn't be rendered, by tier/app
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// appImages is the result of rendering one app for its images
+type appImages struct {
+	App    string
+	Images []string
+	Error  string
+}
+
+func newK8sImagesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "images [app]",
+		Short: "List the container images all charts use",
+		Long: `List every container image the enabled charts deploy.
+
+Every chart enabled for --env in the CUE config is rendered the same way as
+'lab k8s render', and the images of all containers, init containers and
+ephemeral containers in workloads are collected. Each image is listed once,
+with its tag, digest and the apps that use it.
+
+Images are flagged when they use the latest tag or no tag at all, since those
+can change without the manifests changing, and when they aren't pinned by
+digest. The cluster is never contacted.
+
+Examples:
+  lab k8s images                  # All enabled apps
+  lab k8s images platform         # One tier
+  lab k8s images --issues-only    # Only images that need attention
+  lab k8s images --json           # For update tracking`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			envName, _ := cmd.Flags().GetString("env")
+			concurrency, _ := cmd.Flags().GetInt("concurrency")
+			issuesOnly, _ := cmd.Flags().GetBool("issues-only")
+
+			target := ""
+			if len(args) > 0 {
+				target = args[0]
+			}
+
+			env, err := config.LoadEnvironment(getConfigDir(), envName)
+			if err != nil {
+				return fmt.Errorf("load environment: %w", err)
+			}
+
+			inventory, err := collectImages(cmd.Context(), env, target, concurrency)
+			if err != nil {
+				return err
+			}
+			if issuesOnly {
+				inventory.Images = slices.DeleteFunc(inventory.Images, func(u imageUse) bool { return len(u.Issues) == 0 })
+			}
+
+			if jsonOutput {
+				if err := printJSON(inventory); err != nil {
+					return err
+				}
+			} else {
+				printImageInventory(inventory)
+			}
+
+			if len(inventory.Errors) > 0 {
+				return fmt.Errorf("%d apps failed to render", len(inventory.Errors))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().Int("concurrency", defaultK8sConcurrency, "Number of apps to render in parallel")
+	cmd.Flags().Bool("issues-only", false, "Only list images with a latest or missing tag or no digest")
+
+	return cmd
+}
+
+// collectImages renders the apps target selects for env and groups their
+// container images, sorted by image
+func collectImages(ctx context.Context, env *config.Environment, target string, concurrency int) (*imageInventory, error) {
+	charts, err := chartsForTarget(env, target)
+	if err != nil {
+		return nil, err
+	}
+
+	valuesFile, cleanup, err := writeClusterValues(getConfigDir(), env.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	// Rendering progress isn't interesting here; failures are reported below
+	results := runAppsParallel(ctx, io.Discard, charts, concurrency, func(ctx context.Context, w io.Writer, chart helm.ChartInfo) appImages {
+		result := appImages{App: chart.Tier + "/" + chart.Name}
+		objs, err := renderAppObjects(ctx, w, filepath.Join("k8s", chart.Tier, chart.Name), valuesFile)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		for _, obj := range objs {
+			for _, image := range kube.ContainerImages(obj) {
+				if !slices.Contains(result.Images, image) {
+					result.Images = append(result.Images, image)
+				}
+			}
+		}
+		return result
+	})
+
+	inventory := &imageInventory{Environment: env.Name, Images: []imageUse{}}
+	byImage := map[string]*imageUse{}
+	for _, r := range results {
+		if r.Error != "" {
+			if inventory.Errors == nil {
+				inventory.Errors = map[string]string{}
+			}
+			inventory.Errors[r.App] = r.Error
+			continue
+		}
+		for _, image := range r.Images {
+			use, ok := byImage[image]
+			if !ok {
+				ref := kube.ParseImageRef(image)
+				use = &imageUse{ImageRef: ref, Issues: ref.Issues()}
+				if use.Issues == nil {
+					use.Issues = []string{}
+				}
+				byImage[image] = use
+			}
+			use.Apps = append(use.Apps, r.App)
+		}
+	}
+
+	for _, use := range byImage {
+		inventory.Images = append(inventory.Images, *use)
+	}
+	slices.SortFunc(inventory.Images, func(a, b imageUse) int { return strings.Compare(a.Image, b.Image) })
+	return inventory, nil
+}
+
+// printImageInventory prints the inventory as a table followed by any render
+// failures
+func printImageInventory(inventory *imageInventory) {
+	if len(inventory.Images) == 0 {
+		fmt.Println("No images found")
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "IMAGE\tTAG\tDIGEST\tAPPS\tISSUES")
+		for _, u := range inventory.Images {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+				u.Repository, orDash(u.Tag), orDash(shortDigest(u.Digest)), strings.Join(u.Apps, ", "), orDash(strings.Join(u.Issues, ", ")))
+		}
+		_ = w.Flush()
+
+		flagged := 0
+		for _, u := range inventory.Images {
+			if len(u.Issues) > 0 {
+				flagged++
+			}
+		}
+		fmt.Printf("\n%d images, %d flagged\n", len(inventory.Images), flagged)
+	}
+
+	for _, app := range slices.Sorted(maps.Keys(inventory.Errors)) {
+		errMsg, _, _ := strings.Cut(inventory.Errors[app], "\n")
+		fmt.Printf("Error: %s: %s\n", app, errMsg)
+	}
+}
+
+// shortDigest abbreviates a digest for table output, like docker does
+func shortDigest(digest string) string {
+	algo, hex, ok := strings.Cut(digest, ":")
+	if !ok || len(hex) <= 12 {
+		return digest
+	}
+	return algo + ":" + hex[:12]
+}
+
+// orDash returns s, or "-" if s is empty
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,507 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/teekennedy/homelab/cmd/lab/config"
+	"github.com/teekennedy/homelab/cmd/lab/kubeconfig"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func newK8sKubeconfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "kubeconfig",
+		Short: "Manage kubeconfig files",
+		Long: `Commands for managing kubeconfig files for different environments.
+
+Decrypted kubeconfigs are written to $XDG_RUNTIME_DIR/lab/k8s/kubeconfig when
+XDG_RUNTIME_DIR is set and exists (usually a tmpfs), falling back to the XDG
+cache dir. Copies a running command decrypted for itself are removed when it
+exits, including on Ctrl-C. Any copy older than LAB_KUBECONFIG_TTL (default
+12h, 0 disables) is overwritten and removed at the start of every lab command,
+which also catches copies left behind by a killed process.`,
+	}
+
+	cmd.AddCommand(newK8sKubeconfigDecryptCmd())
+	cmd.AddCommand(newK8sKubeconfigCleanupCmd())
+	cmd.AddCommand(newK8sKubeconfigListCmd())
+	cmd.AddCommand(newK8sKubeconfigFetchCmd())
+	cmd.AddCommand(newK8sKubeconfigCheckCmd())
+	cmd.AddCommand(newK8sKubeconfigInstallCmd())
+	cmd.AddCommand(newK8sKubeconfigUninstallCmd())
+
+	return cmd
+}
+
+func newK8sKubeconfigDecryptCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "decrypt [environment]",
+		Short: "Decrypt kubeconfig for an environment",
+		Long: `Decrypt the kubeconfig for the specified environment and make it available.
+
+The decrypted kubeconfig is stored in the kubeconfig cache dir as <env>.yaml
+until it passes the cache TTL or 'lab k8s kubeconfig cleanup' is run.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			envName := "production"
+			if len(args) > 0 {
+				envName = args[0]
+			}
+
+			mgr := getKubeconfigManager()
+
+			if err := mgr.SetupPersistent(cmd.Context(), envName); err != nil {
+				return fmt.Errorf("setting up persistent kubeconfig: %w", err)
+			}
+
+			decPath := mgr.GetDecryptedPath(envName)
+			if !jsonOutput {
+				fmt.Printf("Kubeconfig decrypted for %s environment\n", envName)
+				fmt.Printf("Path: %s\n", decPath)
+				fmt.Printf("\nTo use:\n")
+				fmt.Printf("  export KUBECONFIG=%s\n", decPath)
+			} else {
+				result := map[string]string{
+					"environment": envName,
+					"path":        decPath,
+				}
+				out, _ := json.Marshal(result)
+				fmt.Println(string(out))
+			}
+
+			return nil
+		},
+	}
+}
+
+func newK8sKubeconfigCleanupCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "cleanup",
+		Short: "Remove decrypted kubeconfig files",
+		Long: `Overwrite and remove the decrypted kubeconfig files in the cache directory.
+
+Copies that running commands decrypted for themselves are left alone until
+they're older than LAB_KUBECONFIG_TTL, so cleanup never pulls credentials out
+from under a running --watch or 'lab env exec'.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr := getKubeconfigManager()
+
+			if err := mgr.CleanupAll(); err != nil {
+				return fmt.Errorf("cleanup: %w", err)
+			}
+
+			if !jsonOutput {
+				fmt.Println("Decrypted kubeconfig files cleaned up")
+			}
+
+			return nil
+		},
+	}
+}
+
+// kubeconfigListEntry is one environment in `lab k8s kubeconfig list`
+type kubeconfigListEntry struct {
+	Environment string `json:"environment"`
+	Status      string `json:"status"`
+	// ExpiresAt and DaysLeft describe the certificate that expires soonest
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	DaysLeft  *int       `json:"days_left,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	// Cached lists decrypted copies of the kubeconfig in the cache dir
+	Cached []kubeconfig.CacheEntry `json:"cached,omitempty"`
+}
+
+func newK8sKubeconfigListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List available kubeconfig files",
+		Long: `List all environments that have kubeconfig files available, with the number
+of days until the first of their certificates expires.
+
+Decrypted copies that are stale (the encrypted kubeconfig changed after they
+were decrypted) or past the cache TTL are reported.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr := getKubeconfigManager()
+
+			envs, err := mgr.ListEnvironments()
+			if err != nil {
+				return fmt.Errorf("list environments: %w", err)
+			}
+
+			cached, err := mgr.ListCached()
+			if err != nil {
+				return fmt.Errorf("list cached kubeconfigs: %w", err)
+			}
+
+			now := time.Now()
+			entries := make([]kubeconfigListEntry, 0, len(envs))
+			for _, env := range envs {
+				entry := kubeconfigListEntry{Environment: env, Status: "encrypted"}
+				for _, c := range cached {
+					if c.Env == env {
+						entry.Cached = append(entry.Cached, c)
+						entry.Status = "decrypted"
+					}
+				}
+
+				certs, err := mgr.Certificates(cmd.Context(), env)
+				if err != nil {
+					entry.Error = err.Error()
+				} else {
+					days := certs[0].DaysLeft(now)
+					entry.ExpiresAt = &certs[0].NotAfter
+					entry.DaysLeft = &days
+				}
+				entries = append(entries, entry)
+			}
+
+			if jsonOutput {
+				return printJSON(entries)
+			}
+
+			if len(entries) == 0 {
+				fmt.Println("No kubeconfig files found")
+				fmt.Printf("Expected location: %s\n", filepath.Join(getConfigDir(), "kubeconfig", "<env>.enc.yaml"))
+				return nil
+			}
+
+			fmt.Println("Available kubeconfigs:")
+			for _, entry := range entries {
+				expiry := "expiry unknown"
+				switch {
+				case entry.DaysLeft == nil:
+					if verbose {
+						expiry += ": " + entry.Error
+					}
+				case *entry.DaysLeft < 0:
+					expiry = fmt.Sprintf("expired %d days ago", -*entry.DaysLeft)
+				default:
+					expiry = fmt.Sprintf("expires in %d days", *entry.DaysLeft)
+				}
+				fmt.Printf("  - %s (%s, %s)\n", entry.Environment, entry.Status, expiry)
+				for _, c := range entry.Cached {
+					switch {
+					case c.Stale:
+						fmt.Printf("      stale copy: %s (encrypted kubeconfig changed since %s)\n", c.Path, c.ModTime.Format(time.DateTime))
+					case c.Expired:
+						fmt.Printf("      expired copy: %s (decrypted %s)\n", c.Path, c.ModTime.Format(time.DateTime))
+					case verbose:
+						fmt.Printf("      copy: %s (decrypted %s)\n", c.Path, c.ModTime.Format(time.DateTime))
+					}
+				}
+			}
+
+			return nil
+		},
+	}
+}
+
+func newK8sKubeconfigCheckCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "check [environment...]",
+		Short: "Check kubeconfig certificates for upcoming expiry",
+		Long: `Check the CA and client certificates in each environment's kubeconfig and fail
+if any expire within the threshold. Checks every environment if none are given.
+
+k3s rotates client certificates on restart once they are within 90 days of
+expiry, so a failure here usually means a restart or 'lab k8s kubeconfig fetch'
+is overdue.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+
+			threshold, _ := cmd.Flags().GetInt("threshold")
+			mgr := getKubeconfigManager()
+
+			envs := args
+			if len(envs) == 0 {
+				var err error
+				envs, err = mgr.ListEnvironments()
+				if err != nil {
+					return fmt.Errorf("list environments: %w", err)
+				}
+			}
+
+			type certResult struct {
+				Environment string `json:"environment"`
+				kubeconfig.CertInfo
+				DaysLeft int  `json:"days_left"`
+				OK       bool `json:"ok"`
+			}
+
+			now := time.Now()
+			var results []certResult
+			var failures []string
+			for _, env := range envs {
+				certs, err := mgr.Certificates(cmd.Context(), env)
+				if err != nil {
+					return fmt.Errorf("check %s: %w", env, err)
+				}
+				for _, cert := range certs {
+					days := cert.DaysLeft(now)
+					ok := days >= threshold
+					if !ok {
+						failures = append(failures, fmt.Sprintf("%s %s/%s", env, cert.Kind, cert.Name))
+					}
+					results = append(results, certResult{Environment: env, CertInfo: cert, DaysLeft: days, OK: ok})
+				}
+			}
+
+			if jsonOutput {
+				if err := printJSON(results); err != nil {
+					return err
+				}
+			} else {
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				_, _ = fmt.Fprintln(w, "ENV\tKIND\tNAME\tSUBJECT\tEXPIRES\tDAYS\tSTATUS")
+				for _, r := range results {
+					status := "ok"
+					if !r.OK {
+						status = "EXPIRING"
+					}
+					_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+						r.Environment, r.Kind, r.Name, r.Subject, r.NotAfter.Format(time.DateOnly), r.DaysLeft, status)
+				}
+				_ = w.Flush()
+			}
+
+			if len(failures) > 0 {
+				return fmt.Errorf("%d certificate(s) expire within %d days: %s", len(failures), threshold, strings.Join(failures, ", "))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().Int("threshold", 30, "Fail if any certificate expires within this many days")
+
+	return cmd
+}
+
+func newK8sKubeconfigInstallCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "install [environment]",
+		Short: "Merge an environment's kubeconfig into ~/.kube/config",
+		Long: `Decrypt the kubeconfig for an environment and merge it into ~/.kube/config as a
+named context, for tools like k9s and IDE plugins that read the default kubeconfig.
+
+The cluster, user and context entries are tagged with a lab-managed extension so
+'lab k8s kubeconfig uninstall' removes only what lab added. Re-running install
+refreshes the entries; entries with the same name that lab didn't create are
+left untouched and reported as a conflict.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+
+			envName := "production"
+			if len(args) > 0 {
+				envName = args[0]
+			}
+
+			target, _ := cmd.Flags().GetString("kubeconfig")
+			contextName, _ := cmd.Flags().GetString("context")
+			if contextName == "" {
+				contextName = kubeconfig.DefaultContextName(envName)
+			}
+			setCurrent, _ := cmd.Flags().GetBool("use")
+
+			mgr := getKubeconfigManager()
+			if err := mgr.Install(cmd.Context(), envName, target, contextName, setCurrent); err != nil {
+				return fmt.Errorf("install kubeconfig: %w", err)
+			}
+
+			if jsonOutput {
+				return printJSON(map[string]string{
+					"environment": envName,
+					"context":     contextName,
+					"path":        target,
+				})
+			}
+
+			fmt.Printf("Installed %s as context %q in %s\n", envName, contextName, target)
+			if !setCurrent {
+				fmt.Printf("\nTo use:\n")
+				fmt.Printf("  kubectl config use-context %s\n", contextName)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().String("kubeconfig", clientcmd.RecommendedHomeFile, "Kubeconfig file to merge into")
+	cmd.Flags().String("context", "", "Context name to install as (default: lab-<environment>)")
+	cmd.Flags().Bool("use", false, "Make the installed context the current context")
+
+	return cmd
+}
+
+func newK8sKubeconfigUninstallCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "uninstall [environment]",
+		Short: "Remove lab-managed contexts from ~/.kube/config",
+		Long: `Remove the cluster, user and context entries that 'lab k8s kubeconfig install'
+added for an environment, or for every environment if none is given. Entries
+lab didn't create are never touched.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+
+			envName := ""
+			if len(args) > 0 {
+				envName = args[0]
+			}
+			target, _ := cmd.Flags().GetString("kubeconfig")
+
+			removed, err := kubeconfig.Uninstall(target, envName)
+			if err != nil {
+				return fmt.Errorf("uninstall kubeconfig: %w", err)
+			}
+
+			if jsonOutput {
+				if removed == nil {
+					removed = []string{}
+				}
+				return printJSON(map[string]any{
+					"path":    target,
+					"removed": removed,
+				})
+			}
+
+			if len(removed) == 0 {
+				fmt.Printf("No lab-managed contexts found in %s\n", target)
+				return nil
+			}
+			for _, name := range removed {
+				fmt.Printf("Removed context %q from %s\n", name, target)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().String("kubeconfig", clientcmd.RecommendedHomeFile, "Kubeconfig file to remove contexts from")
+
+	return cmd
+}
+
+func newK8sKubeconfigFetchCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "fetch [environment]",
+		Short: "Fetch and encrypt the kubeconfig from a k3s server",
+		Long: `Pull the admin kubeconfig from the environment's cluster-init k3s server over SSH,
+rewrite it for the environment, and encrypt it to config/kubeconfig/<env>.enc.yaml.
+
+The server address defaults to the k3s serverAddr from the CUE host config (the
+control plane VIP), falling back to the cluster-init host's IP. Cluster, user
+and context are renamed to the environment name. Recipients come from the
+matching creation rule in .sops.yaml.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+
+			envName := "production"
+			if len(args) > 0 {
+				envName = args[0]
+			}
+
+			env, err := config.LoadEnvironment(getConfigDir(), envName)
+			if err != nil {
+				return fmt.Errorf("load environment: %w", err)
+			}
+
+			host, server, err := k3sServerForEnv(env)
+			if err != nil {
+				return err
+			}
+
+			sshHost, _ := cmd.Flags().GetString("host")
+			if sshHost == "" {
+				sshHost = host.IP
+			}
+			if override, _ := cmd.Flags().GetString("server"); override != "" {
+				server = override
+			}
+
+			if !jsonOutput {
+				fmt.Printf("Fetching kubeconfig from %s (%s)...\n", host.Name, sshHost)
+			}
+
+			raw, err := fetchK3sKubeconfig(cmd.Context(), sshHost)
+			if err != nil {
+				return err
+			}
+
+			content, err := kubeconfig.RewriteK3s(raw, envName, server)
+			if err != nil {
+				return fmt.Errorf("rewrite kubeconfig: %w", err)
+			}
+
+			mgr := getKubeconfigManager()
+			if err := mgr.Encrypt(envName, content); err != nil {
+				return fmt.Errorf("encrypt kubeconfig: %w", err)
+			}
+
+			encPath := mgr.GetEncryptedPath(envName)
+			if jsonOutput {
+				return printJSON(map[string]string{
+					"environment": envName,
+					"host":        host.Name,
+					"server":      server,
+					"path":        encPath,
+				})
+			}
+
+			fmt.Printf("Kubeconfig for %s written to %s\n", envName, encPath)
+			fmt.Printf("Server: %s\n", server)
+			return nil
+		},
+	}
+
+	cmd.Flags().String("host", "", "SSH destination to fetch from (default: the cluster-init host's IP)")
+	cmd.Flags().String("server", "", "API server URL to write (default: the k3s serverAddr from config)")
+
+	return cmd
+}
+
+// k3sServerForEnv returns the cluster-init host of an environment and the API
+// server URL clients should use. Joining servers point at the control plane
+// VIP via serverAddr, which survives the loss of any single server.
+func k3sServerForEnv(env *config.Environment) (config.Host, string, error) {
+	var initHost *config.Host
+	server := ""
+	for i, host := range env.Hosts {
+		if host.K3s.ClusterInit && initHost == nil {
+			initHost = &env.Hosts[i]
+		}
+		if server == "" && host.K3s.ServerAddr != "" {
+			server = host.K3s.ServerAddr
+		}
+	}
+
+	if initHost == nil {
+		return config.Host{}, "", errors.New("no k3s host with clusterInit in environment config")
+	}
+	if server == "" {
+		server = "https://" + initHost.IP + ":6443"
+	}
+
+	return *initHost, server, nil
+}
+
+// fetchK3sKubeconfig reads the k3s admin kubeconfig from a server over SSH
+func fetchK3sKubeconfig(ctx context.Context, sshHost string) ([]byte, error) {
+	sshCmd := exec.CommandContext(ctx, "ssh", sshHost, "sudo", "cat", kubeconfig.K3sKubeconfigPath)
+	sshCmd.Stderr = os.Stderr
+
+	out, err := sshCmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("read %s on %s: %w", kubeconfig.K3sKubeconfigPath, sshHost, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/teekennedy/homelab/cmd/lab/config"
+	"github.com/teekennedy/homelab/cmd/lab/internal/helm"
+	"github.com/teekennedy/homelab/cmd/lab/internal/kube"
+)
+
+// newAppDomain is the domain new apps' hostnames default to
+const newAppDomain = "msng.to"
+
+// appNamePattern matches names usable as chart, release and namespace names
+var appNamePattern = regexp.MustCompile(`^[a-z][a-z0-9-]*[a-z0-9]$`)
+
+// newAppResult is the output of `lab k8s new`
+type newAppResult struct {
+	Tier  string   `json:"tier"`
+	App   string   `json:"app"`
+	Files []string `json:"files"`
+	// Stacks are the CUE app stacks in base.cue the app was added to
+	Stacks []string `json:"stacks"`
+}
+
+func newK8sNewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "new <tier>/<app>",
+		Short: "Scaffold a new app chart",
+		Long: `Create the skeleton of a new app under k8s/<tier>/<app> and declare it in
+the CUE config.
+
+The chart gets a Deployment and Service for --image, and unless --route=false
+an HTTPRoute for --host on the internal gateway listener, or the public one with
+--public. With --oauth2-proxy, a dedicated oauth2-proxy instance (using the
+k8s/charts/oauth2-proxy-instance library chart) sits in front of the app and
+the HTTPRoute points at it.
+
+application.yaml is written with the namespace and release name that sync and
+diff read from it. The app is added to the tier in config/base.cue, enabled in
+production and declared but disabled in the other app stacks.
+
+Examples:
+  lab k8s new apps/notes --image ghcr.io/example/notes:1.2.3 --port 3000
+  lab k8s new apps/notes --image ghcr.io/example/notes:1.2.3 --public --oauth2-proxy
+  lab k8s new platform/worker --image worker:0.1 --route=false`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			envName, _ := cmd.Flags().GetString("env")
+			image, _ := cmd.Flags().GetString("image")
+			port, _ := cmd.Flags().GetInt("port")
+			description, _ := cmd.Flags().GetString("description")
+			namespace, _ := cmd.Flags().GetString("namespace")
+			releaseName, _ := cmd.Flags().GetString("release-name")
+			route, _ := cmd.Flags().GetBool("route")
+			host, _ := cmd.Flags().GetString("host")
+			public, _ := cmd.Flags().GetBool("public")
+			oauth2Proxy, _ := cmd.Flags().GetBool("oauth2-proxy")
+
+			tier, app, ok := strings.Cut(args[0], "/")
+			switch {
+			case !ok || !slices.Contains(config.Tiers, tier):
+				return fmt.Errorf("expected <tier>/<app> with tier one of %s", strings.Join(config.Tiers, ", "))
+			case !appNamePattern.MatchString(app):
+				return fmt.Errorf("invalid app name %q: use lower-case letters, digits and dashes", app)
+			case oauth2Proxy && !route:
+				return errors.New("--oauth2-proxy needs the HTTPRoute; drop --route=false")
+			}
+
+			ref := kube.ParseImageRef(image)
+			if ref.Tag == "" || ref.Tag == "latest" {
+				return fmt.Errorf("image %s needs a version tag; it becomes the chart's appVersion", image)
+			}
+
+			env, err := config.LoadEnvironment(getConfigDir(), envName)
+			if err != nil {
+				return fmt.Errorf("load environment: %w", err)
+			}
+			repoURL, err := tierRepoURL(tier)
+			if err != nil {
+				return err
+			}
+
+			if description == "" {
+				description = app + " on the homelab cluster."
+			}
+			if host == "" {
+				host = app + "." + newAppDomain
+			}
+
+			files, err := helm.Scaffold("k8s", helm.ScaffoldOptions{
+				Tier:        tier,
+				Name:        app,
+				Description: description,
+				Namespace:   namespace,
+				ReleaseName: releaseName,
+				Repository:  ref.Repository,
+				AppVersion:  ref.Tag,
+				Port:        port,
+				RepoURL:     repoURL,
+				Route:       route,
+				Host:        host,
+				Public:      public,
+				OAuth2Proxy: oauth2Proxy,
+				PodCIDR:     env.Cluster.Networks.PodCIDR,
+			})
+			if err != nil {
+				return err
+			}
+
+			stacks, err := config.AddApp(getConfigDir(), tier, app)
+			if err != nil {
+				// Leave no half-added app behind
+				_ = os.RemoveAll(filepath.Join("k8s", tier, app))
+				return fmt.Errorf("add %s/%s to the CUE config: %w", tier, app, err)
+			}
+
+			result := newAppResult{Tier: tier, App: app, Files: files, Stacks: stacks}
+			if jsonOutput {
+				return printJSON(result)
+			}
+			printNewApp(result, oauth2Proxy)
+			return nil
+		},
+	}
+
+	cmd.Flags().String("image", "", "Container image with a version tag, e.g. ghcr.io/org/app:1.2.3")
+	cmd.Flags().Int("port", 8080, "Port the container listens on")
+	cmd.Flags().String("description", "", "Chart description")
+	cmd.Flags().String("namespace", "", "Namespace to deploy to (default: the app name)")
+	cmd.Flags().String("release-name", "", "Helm release name (default: the app name)")
+	cmd.Flags().Bool("route", true, "Add an HTTPRoute for --host")
+	cmd.Flags().String("host", "", "Hostname to route (default: <app>."+newAppDomain+")")
+	cmd.Flags().Bool("public", false, "Route through the public gateway listener instead of the internal one")
+	cmd.Flags().Bool("oauth2-proxy", false, "Put a dedicated oauth2-proxy instance in front of the app")
+	_ = cmd.MarkFlagRequired("image")
+
+	return cmd
+}
+
+// tierRepoURL returns the git repository the tier's app-of-apps
+// Application syncs from, which new apps sync from too
+func tierRepoURL(tier string) (string, error) {
+	path := filepath.Join("k8s", tier, "application.yaml")
+	data, err := os.ReadFile(path) //nolint:gosec // path is built from a known tier name
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", path, err)
+	}
+	objs, err := kube.ParseManifests(data)
+	if err != nil {
+		return "", fmt.Errorf("parse %s: %w", path, err)
+	}
+	for _, obj := range objs {
+		if repoURL, _, _ := unstructured.NestedString(obj.Object, "spec", "source", "repoURL"); repoURL != "" {
+			return repoURL, nil
+		}
+	}
+	return "", fmt.Errorf("%s has no spec.source.repoURL", path)
+}
+
+// printNewApp lists what was created and what is left to do by hand
+func printNewApp(result newAppResult, oauth2Proxy bool) {
+	fmt.Printf("Created %s/%s:\n", result.Tier, result.App)
+	for _, f := range result.Files {
+		fmt.Printf("  %s\n", f)
+	}
+	fmt.Printf("Added %s/%s to %s in %s\n", result.Tier, result.App, strings.Join(result.Stacks, ", "), filepath.Join(getConfigDir(), config.BaseFile))
+
+	fmt.Println("\nNext steps:")
+	step := 1
+	if oauth2Proxy {
+		fmt.Printf("  %d. Register the %s OIDC client with Authelia (see k8s/charts/oauth2-proxy-instance/README.md)\n", step, result.App)
+		step++
+	}
+	fmt.Printf("  %d. Review values.yaml, then check the chart with 'lab k8s render %s/%s'\n", step, result.Tier, result.App)
+	fmt.Printf("  %d. Regenerate config/gen with 'dagger call export-cue --auto-apply'\n", step+1)
+}
@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/teekennedy/homelab/cmd/lab/internal/helm"
+)
+
+// defaultK8sConcurrency is how many apps diff and sync process at once
+const defaultK8sConcurrency = 4
+
+// Exit codes for `lab k8s diff`, following `kubectl diff`
+const (
+	diffExitChanges = 1
+	diffExitError   = 2
+)
+
+// runAppsParallel calls fn for every chart with at most concurrency calls in
+// flight. Each call writes to its own buffer, which is copied to out in chart
+// order as soon as it and every earlier chart have finished, so output from
+// different apps never interleaves.
+func runAppsParallel[T any](ctx context.Context, out io.Writer, charts []helm.ChartInfo, concurrency int, fn func(context.Context, io.Writer, helm.ChartInfo) T) []T {
+	concurrency = max(1, min(concurrency, len(charts)))
+
+	results := make([]T, len(charts))
+	bufs := make([]bytes.Buffer, len(charts))
+	done := make([]chan struct{}, len(charts))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Go(func() {
+			for i := range work {
+				results[i] = fn(ctx, &bufs[i], charts[i])
+				close(done[i])
+			}
+		})
+	}
+	go func() {
+		for i := range charts {
+			work <- i
+		}
+		close(work)
+	}()
+
+	for i := range charts {
+		<-done[i]
+		_, _ = out.Write(bufs[i].Bytes())
+	}
+	wg.Wait()
+
+	return results
+}
+
+// appOutput returns where per-app progress output goes: stdout normally, or
+// stderr with --json so it doesn't corrupt the JSON document
+func appOutput() io.Writer {
+	if jsonOutput {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// appSummaryRow is one line of the table printed after diffing or syncing
+// several apps
+type appSummaryRow struct {
+	App     string
+	Status  string
+	Changed string
+	Error   string
+}
+
+// printAppSummary prints a table of per-app results
+func printAppSummary(rows []appSummaryRow) {
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "APP\tSTATUS\tCHANGED\tERROR")
+	for _, r := range rows {
+		errMsg, _, _ := strings.Cut(r.Error, "\n")
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.App, r.Status, r.Changed, errMsg)
+	}
+	_ = w.Flush()
+}
+
+// diffSummary returns the summary table rows for diffs
+func diffSummary(diffs []appDiff) []appSummaryRow {
+	rows := make([]appSummaryRow, 0, len(diffs))
+	for _, d := range diffs {
+		row := appSummaryRow{App: d.Tier + "/" + d.App, Changed: "-", Error: d.Error}
+		switch {
+		case d.Error != "":
+			row.Status = "error"
+		case d.changedCount() > 0:
+			row.Status = "changed"
+			row.Changed = strconv.Itoa(d.changedCount())
+		default:
+			row.Status = "unchanged"
+			row.Changed = "0"
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// diffExitCode returns the exit code for a diff: 0 when nothing would change,
+// diffExitChanges when something would, and diffExitError if any app failed
+func diffExitCode(diffs []appDiff) int {
+	code := 0
+	for _, d := range diffs {
+		if d.Error != "" {
+			return diffExitError
+		}
+		if d.changedCount() > 0 {
+			code = diffExitChanges
+		}
+	}
+	return code
+}
+
+// appSync is the result of syncing one app
+type appSync struct {
+	Tier  string `json:"tier"`
+	App   string `json:"app"`
+	Error string `json:"error,omitempty"`
+}
+
+// syncSummary returns the summary table rows for syncs
+func syncSummary(syncs []appSync) []appSummaryRow {
+	rows := make([]appSummaryRow, 0, len(syncs))
+	for _, s := range syncs {
+		row := appSummaryRow{App: s.Tier + "/" + s.App, Status: "synced", Changed: "-", Error: s.Error}
+		if s.Error != "" {
+			row.Status = "failed"
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// failedSyncs returns how many apps failed to sync
+func failedSyncs(syncs []appSync) int {
+	n := 0
+	for _, s := range syncs {
+		if s.Error != "" {
+			n++
+		}
+	}
+	return n
+}
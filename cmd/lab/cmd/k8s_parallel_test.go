@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/teekennedy/homelab/cmd/lab/internal/helm"
+	"github.com/teekennedy/homelab/cmd/lab/internal/kube"
+)
+
+// testCharts returns n charts named app0, app1, ...
+func testCharts(n int) []helm.ChartInfo {
+	charts := make([]helm.ChartInfo, n)
+	for i := range charts {
+		charts[i] = helm.ChartInfo{Tier: "apps", Name: fmt.Sprintf("app%d", i)}
+	}
+	return charts
+}
+
+func TestRunAppsParallelOutputOrder(t *testing.T) {
+	charts := testCharts(4)
+
+	// The first chart only finishes once the last one has, so output has to
+	// be held back and reordered rather than copied as each app finishes
+	lastDone := make(chan struct{})
+	var out bytes.Buffer
+	results := runAppsParallel(t.Context(), &out, charts, len(charts), func(ctx context.Context, w io.Writer, chart helm.ChartInfo) string {
+		if chart.Name == "app0" {
+			<-lastDone
+		}
+		for line := range 3 {
+			_, _ = fmt.Fprintf(w, "%s line %d\n", chart.Name, line)
+			time.Sleep(time.Millisecond)
+		}
+		if chart.Name == "app3" {
+			close(lastDone)
+		}
+		return chart.Name
+	})
+
+	assert.Equal(t, []string{"app0", "app1", "app2", "app3"}, results)
+
+	var want strings.Builder
+	for _, chart := range charts {
+		for line := range 3 {
+			fmt.Fprintf(&want, "%s line %d\n", chart.Name, line)
+		}
+	}
+	assert.Equal(t, want.String(), out.String())
+}
+
+func TestRunAppsParallelConcurrency(t *testing.T) {
+	tests := []struct {
+		name        string
+		charts      int
+		concurrency int
+		wantMax     int32
+	}{
+		{"limited", 8, 3, 3},
+		{"more workers than charts", 2, 8, 2},
+		{"zero means one", 3, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inFlight, peak atomic.Int32
+			results := runAppsParallel(t.Context(), io.Discard, testCharts(tt.charts), tt.concurrency, func(ctx context.Context, w io.Writer, chart helm.ChartInfo) bool {
+				n := inFlight.Add(1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				inFlight.Add(-1)
+				return true
+			})
+
+			assert.Len(t, results, tt.charts)
+			assert.LessOrEqual(t, peak.Load(), tt.wantMax)
+		})
+	}
+}
+
+func TestRunAppsParallelNoCharts(t *testing.T) {
+	var out bytes.Buffer
+	results := runAppsParallel(t.Context(), &out, nil, 4, func(ctx context.Context, w io.Writer, chart helm.ChartInfo) int {
+		t.Fatal("fn called without charts")
+		return 0
+	})
+	assert.Empty(t, results)
+	assert.Empty(t, out.String())
+}
+
+func TestDiffExitCode(t *testing.T) {
+	unchanged := appDiff{App: "a", Resources: []kube.ResourceDiff{{Change: kube.ChangeUnchanged}}}
+	changed := appDiff{App: "b", Resources: []kube.ResourceDiff{{Change: kube.ChangeUnchanged}, {Change: kube.ChangeAdded}}}
+	failed := appDiff{App: "c", Error: "render failed"}
+
+	tests := []struct {
+		name  string
+		diffs []appDiff
+		want  int
+	}{
+		{"no apps", nil, 0},
+		{"nothing changes", []appDiff{unchanged, {App: "empty"}}, 0},
+		{"something changes", []appDiff{unchanged, changed}, diffExitChanges},
+		{"pruned only", []appDiff{{Resources: []kube.ResourceDiff{{Change: kube.ChangePruned}}}}, diffExitChanges},
+		{"error", []appDiff{unchanged, failed}, diffExitError},
+		{"error before changes", []appDiff{failed, changed}, diffExitError},
+		{"error after changes", []appDiff{changed, failed}, diffExitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, diffExitCode(tt.diffs))
+		})
+	}
+}
+
+func TestFailedSyncs(t *testing.T) {
+	tests := []struct {
+		name  string
+		syncs []appSync
+		want  int
+	}{
+		{"no apps", nil, 0},
+		{"all synced", []appSync{{App: "a"}, {App: "b"}}, 0},
+		{"some failed", []appSync{{App: "a", Error: "timeout"}, {App: "b"}, {App: "c", Error: "helm failed"}}, 2},
+		{"all failed", []appSync{{App: "a", Error: "timeout"}}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, failedSyncs(tt.syncs))
+		})
+	}
+}
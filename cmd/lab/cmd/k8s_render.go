@@ -0,0 +1,315 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/teekennedy/homelab/cmd/lab/config"
+	"github.com/teekennedy/homelab/cmd/lab/internal/helm"
+	"github.com/teekennedy/homelab/cmd/lab/internal/kube"
+)
+
+// defaultRenderDir is where `lab k8s render` writes hydrated manifests
+const defaultRenderDir = "rendered"
+
+// appRender is the result of rendering one app into the output directory
+type appRender struct {
+	Tier    string            `json:"tier"`
+	App     string            `json:"app"`
+	Changes []kube.FileChange `json:"changes"`
+	Error   string            `json:"error,omitempty"`
+}
+
+func newK8sRenderCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "render [app]",
+		Short: "Render manifests into a directory",
+		Long: `Hydrate Kubernetes manifests into a directory for review.
+
+Every chart enabled for --env in the CUE config is rendered with helm template,
+using the release name and namespace from its application.yaml and the cluster
+values generated from the CUE config for --env. CRDs are included. Each object
+is written to its own file:
+
+  <output>/<env>/<tier>/<app>/<kind>-<name>.yaml
+
+Keys are sorted and server-maintained fields are dropped, so committed output
+only changes when the manifests do. Files for objects that are no longer
+rendered are removed, as are directories of apps that are no longer enabled.
+
+With --check nothing is written; the command lists every file that is out of
+date and fails if there are any, which makes it suitable for CI.
+
+The cluster is never contacted, so no kubeconfig is needed.
+
+Examples:
+  lab k8s render                         # Render all tiers for production
+  lab k8s render --env staging platform  # Render the platform tier for staging
+  lab k8s render forgejo                 # Render a single app
+  lab k8s render --check                 # Fail if rendered/ is stale`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			envName, _ := cmd.Flags().GetString("env")
+			outputDir, _ := cmd.Flags().GetString("output")
+			check, _ := cmd.Flags().GetBool("check")
+			concurrency, _ := cmd.Flags().GetInt("concurrency")
+
+			target := ""
+			if len(args) > 0 {
+				target = args[0]
+			}
+
+			env, err := config.LoadEnvironment(getConfigDir(), envName)
+			if err != nil {
+				return fmt.Errorf("load environment: %w", err)
+			}
+
+			renders, err := runRender(cmd.Context(), env, target, filepath.Join(outputDir, envName), check, concurrency)
+			if err != nil {
+				return err
+			}
+
+			if jsonOutput {
+				if err := printJSON(renders); err != nil {
+					return err
+				}
+			} else if len(renders) > 1 {
+				printAppSummary(renderSummary(renders, check))
+			}
+
+			failed, changed := 0, 0
+			for _, r := range renders {
+				if r.Error != "" {
+					failed++
+				}
+				changed += len(r.Changes)
+			}
+			switch {
+			case failed > 0:
+				return fmt.Errorf("%d of %d apps failed to render", failed, len(renders))
+			case check && changed > 0:
+				return fmt.Errorf("%d rendered files are out of date; run 'lab k8s render --env %s'", changed, envName)
+			}
+			if !jsonOutput {
+				if check {
+					fmt.Printf("\nRendered manifests in %s are up to date\n", outputDir)
+				} else {
+					fmt.Printf("\nUpdated %d files in %s\n", changed, outputDir)
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("output", "o", defaultRenderDir, "Directory to render manifests into")
+	cmd.Flags().Bool("check", false, "Fail if the rendered output is out of date instead of writing it")
+	cmd.Flags().Int("concurrency", defaultK8sConcurrency, "Number of apps to render in parallel")
+
+	return cmd
+}
+
+// runRender renders the apps target selects for env into outDir, one
+// directory per tier and app. When a whole tier is rendered, directories of
+// apps that are no longer enabled are removed too. With check, outDir is only
+// compared, not written.
+func runRender(ctx context.Context, env *config.Environment, target, outDir string, check bool, concurrency int) ([]appRender, error) {
+	charts, err := chartsForTarget(env, target)
+	if err != nil {
+		return nil, err
+	}
+
+	valuesFile, cleanup, err := writeClusterValues(getConfigDir(), env.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	renders := runAppsParallel(ctx, appOutput(), charts, concurrency, func(ctx context.Context, w io.Writer, chart helm.ChartInfo) appRender {
+		r := appRender{Tier: chart.Tier, App: chart.Name, Changes: []kube.FileChange{}}
+		if !jsonOutput {
+			_, _ = fmt.Fprintf(w, "\n--- %s/%s ---\n", chart.Tier, chart.Name)
+		}
+
+		files, err := renderAppFiles(ctx, w, filepath.Join("k8s", chart.Tier, chart.Name), valuesFile)
+		if err == nil {
+			r.Changes, err = kube.SyncFiles(filepath.Join(outDir, chart.Tier, chart.Name), files, check)
+		}
+		if err != nil {
+			if !jsonOutput {
+				_, _ = fmt.Fprintf(w, "Error: %v\n", err)
+			}
+			r.Error = err.Error()
+			return r
+		}
+
+		if !jsonOutput {
+			printFileChanges(w, r.Changes, check)
+		}
+		return r
+	})
+
+	if tier, app := parseK8sTarget(target); app == "" {
+		tiers := config.Tiers
+		if tier != "" {
+			tiers = []string{tier}
+		}
+		removed, err := pruneRenderedApps(outDir, tiers, charts, check)
+		if err != nil {
+			return nil, err
+		}
+		renders = append(renders, removed...)
+	}
+
+	return renders, nil
+}
+
+// renderAppFiles renders the chart in chartDir with valuesFile and lays the
+// result out as one normalized file per object
+func renderAppFiles(ctx context.Context, w io.Writer, chartDir, valuesFile string) (map[string][]byte, error) {
+	objs, err := renderAppObjects(ctx, w, chartDir, valuesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := kube.RenderFiles(objs)
+	if err != nil {
+		return nil, fmt.Errorf("lay out rendered manifests: %w", err)
+	}
+	return files, nil
+}
+
+// renderAppObjects renders the chart in chartDir, CRDs included, with the
+// release name and namespace from its application.yaml and valuesFile layered
+// over its own values
+func renderAppObjects(ctx context.Context, w io.Writer, chartDir, valuesFile string) ([]*unstructured.Unstructured, error) {
+	info, err := helm.ParseChartInfo(chartDir)
+	if err != nil {
+		return nil, fmt.Errorf("parse chart info: %w", err)
+	}
+
+	if err := buildChartDependenciesIfNeeded(ctx, w, info.Tier, info.Name, chartDir); err != nil {
+		return nil, err
+	}
+
+	manifests, err := helmTemplate(ctx, w, info, valuesFile, "--include-crds")
+	if err != nil {
+		return nil, err
+	}
+
+	objs, err := kube.ParseManifests(manifests)
+	if err != nil {
+		return nil, fmt.Errorf("parse rendered manifests: %w", err)
+	}
+	return objs, nil
+}
+
+// writeClusterValues exports the helm cluster values for envName from the
+// CUE config in configDir to a temporary file, so rendering doesn't depend on
+// which environment `lab k8s generate` last ran for. The returned cleanup
+// removes the file.
+func writeClusterValues(configDir, envName string) (string, func(), error) {
+	values, err := config.ExportEnvironment(configDir, envName, "helm")
+	if err != nil {
+		return "", nil, fmt.Errorf("export helm values: %w", err)
+	}
+
+	f, err := os.CreateTemp("", "lab-cluster-values-*.yaml")
+	if err != nil {
+		return "", nil, fmt.Errorf("create cluster values file: %w", err)
+	}
+	cleanup := func() { _ = os.Remove(f.Name()) }
+
+	_, err = f.WriteString(values)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("write cluster values file: %w", err)
+	}
+	return f.Name(), cleanup, nil
+}
+
+// pruneRenderedApps removes the output directories under outDir/<tier> of
+// apps that weren't rendered, e.g. because they were disabled or deleted
+func pruneRenderedApps(outDir string, tiers []string, charts []helm.ChartInfo, check bool) ([]appRender, error) {
+	var removed []appRender
+	for _, tier := range tiers {
+		entries, err := os.ReadDir(filepath.Join(outDir, tier))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read rendered %s apps: %w", tier, err)
+		}
+
+		for _, entry := range entries {
+			if !entry.IsDir() || slices.ContainsFunc(charts, func(c helm.ChartInfo) bool {
+				return c.Tier == tier && c.Name == entry.Name()
+			}) {
+				continue
+			}
+
+			changes, err := kube.SyncFiles(filepath.Join(outDir, tier, entry.Name()), nil, check)
+			if err != nil {
+				return nil, err
+			}
+			if len(changes) == 0 {
+				continue
+			}
+			if !jsonOutput {
+				fmt.Printf("\n--- %s/%s (no longer enabled) ---\n", tier, entry.Name())
+				printFileChanges(os.Stdout, changes, check)
+			}
+			removed = append(removed, appRender{Tier: tier, App: entry.Name(), Changes: changes})
+		}
+	}
+	return removed, nil
+}
+
+// printFileChanges lists the files rendering changed, or would change with check
+func printFileChanges(w io.Writer, changes []kube.FileChange, check bool) {
+	if len(changes) == 0 {
+		_, _ = fmt.Fprintln(w, "  (up to date)")
+		return
+	}
+	for _, c := range changes {
+		if check {
+			_, _ = fmt.Fprintf(w, "  %s: would be %s\n", c.Path, c.Change)
+		} else {
+			_, _ = fmt.Fprintf(w, "  %s: %s\n", c.Path, c.Change)
+		}
+	}
+}
+
+// renderSummary returns the summary table rows for renders
+func renderSummary(renders []appRender, check bool) []appSummaryRow {
+	rows := make([]appSummaryRow, 0, len(renders))
+	for _, r := range renders {
+		row := appSummaryRow{App: r.Tier + "/" + r.App, Changed: strconv.Itoa(len(r.Changes)), Error: r.Error}
+		switch {
+		case r.Error != "":
+			row.Status = "error"
+			row.Changed = "-"
+		case len(r.Changes) == 0:
+			row.Status = "up to date"
+		case check:
+			row.Status = "stale"
+		default:
+			row.Status = "updated"
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
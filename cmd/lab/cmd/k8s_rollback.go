@@ -0,0 +1,283 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	labenv "github.com/teekennedy/homelab/cmd/lab/env"
+	"github.com/teekennedy/homelab/cmd/lab/internal/helm"
+	"github.com/teekennedy/homelab/cmd/lab/internal/kube"
+	"github.com/teekennedy/homelab/cmd/lab/kubeconfig"
+)
+
+// releaseRevision is one entry of `helm history -o json`
+type releaseRevision struct {
+	Revision    int    `json:"revision"`
+	Updated     string `json:"updated"`
+	Status      string `json:"status"`
+	Chart       string `json:"chart"`
+	AppVersion  string `json:"app_version"`
+	Description string `json:"description"`
+}
+
+func newK8sHistoryCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history <app>",
+		Short: "Show an app's Helm release history",
+		Long: `Show the Helm release history of an app, newest revision last.
+
+The release name and namespace are read from the app's application.yaml, the
+same way sync resolves them. Use a revision number with 'lab k8s rollback'.
+
+Examples:
+  lab k8s history forgejo
+  lab k8s history platform/forgejo --max 5`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			envName, _ := cmd.Flags().GetString("env")
+			maxRevisions, _ := cmd.Flags().GetInt("max")
+
+			info, err := resolveRelease(args[0])
+			if err != nil {
+				return err
+			}
+
+			kc, err := setupKubeconfig(cmd.Context(), envName)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = kc.Close() }()
+
+			history, err := releaseHistory(cmd.Context(), kc, info, maxRevisions)
+			if err != nil {
+				return err
+			}
+
+			if jsonOutput {
+				return printJSON(history)
+			}
+
+			fmt.Printf("Release %s in namespace %s:\n\n", info.ReleaseName, info.Namespace)
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			_, _ = fmt.Fprintln(w, "REVISION\tUPDATED\tSTATUS\tCHART\tAPP VERSION\tDESCRIPTION")
+			for _, r := range history {
+				_, _ = fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", r.Revision, formatHelmTime(r.Updated), r.Status, r.Chart, r.AppVersion, r.Description)
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().Int("max", 10, "Maximum number of revisions to show")
+
+	return cmd
+}
+
+func newK8sRollbackCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rollback <app> [revision]",
+		Short: "Roll an app back to an earlier Helm release",
+		Long: `Roll an app's Helm release back to an earlier revision.
+
+Without a revision, the release is rolled back to the one before the current
+revision. Use 'lab k8s history' to list revisions. The rollback waits up to
+--timeout for the release's resources to become ready.
+
+If ArgoCD manages the app with automated sync, it will re-sync the app from git
+and undo the rollback. By default this is only a warning; with
+--suspend-auto-sync, automated sync is switched off for the app's Application
+first and stays off until the next 'lab k8s sync <app> --argocd'. If the
+rollback fails, automated sync is switched back on right away. If a parent
+app-of-apps self-heals the Application, it may switch automated sync back on.
+
+Examples:
+  lab k8s rollback forgejo                      # Roll back one revision
+  lab k8s rollback forgejo 3                    # Roll back to revision 3
+  lab k8s rollback forgejo --suspend-auto-sync  # Keep ArgoCD from undoing it`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			cmd.SilenceUsage = true
+			envName, _ := cmd.Flags().GetString("env")
+			suspend, _ := cmd.Flags().GetBool("suspend-auto-sync")
+			timeout, _ := cmd.Flags().GetDuration("timeout")
+
+			revision := ""
+			if len(args) > 1 {
+				if _, convErr := strconv.Atoi(args[1]); convErr != nil {
+					return fmt.Errorf("invalid revision %q: must be a number", args[1])
+				}
+				revision = args[1]
+			}
+			defer func() { getEnvManager().Record(envName, labenv.ActionRollback, rollbackDetail(args[0], revision), err) }()
+
+			info, err := resolveRelease(args[0])
+			if err != nil {
+				return err
+			}
+
+			kc, err := setupKubeconfig(cmd.Context(), envName)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = kc.Close() }()
+
+			suspended, err := guardAutoSync(cmd.Context(), kc, info.Name, suspend)
+			if err != nil {
+				return err
+			}
+
+			if err := rollbackRelease(cmd.Context(), kc, info, revision, timeout); err != nil {
+				if suspended != nil {
+					resumeAutoSync(cmd.Context(), suspended, info.Name)
+				}
+				return err
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().Bool("suspend-auto-sync", false, "Switch off ArgoCD automated sync for the app so it doesn't undo the rollback")
+	cmd.Flags().Duration("timeout", 5*time.Minute, "How long to wait for the rolled back resources to become ready")
+
+	return cmd
+}
+
+// resolveRelease finds the chart for target (app or tier/app) and reads its
+// release name and namespace
+func resolveRelease(target string) (helm.ChartInfo, error) {
+	tier, app := parseK8sTarget(target)
+	if tier == "" || app == "" {
+		return helm.ChartInfo{}, fmt.Errorf("app %s not found under k8s/<tier>", target)
+	}
+
+	info, err := helm.ParseChartInfo(filepath.Join("k8s", tier, app))
+	if err != nil {
+		return helm.ChartInfo{}, fmt.Errorf("parse chart info: %w", err)
+	}
+	return info, nil
+}
+
+// releaseHistory returns up to maxRevisions of the newest revisions of the
+// app's release, oldest first
+func releaseHistory(ctx context.Context, kc *kubeconfig.Handle, info helm.ChartInfo, maxRevisions int) ([]releaseRevision, error) {
+	helmCmd := kc.Command(ctx, "helm", "history", info.ReleaseName,
+		"--namespace", info.Namespace,
+		"--max", strconv.Itoa(maxRevisions),
+		"--output", "json")
+	helmCmd.Stderr = os.Stderr
+	out, err := helmCmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("helm history: %w", err)
+	}
+
+	var history []releaseRevision
+	if err := json.Unmarshal(out, &history); err != nil {
+		return nil, fmt.Errorf("parse helm history: %w", err)
+	}
+	return history, nil
+}
+
+// guardAutoSync warns if ArgoCD would undo a manual change to app, or with
+// suspend switches automated sync off for it. If it did, the returned AutoSync
+// can switch it back on.
+func guardAutoSync(ctx context.Context, kc *kubeconfig.Handle, app string, suspend bool) (*kube.AutoSync, error) {
+	restConfig, err := restConfigFor(kc)
+	if err != nil {
+		return nil, err
+	}
+	autoSync, err := kube.NewAutoSync(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("create ArgoCD client: %w", err)
+	}
+
+	state, err := autoSync.State(ctx, app)
+	if err != nil {
+		return nil, fmt.Errorf("check ArgoCD auto-sync: %w", err)
+	}
+
+	switch {
+	case !state.Automated:
+		return nil, nil
+	case !suspend:
+		if !jsonOutput {
+			fmt.Printf("Warning: ArgoCD auto-sync is enabled for %s and will undo the rollback; use --suspend-auto-sync to switch it off\n", app)
+		}
+		return nil, nil
+	}
+
+	if err := autoSync.Suspend(ctx, app); err != nil {
+		return nil, fmt.Errorf("suspend ArgoCD auto-sync: %w", err)
+	}
+	if !jsonOutput {
+		fmt.Printf("Suspended ArgoCD auto-sync for %s; 'lab k8s sync %s --argocd' switches it back on\n", app, app)
+	}
+	return autoSync, nil
+}
+
+// resumeAutoSync switches automated sync for app back on after a failed
+// rollback. It runs even if ctx was cancelled, e.g. by Ctrl-C, since the
+// rollback didn't happen and ArgoCD should keep managing the app.
+func resumeAutoSync(ctx context.Context, autoSync *kube.AutoSync, app string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+
+	if _, err := autoSync.Resume(ctx, app); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: rollback failed and ArgoCD auto-sync for %s could not be restored: %v; run 'lab k8s sync %s --argocd'\n", app, err, app)
+		return
+	}
+	if !jsonOutput {
+		fmt.Printf("Rollback failed; restored ArgoCD auto-sync for %s\n", app)
+	}
+}
+
+// rollbackRelease rolls the app's release back to revision, or to the
+// previous revision if revision is empty
+func rollbackRelease(ctx context.Context, kc *kubeconfig.Handle, info helm.ChartInfo, revision string, timeout time.Duration) error {
+	rollbackArgs := []string{"rollback", info.ReleaseName}
+	if revision != "" {
+		rollbackArgs = append(rollbackArgs, revision)
+	}
+	rollbackArgs = append(rollbackArgs,
+		"--namespace", info.Namespace,
+		"--wait",
+		"--timeout", timeout.String())
+
+	if !jsonOutput {
+		fmt.Printf("Rolling back %s/%s...\n", info.Tier, info.Name)
+	}
+
+	helmCmd := kc.Command(ctx, "helm", rollbackArgs...)
+	helmCmd.Stdout = appOutput()
+	helmCmd.Stderr = os.Stderr
+	if err := helmCmd.Run(); err != nil {
+		return fmt.Errorf("helm rollback: %w", err)
+	}
+	return nil
+}
+
+// rollbackDetail describes a rollback for the environment history
+func rollbackDetail(target, revision string) string {
+	if revision == "" {
+		return target
+	}
+	return target + "@" + revision
+}
+
+// formatHelmTime shortens the timestamps helm history prints, leaving
+// anything it can't parse as is
+func formatHelmTime(s string) string {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999 -0700 MST"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Local().Format("2006-01-02 15:04")
+		}
+	}
+	return s
+}
@@ -2,10 +2,13 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 
 	"github.com/spf13/cobra"
 	"github.com/teekennedy/homelab/cmd/lab/internal/paths"
@@ -28,6 +31,9 @@ It provides commands for:
   - Kubernetes operations (bootstrap, diff, sync)
   - Terraform operations (plan, apply)
   - Configuration management (show, validate, export)`,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			expireKubeconfigCache()
+		},
 	}
 
 	cmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
@@ -42,8 +48,34 @@ It provides commands for:
 	return cmd
 }
 
+// ExitError is returned by commands that need lab to exit with a specific code,
+// such as `lab env exec` passing through the exit status of its child process.
+type ExitError struct {
+	Code int
+	// Err, if set, is the failure reported to the user
+	Err error
+}
+
+func (e *ExitError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// Execute runs the lab command line. An interrupt or SIGTERM cancels the
+// command's context instead of killing the process, so deferred cleanup such
+// as removing decrypted kubeconfigs still runs; a second signal kills it.
 func Execute() error {
-	if err := newRootCmd().Execute(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+
+	if err := newRootCmd().ExecuteContext(ctx); err != nil {
 		return fmt.Errorf("executing command: %w", err)
 	}
 	return nil
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/format"
+	"cuelang.org/go/cue/parser"
+	"cuelang.org/go/cue/token"
+)
+
+// BaseFile is the CUE file holding the app stacks environments build on
+const BaseFile = "base.cue"
+
+// productionApps is the app stack the production environment uses. Other
+// stacks list every known release too, so new apps start disabled there.
+const productionApps = "_productionApps"
+
+// AddApp declares app in tier of every app stack (_<name>Apps) in
+// configDir/base.cue, enabled in the production stack and disabled in the
+// others, keeping each tier sorted. It returns the stacks it changed and
+// fails without writing anything if any stack already declares app.
+func AddApp(configDir, tier, app string) ([]string, error) {
+	path := filepath.Join(configDir, BaseFile)
+	src, err := os.ReadFile(path) //nolint:gosec // path is the repo's config directory
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", BaseFile, err)
+	}
+	file, err := parser.ParseFile(path, src, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", BaseFile, err)
+	}
+
+	var changed []string
+	for _, decl := range file.Decls {
+		stack, ok := decl.(*ast.Field)
+		if !ok {
+			continue
+		}
+		name, _, _ := ast.LabelName(stack.Label)
+		if !strings.HasPrefix(name, "_") || !strings.HasSuffix(name, "Apps") {
+			continue
+		}
+
+		tierStruct := structField(structField(stack.Value, "apps"), tier)
+		if tierStruct == nil {
+			continue
+		}
+		if hasField(tierStruct, app) {
+			return nil, fmt.Errorf("%s already declares %s/%s", name, tier, app)
+		}
+		insertSorted(tierStruct, app, name == productionApps)
+		changed = append(changed, name)
+	}
+	if len(changed) == 0 {
+		return nil, fmt.Errorf("no app stack in %s has a %s tier", BaseFile, tier)
+	}
+
+	out, err := format.Node(file)
+	if err != nil {
+		return nil, fmt.Errorf("format %s: %w", BaseFile, err)
+	}
+	if err := os.WriteFile(path, out, 0o600); err != nil {
+		return nil, fmt.Errorf("write %s: %w", BaseFile, err)
+	}
+	return changed, nil
+}
+
+// structField returns the struct value of the field label in v, or nil if v
+// isn't a struct or has no such struct field
+func structField(v ast.Expr, label string) *ast.StructLit {
+	s, ok := v.(*ast.StructLit)
+	if !ok {
+		return nil
+	}
+	if field := findField(s, label); field != nil {
+		value, _ := field.Value.(*ast.StructLit)
+		return value
+	}
+	return nil
+}
+
+// hasField reports whether s has a field label
+func hasField(s *ast.StructLit, label string) bool {
+	return findField(s, label) != nil
+}
+
+// findField returns the field label in s, or nil
+func findField(s *ast.StructLit, label string) *ast.Field {
+	for _, elt := range s.Elts {
+		field, ok := elt.(*ast.Field)
+		if !ok {
+			continue
+		}
+		if name, _, _ := ast.LabelName(field.Label); name == label {
+			return field
+		}
+	}
+	return nil
+}
+
+// insertSorted adds `"app": enabled` to s before the first field that sorts
+// after it
+func insertSorted(s *ast.StructLit, app string, enabled bool) {
+	field := &ast.Field{Label: ast.NewString(app), Value: ast.NewBool(enabled)}
+	ast.SetRelPos(field, token.Newline)
+
+	i := slices.IndexFunc(s.Elts, func(elt ast.Decl) bool {
+		f, ok := elt.(*ast.Field)
+		if !ok {
+			return false
+		}
+		name, _, _ := ast.LabelName(f.Label)
+		return name > app
+	})
+	if i < 0 {
+		i = len(s.Elts)
+	}
+	s.Elts = slices.Insert(s.Elts, i, ast.Decl(field))
+}
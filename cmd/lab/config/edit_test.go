@@ -0,0 +1,207 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testBaseCue = `package config
+
+_clusterDefaults: {
+	// Objects controllers create that lab can't recognise itself
+	drift: ignore: [
+		{kind: "*.k3s.cattle.io"},
+		{kind: "Secret", namespace: "kube-system", name: "k3s-serving"},
+	]
+}
+
+// _productionApps is the full application stack for production
+_productionApps: {
+	apps: {
+		foundation: {
+			"cert-system": true
+			"metallb":     true
+		}
+		apps: {
+			"forgejo": true // the git forge
+			"paperless": true
+		}
+	}
+}
+
+// _stagingApps is a minimal stack for testing
+_stagingApps: {
+	apps: {
+		foundation: {
+			"cert-system": true
+			"metallb":     true
+		}
+		apps: {
+			"forgejo":   false
+			"paperless": false
+		}
+	}
+}
+`
+
+// writeBaseCue writes testBaseCue to a new config dir and returns the dir
+func writeBaseCue(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, BaseFile), []byte(testBaseCue), 0o600))
+	return dir
+}
+
+// declaredApps returns the apps of tier in stack in file order, mapped to
+// whether they are enabled
+func declaredApps(t *testing.T, src []byte, stack, tier string) ([]string, map[string]bool) {
+	t.Helper()
+	file, err := parser.ParseFile(BaseFile, src)
+	require.NoError(t, err)
+
+	for _, decl := range file.Decls {
+		field, ok := decl.(*ast.Field)
+		if !ok {
+			continue
+		}
+		if name, _, _ := ast.LabelName(field.Label); name != stack {
+			continue
+		}
+		tierStruct := structField(structField(field.Value, "apps"), tier)
+		require.NotNil(t, tierStruct, "%s has no %s tier", stack, tier)
+
+		var order []string
+		enabled := map[string]bool{}
+		for _, elt := range tierStruct.Elts {
+			app := elt.(*ast.Field)
+			name, _, _ := ast.LabelName(app.Label)
+			order = append(order, name)
+			enabled[name] = app.Value.(*ast.BasicLit).Value == "true"
+		}
+		return order, enabled
+	}
+	t.Fatalf("no stack %s", stack)
+	return nil, nil
+}
+
+func TestAddApp(t *testing.T) {
+	tests := []struct {
+		name      string
+		tier      string
+		app       string
+		wantStack []string
+		wantOrder []string
+	}{
+		{
+			name:      "first",
+			tier:      "apps",
+			app:       "actual",
+			wantStack: []string{"_productionApps", "_stagingApps"},
+			wantOrder: []string{"actual", "forgejo", "paperless"},
+		},
+		{
+			name:      "middle",
+			tier:      "apps",
+			app:       "immich",
+			wantStack: []string{"_productionApps", "_stagingApps"},
+			wantOrder: []string{"forgejo", "immich", "paperless"},
+		},
+		{
+			name:      "last",
+			tier:      "foundation",
+			app:       "traefik",
+			wantStack: []string{"_productionApps", "_stagingApps"},
+			wantOrder: []string{"cert-system", "metallb", "traefik"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeBaseCue(t)
+
+			stacks, err := AddApp(dir, tt.tier, tt.app)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantStack, stacks)
+
+			src, err := os.ReadFile(filepath.Join(dir, BaseFile))
+			require.NoError(t, err)
+			for _, stack := range tt.wantStack {
+				order, enabled := declaredApps(t, src, stack, tt.tier)
+				assert.Equal(t, tt.wantOrder, order, stack)
+				// Only production enables new apps
+				assert.Equal(t, stack == productionApps, enabled[tt.app], stack)
+			}
+		})
+	}
+}
+
+func TestAddAppKeepsRestOfFile(t *testing.T) {
+	dir := writeBaseCue(t)
+
+	_, err := AddApp(dir, "apps", "immich")
+	require.NoError(t, err)
+
+	src, err := os.ReadFile(filepath.Join(dir, BaseFile))
+	require.NoError(t, err)
+	out := string(src)
+	for _, want := range []string{
+		"// Objects controllers create that lab can't recognise itself",
+		`{kind: "*.k3s.cattle.io"},`,
+		`{kind: "Secret", namespace: "kube-system", name: "k3s-serving"},`,
+		"// _productionApps is the full application stack for production",
+		"// _stagingApps is a minimal stack for testing",
+		"// the git forge",
+	} {
+		assert.Contains(t, out, want)
+	}
+
+	// Existing entries keep their values
+	_, enabled := declaredApps(t, src, "_stagingApps", "apps")
+	assert.Equal(t, map[string]bool{"forgejo": false, "immich": false, "paperless": false}, enabled)
+}
+
+func TestAddAppErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		tier    string
+		app     string
+		wantErr string
+	}{
+		{
+			name:    "duplicate",
+			tier:    "apps",
+			app:     "forgejo",
+			wantErr: "_productionApps already declares apps/forgejo",
+		},
+		{
+			name:    "unknown tier",
+			tier:    "extras",
+			app:     "demo",
+			wantErr: "no app stack in base.cue has a extras tier",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeBaseCue(t)
+
+			stacks, err := AddApp(dir, tt.tier, tt.app)
+			require.EqualError(t, err, tt.wantErr)
+			assert.Nil(t, stacks)
+
+			src, err := os.ReadFile(filepath.Join(dir, BaseFile))
+			require.NoError(t, err)
+			assert.Equal(t, testBaseCue, string(src), "expected base.cue to be unchanged")
+		})
+	}
+}
+
+func TestAddAppMissingFile(t *testing.T) {
+	_, err := AddApp(t.TempDir(), "apps", "demo")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
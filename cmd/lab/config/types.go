@@ -1,5 +1,12 @@
 package config
 
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+)
+
 // Environment represents a complete environment configuration
 type Environment struct {
 	Name     string  `json:"name"`
@@ -7,6 +14,7 @@ type Environment struct {
 	Cluster  Cluster `json:"cluster"`
 	Hosts    []Host  `json:"hosts"`
 	Apps     Apps    `json:"apps"`
+	Drift    Drift   `json:"drift"`
 }
 
 // Cluster represents cluster-wide settings
@@ -38,9 +46,142 @@ type K3sHost struct {
 	ServerAddr  string `json:"serverAddr,omitempty"`
 }
 
+// Drift configures `lab k8s drift`
+type Drift struct {
+	Ignore []DriftIgnore `json:"ignore,omitempty"`
+}
+
+// DriftIgnore matches live objects drift detection should not report. Each
+// field is a path.Match glob and empty fields match anything. Kind matches
+// either the bare kind or kind.group, e.g. "Secret" or "*.longhorn.io".
+type DriftIgnore struct {
+	Kind      string `json:"kind,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+}
+
+// Matches reports whether the object of kind in API group, namespace and
+// name matches the rule
+func (d DriftIgnore) Matches(kind, group, namespace, name string) bool {
+	kindMatches := globMatch(d.Kind, kind)
+	if group != "" {
+		kindMatches = kindMatches || globMatch(d.Kind, kind+"."+group)
+	}
+	return kindMatches && globMatch(d.Namespace, namespace) && globMatch(d.Name, name)
+}
+
+// globMatch reports whether s matches pattern, treating an empty pattern as
+// matching anything and a malformed one as matching nothing
+func globMatch(pattern, s string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, s)
+	return ok
+}
+
+// Tiers lists the app tiers in deployment order
+var Tiers = []string{"foundation", "platform", "apps"}
+
 // Apps represents the application deployment configuration
 type Apps struct {
-	Foundation []string `json:"foundation"`
-	Platform   []string `json:"platform"`
-	Apps       []string `json:"apps"`
+	Foundation AppList `json:"foundation"`
+	Platform   AppList `json:"platform"`
+	Apps       AppList `json:"apps"`
+
+	// Disabled lists, per tier, the releases the CUE config declares but
+	// turns off for this environment
+	Disabled map[string]AppList `json:"-"`
+}
+
+// UnmarshalJSON decodes each tier with AppList, additionally recording the
+// releases that are declared but disabled
+func (a *Apps) UnmarshalJSON(data []byte) error {
+	var tiers map[string]json.RawMessage
+	if err := json.Unmarshal(data, &tiers); err != nil {
+		return fmt.Errorf("decode apps: %w", err)
+	}
+
+	a.Disabled = map[string]AppList{}
+	for _, tier := range Tiers {
+		raw, ok := tiers[tier]
+		if !ok {
+			continue
+		}
+
+		var enabled AppList
+		if err := json.Unmarshal(raw, &enabled); err != nil {
+			return fmt.Errorf("tier %s: %w", tier, err)
+		}
+		*a.tierList(tier) = enabled
+
+		var declared map[string]bool
+		if err := json.Unmarshal(raw, &declared); err != nil {
+			continue // plain list form has no disabled releases
+		}
+		for name, on := range declared {
+			if !on {
+				a.Disabled[tier] = append(a.Disabled[tier], name)
+			}
+		}
+		slices.Sort(a.Disabled[tier])
+	}
+	return nil
+}
+
+// Tier returns the apps enabled in the named tier, or false if there is no
+// such tier
+func (a Apps) Tier(name string) (AppList, bool) {
+	list := a.tierList(name)
+	if list == nil {
+		return nil, false
+	}
+	return *list, true
+}
+
+// Declared reports whether the CUE config lists app in tier, enabled or not
+func (a Apps) Declared(tier, app string) bool {
+	enabled, _ := a.Tier(tier)
+	return slices.Contains(enabled, app) || slices.Contains(a.Disabled[tier], app)
+}
+
+// tierList returns a pointer to the named tier's list, or nil if there is no
+// such tier
+func (a *Apps) tierList(name string) *AppList {
+	switch name {
+	case "foundation":
+		return &a.Foundation
+	case "platform":
+		return &a.Platform
+	case "apps":
+		return &a.Apps
+	}
+	return nil
+}
+
+// AppList is the sorted list of apps enabled in a tier
+type AppList []string
+
+// UnmarshalJSON decodes a tier from either the CUE form ({release: enabled})
+// or a plain list of release names. Disabled releases are dropped.
+func (a *AppList) UnmarshalJSON(data []byte) error {
+	var enabled map[string]bool
+	if err := json.Unmarshal(data, &enabled); err == nil {
+		list := make(AppList, 0, len(enabled))
+		for name, on := range enabled {
+			if on {
+				list = append(list, name)
+			}
+		}
+		slices.Sort(list)
+		*a = list
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("decode app list: %w", err)
+	}
+	*a = list
+	return nil
 }
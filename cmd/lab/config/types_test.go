@@ -0,0 +1,118 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppsUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		want     Apps
+		disabled map[string]AppList
+		wantErr  bool
+	}{
+		{
+			name: "map tiers",
+			data: `{"foundation": {"metallb": true, "argocd": true, "traefik": false}, "apps": {"forgejo": false}}`,
+			want: Apps{Foundation: AppList{"argocd", "metallb"}, Apps: AppList{}},
+			disabled: map[string]AppList{
+				"foundation": {"traefik"},
+				"apps":       {"forgejo"},
+			},
+		},
+		{
+			name:     "list tiers",
+			data:     `{"foundation": ["metallb", "argocd"], "platform": []}`,
+			want:     Apps{Foundation: AppList{"metallb", "argocd"}, Platform: AppList{}},
+			disabled: map[string]AppList{},
+		},
+		{
+			name:     "mixed tiers",
+			data:     `{"foundation": ["metallb"], "platform": {"longhorn": true, "kured": false}}`,
+			want:     Apps{Foundation: AppList{"metallb"}, Platform: AppList{"longhorn"}},
+			disabled: map[string]AppList{"platform": {"kured"}},
+		},
+		{
+			name:     "unknown tier is ignored",
+			data:     `{"extras": {"demo": true}}`,
+			want:     Apps{},
+			disabled: map[string]AppList{},
+		},
+		{
+			name:    "invalid tier",
+			data:    `{"foundation": "metallb"}`,
+			wantErr: true,
+		},
+		{
+			name:    "not an object",
+			data:    `["metallb"]`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Apps
+			err := json.Unmarshal([]byte(tt.data), &got)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.disabled, got.Disabled)
+			got.Disabled = nil
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAppsTier(t *testing.T) {
+	apps := Apps{Foundation: AppList{"metallb"}, Platform: AppList{}}
+
+	tests := []struct {
+		tier   string
+		want   AppList
+		wantOK bool
+	}{
+		{"foundation", AppList{"metallb"}, true},
+		{"platform", AppList{}, true},
+		{"apps", nil, true},
+		{"extras", nil, false},
+		{"", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tier, func(t *testing.T) {
+			got, ok := apps.Tier(tt.tier)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAppsDeclared(t *testing.T) {
+	var apps Apps
+	require.NoError(t, json.Unmarshal([]byte(`{"foundation": {"metallb": true, "traefik": false}, "apps": ["forgejo"]}`), &apps))
+
+	tests := []struct {
+		name string
+		tier string
+		app  string
+		want bool
+	}{
+		{"enabled", "foundation", "metallb", true},
+		{"disabled", "foundation", "traefik", true},
+		{"enabled in list form", "apps", "forgejo", true},
+		{"undeclared", "foundation", "argocd", false},
+		{"declared in another tier", "platform", "metallb", false},
+		{"unknown tier", "extras", "metallb", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, apps.Declared(tt.tier, tt.app))
+		})
+	}
+}
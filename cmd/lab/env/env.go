@@ -41,6 +41,12 @@ type Environment struct {
 	UpdatedAt time.Time         `json:"updated_at"`
 	TTL       time.Duration     `json:"ttl,omitempty"`
 	Config    EnvConfig         `json:"config"`
+	// Readiness holds the last result of `lab env wait` per target
+	Readiness map[WaitTarget]ReadinessStatus `json:"readiness,omitempty"`
+	// Snapshots lists the saved snapshots of this environment
+	Snapshots []Snapshot `json:"snapshots,omitempty"`
+	// RestoredFrom is "<env>:<tag>" if this environment was restored from a snapshot
+	RestoredFrom string `json:"restored_from,omitempty"`
 }
 
 // EnvConfig holds environment-specific configuration
@@ -143,7 +149,9 @@ func (m *Manager) loadState(name string) (*Environment, error) {
 }
 
 // Create creates a new Kind-based environment
-func (m *Manager) Create(ctx context.Context, name, fromEnv string, workers int) (*Environment, error) {
+func (m *Manager) Create(ctx context.Context, name, fromEnv string, workers int) (_ *Environment, err error) {
+	defer func() { m.Record(name, ActionCreate, fromEnv, err) }()
+
 	// Check if environment already exists
 	if _, err := m.loadState(name); err == nil {
 		return nil, fmt.Errorf("environment %q already exists", name)
@@ -246,7 +254,9 @@ nodes:
 }
 
 // Start starts a stopped environment
-func (m *Manager) Start(ctx context.Context, name string) error {
+func (m *Manager) Start(ctx context.Context, name string) (err error) {
+	defer func() { m.Record(name, ActionStart, "", err) }()
+
 	env, err := m.loadState(name)
 	if err != nil {
 		return err
@@ -295,7 +305,9 @@ func (m *Manager) Start(ctx context.Context, name string) error {
 }
 
 // Stop stops a running environment
-func (m *Manager) Stop(ctx context.Context, name string, preserveState bool) error {
+func (m *Manager) Stop(ctx context.Context, name string, preserveState bool) (err error) {
+	defer func() { m.Record(name, ActionStop, "", err) }()
+
 	env, err := m.loadState(name)
 	if err != nil {
 		return err
@@ -324,7 +336,9 @@ func (m *Manager) Stop(ctx context.Context, name string, preserveState bool) err
 }
 
 // Delete permanently deletes an environment
-func (m *Manager) Delete(ctx context.Context, name string) error {
+func (m *Manager) Delete(ctx context.Context, name string) (err error) {
+	defer func() { m.Record(name, ActionDelete, "", err) }()
+
 	env, err := m.loadState(name)
 	if err != nil {
 		return err
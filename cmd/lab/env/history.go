@@ -0,0 +1,139 @@
+package env
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+)
+
+// Action is a lifecycle operation recorded in an environment's history
+type Action string
+
+const (
+	ActionCreate    Action = "create"
+	ActionStart     Action = "start"
+	ActionStop      Action = "stop"
+	ActionDelete    Action = "delete"
+	ActionBootstrap Action = "bootstrap"
+	ActionSync      Action = "sync"
+	ActionSnapshot  Action = "snapshot"
+	ActionRestore   Action = "restore"
+	ActionRollback  Action = "rollback"
+)
+
+// Event result values
+const (
+	ResultSuccess = "success"
+	ResultError   = "error"
+)
+
+// Event is a single entry in an environment's history log
+type Event struct {
+	Time   time.Time `json:"time"`
+	Action Action    `json:"action"`
+	User   string    `json:"user"`
+	Host   string    `json:"host,omitempty"`
+	Result string    `json:"result"`
+	Detail string    `json:"detail,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// getHistoryPath returns the path to the history log for an environment.
+// Logs live outside the environment's own state dir so they survive Delete.
+func (m *Manager) getHistoryPath(name string) string {
+	return filepath.Join(m.stateDir, ".history", name+".jsonl")
+}
+
+// Record appends a lifecycle event for an environment to its history log,
+// recording a nil opErr as a success. Failing to write the log only prints a
+// warning, so history never fails the operation being recorded.
+func (m *Manager) Record(name string, action Action, detail string, opErr error) {
+	if err := m.appendEvent(name, action, detail, opErr); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not record %s event for %q: %v\n", action, name, err)
+	}
+}
+
+// appendEvent writes a lifecycle event to an environment's history log
+func (m *Manager) appendEvent(name string, action Action, detail string, opErr error) error {
+	event := Event{
+		Time:   time.Now(),
+		Action: action,
+		User:   currentUser(),
+		Result: ResultSuccess,
+		Detail: detail,
+	}
+	if host, err := os.Hostname(); err == nil {
+		event.Host = host
+	}
+	if opErr != nil {
+		event.Result = ResultError
+		event.Error = opErr.Error()
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+
+	historyPath := m.getHistoryPath(name)
+	if err := os.MkdirAll(filepath.Dir(historyPath), 0o700); err != nil {
+		return fmt.Errorf("create history directory: %w", err)
+	}
+
+	f, err := os.OpenFile(historyPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600) //nolint:gosec // historyPath is derived from the XDG state dir + env name
+	if err != nil {
+		return fmt.Errorf("open history: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("write history: %w", err)
+	}
+
+	return nil
+}
+
+// History returns the recorded events for an environment, oldest first
+func (m *Manager) History(name string) ([]Event, error) {
+	f, err := os.Open(m.getHistoryPath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("open history: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue // Skip corrupt lines rather than hiding the rest of the log
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read history: %w", err)
+	}
+
+	return events, nil
+}
+
+// currentUser returns the name of the user running lab
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return "unknown"
+}
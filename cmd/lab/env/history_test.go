@@ -0,0 +1,101 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestGetHistoryPath(t *testing.T) {
+	mgr := NewManager(WithStateDir("/state"), WithConfigDir("/config"))
+	expected := "/state/.history/staging.jsonl"
+	got := mgr.getHistoryPath("staging")
+	if got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
+
+func TestRecordAndReadHistory(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "env-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	mgr := NewManager(WithStateDir(tmpDir), WithConfigDir(tmpDir))
+
+	mgr.Record("staging", ActionCreate, "production", nil)
+	mgr.Record("staging", ActionSync, "platform", errors.New("helm upgrade failed"))
+
+	events, err := mgr.History("staging")
+	if err != nil {
+		t.Fatalf("read history failed: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+
+	if events[0].Action != ActionCreate || events[0].Result != ResultSuccess {
+		t.Errorf("unexpected first event: %+v", events[0])
+	}
+	if events[1].Result != ResultError || events[1].Error != "helm upgrade failed" {
+		t.Errorf("unexpected second event: %+v", events[1])
+	}
+	if events[0].User == "" {
+		t.Error("expected user to be recorded")
+	}
+}
+
+func TestHistoryEmpty(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "env-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	mgr := NewManager(WithStateDir(tmpDir), WithConfigDir(tmpDir))
+
+	events, err := mgr.History("nonexistent")
+	if err != nil {
+		t.Fatalf("read history failed: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("expected no events, got %d", len(events))
+	}
+}
+
+func TestHistorySurvivesDelete(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "env-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	mgr := NewManager(WithStateDir(tmpDir), WithConfigDir(tmpDir))
+
+	env := &Environment{Name: "test", Type: TypeKind, Status: StatusStopped}
+	if err := mgr.saveState(env); err != nil {
+		t.Fatalf("save state failed: %v", err)
+	}
+	if err := mgr.Delete(context.Background(), "test"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+
+	events, err := mgr.History("test")
+	if err != nil {
+		t.Fatalf("read history failed: %v", err)
+	}
+	if len(events) != 1 || events[0].Action != ActionDelete {
+		t.Errorf("expected a single delete event, got %+v", events)
+	}
+
+	// The history dir must not show up as an environment
+	envs, err := mgr.List(context.Background())
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(envs) != 1 {
+		t.Errorf("expected only production, got %d environments", len(envs))
+	}
+}
@@ -0,0 +1,528 @@
+package env
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// localPathDir is where Kind's local-path-provisioner stores PVC data on each node
+const localPathDir = "/var/local-path-provisioner"
+
+// Snapshot describes a saved copy of an environment's resources and PVC data
+type Snapshot struct {
+	Tag       string    `json:"tag"`
+	CreatedAt time.Time `json:"created_at"`
+	Workers   int       `json:"workers"`
+	Resources int       `json:"resources"`
+	// Nodes lists the node roles (e.g. control-plane, worker2) with PVC data archives
+	Nodes []string `json:"nodes,omitempty"`
+}
+
+// systemNamespaces are owned by Kind/Kubernetes and recreated with every cluster
+var systemNamespaces = []string{"kube-system", "kube-public", "kube-node-lease", "local-path-storage"}
+
+// skippedKinds are regenerated by the cluster and must not be restored
+var skippedKinds = []string{"Event", "Endpoints", "EndpointSlice", "Lease"}
+
+// snapshotTagPattern matches tags that are safe to use as a directory name
+var snapshotTagPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// validateSnapshotTag rejects tags that would resolve outside the
+// environment's snapshots directory
+func validateSnapshotTag(tag string) error {
+	if tag == "." || tag == ".." || !snapshotTagPattern.MatchString(tag) {
+		return fmt.Errorf("invalid snapshot tag %q: use letters, digits, dots, dashes and underscores", tag)
+	}
+	return nil
+}
+
+// getSnapshotDir returns the directory holding a snapshot's data
+func (m *Manager) getSnapshotDir(name, tag string) string {
+	return filepath.Join(m.stateDir, name, "snapshots", tag)
+}
+
+// findSnapshot returns the snapshot with the given tag
+func (env *Environment) findSnapshot(tag string) (*Snapshot, bool) {
+	for i := range env.Snapshots {
+		if env.Snapshots[i].Tag == tag {
+			return &env.Snapshots[i], true
+		}
+	}
+	return nil, false
+}
+
+// Snapshot saves the namespaced resources and local-path PVC data of a running
+// Kind environment under tag. Kind mounts /var as a volume on its node
+// containers, so `docker commit` would capture neither etcd nor PVC data;
+// instead resources are dumped through the API and PVC data is archived from
+// each node.
+func (m *Manager) Snapshot(ctx context.Context, name, tag string) (_ *Snapshot, err error) {
+	defer func() { m.Record(name, ActionSnapshot, tag, err) }()
+
+	if err := validateSnapshotTag(tag); err != nil {
+		return nil, err
+	}
+
+	env, err := m.loadState(name)
+	if err != nil {
+		return nil, err
+	}
+	if env.Type != TypeKind {
+		return nil, fmt.Errorf("environment %q is not a Kind environment", name)
+	}
+	if m.getKindClusterStatus(ctx, env.Config.KindClusterName) != StatusRunning {
+		return nil, fmt.Errorf("environment %q is not running", name)
+	}
+	if _, ok := env.findSnapshot(tag); ok {
+		return nil, fmt.Errorf("snapshot %q already exists for environment %q", tag, name)
+	}
+
+	dir := m.getSnapshotDir(name, tag)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create snapshot directory: %w", err)
+	}
+
+	snap, err := m.writeSnapshot(ctx, env, tag, dir)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+
+	env.Snapshots = append(env.Snapshots, *snap)
+	env.UpdatedAt = time.Now()
+	if err := m.saveState(env); err != nil {
+		return nil, err
+	}
+
+	return snap, nil
+}
+
+// writeSnapshot dumps resources and PVC data for env into dir
+func (m *Manager) writeSnapshot(ctx context.Context, env *Environment, tag, dir string) (*Snapshot, error) {
+	kubeconfig := env.Config.Kubeconfig
+
+	clusterDump, err := kubectlOutput(ctx, kubeconfig, "get", "namespaces,customresourcedefinitions,persistentvolumes", "-o", "yaml")
+	if err != nil {
+		return nil, fmt.Errorf("dump cluster resources: %w", err)
+	}
+	clusterDocs, err := sanitizeResourceDump(clusterDump)
+	if err != nil {
+		return nil, err
+	}
+
+	resourceTypes, err := namespacedResourceTypes(ctx, kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	namespacedDump, err := kubectlOutput(ctx, kubeconfig, "get", strings.Join(resourceTypes, ","), "--all-namespaces", "-o", "yaml")
+	if err != nil {
+		return nil, fmt.Errorf("dump namespaced resources: %w", err)
+	}
+	namespacedDocs, err := sanitizeResourceDump(namespacedDump)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeYAMLDocs(filepath.Join(dir, "cluster.yaml"), clusterDocs); err != nil {
+		return nil, err
+	}
+	if err := writeYAMLDocs(filepath.Join(dir, "resources.yaml"), namespacedDocs); err != nil {
+		return nil, err
+	}
+
+	nodes, err := kindNodes(ctx, env.Config.KindClusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &Snapshot{
+		Tag:       tag,
+		CreatedAt: time.Now(),
+		Workers:   env.Config.Workers,
+		Resources: len(clusterDocs) + len(namespacedDocs),
+	}
+	for _, node := range nodes {
+		role := strings.TrimPrefix(node, env.Config.KindClusterName+"-")
+		if err := archiveNodePVCData(ctx, node, filepath.Join(dir, "pvc-"+role+".tar")); err != nil {
+			return nil, err
+		}
+		snap.Nodes = append(snap.Nodes, role)
+	}
+
+	return snap, nil
+}
+
+// Restore creates a new environment newName from a snapshot of environment name.
+// A fresh Kind cluster is created with the same topology, PVC data is copied
+// back onto the matching nodes, and the saved resources are applied.
+func (m *Manager) Restore(ctx context.Context, name, tag, newName string) (_ *Environment, err error) {
+	defer func() { m.Record(newName, ActionRestore, name+":"+tag, err) }()
+
+	if err := validateSnapshotTag(tag); err != nil {
+		return nil, err
+	}
+
+	src, err := m.loadState(name)
+	if err != nil {
+		return nil, err
+	}
+	snap, ok := src.findSnapshot(tag)
+	if !ok {
+		return nil, fmt.Errorf("snapshot %q not found for environment %q", tag, name)
+	}
+	dir := m.getSnapshotDir(name, tag)
+
+	env, err := m.Create(ctx, newName, src.FromEnv, snap.Workers)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.restoreSnapshot(ctx, src, env, snap, dir); err != nil {
+		env.Status = StatusError
+		_ = m.saveState(env)
+		return nil, err
+	}
+
+	env.RestoredFrom = name + ":" + tag
+	env.UpdatedAt = time.Now()
+	if err := m.saveState(env); err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// restoreSnapshot loads a snapshot's PVC data and resources into env's cluster
+func (m *Manager) restoreSnapshot(ctx context.Context, src, env *Environment, snap *Snapshot, dir string) error {
+	for _, role := range snap.Nodes {
+		node := env.Config.KindClusterName + "-" + role
+		if err := restoreNodePVCData(ctx, node, filepath.Join(dir, "pvc-"+role+".tar")); err != nil {
+			return err
+		}
+	}
+
+	kubeconfig := env.Config.Kubeconfig
+	for _, file := range []string{"cluster.yaml", "resources.yaml"} {
+		docs, err := readYAMLDocs(filepath.Join(dir, file))
+		if err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			continue
+		}
+		renameKindNodes(docs, src.Config.KindClusterName, env.Config.KindClusterName)
+
+		var data bytes.Buffer
+		if err := encodeYAMLDocs(&data, docs); err != nil {
+			return err
+		}
+
+		cmd := exec.CommandContext(ctx, "kubectl", "--kubeconfig", kubeconfig,
+			"apply", "--server-side", "--force-conflicts", "-f", "-")
+		cmd.Stdin = &data
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("apply %s: %w", file, err)
+		}
+
+		if slices.ContainsFunc(docs, func(doc map[string]any) bool { return doc["kind"] == "CustomResourceDefinition" }) {
+			waitCmd := exec.CommandContext(ctx, "kubectl", "--kubeconfig", kubeconfig,
+				"wait", "--for=condition=Established", "customresourcedefinitions", "--all", "--timeout=2m")
+			waitCmd.Stdout = os.Stdout
+			waitCmd.Stderr = os.Stderr
+			if err := waitCmd.Run(); err != nil {
+				return fmt.Errorf("wait for CRDs: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// selectedNodeAnnotation records the node a PVC's volume was provisioned on
+const selectedNodeAnnotation = "volume.kubernetes.io/selected-node"
+
+// renameKindNodes points the fields of docs that name a node of Kind cluster
+// src at the matching node of cluster dst: PV node affinity values and the
+// selected-node annotation. Kind node names embed the cluster name, e.g.
+// lab-dev-worker2. Nothing else is touched.
+func renameKindNodes(docs []map[string]any, src, dst string) {
+	rename := func(v any) any {
+		if node, ok := v.(string); ok && strings.HasPrefix(node, src+"-") {
+			return dst + "-" + strings.TrimPrefix(node, src+"-")
+		}
+		return v
+	}
+
+	for _, doc := range docs {
+		if meta, ok := doc["metadata"].(map[string]any); ok {
+			if annotations, ok := meta["annotations"].(map[string]any); ok {
+				if node, ok := annotations[selectedNodeAnnotation]; ok {
+					annotations[selectedNodeAnnotation] = rename(node)
+				}
+			}
+		}
+
+		if doc["kind"] != "PersistentVolume" {
+			continue
+		}
+		spec, _ := doc["spec"].(map[string]any)
+		affinity, _ := spec["nodeAffinity"].(map[string]any)
+		required, _ := affinity["required"].(map[string]any)
+		terms, _ := required["nodeSelectorTerms"].([]any)
+		for _, term := range terms {
+			term, _ := term.(map[string]any)
+			for _, field := range []string{"matchExpressions", "matchFields"} {
+				requirements, _ := term[field].([]any)
+				for _, req := range requirements {
+					req, _ := req.(map[string]any)
+					values, _ := req["values"].([]any)
+					for i, v := range values {
+						values[i] = rename(v)
+					}
+				}
+			}
+		}
+	}
+}
+
+// kubectlOutput runs kubectl against kubeconfig and returns its stdout
+func kubectlOutput(ctx context.Context, kubeconfig string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "kubectl", append([]string{"--kubeconfig", kubeconfig}, args...)...)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("kubectl %s: %w", args[0], err)
+	}
+	return out, nil
+}
+
+// namespacedResourceTypes lists the namespaced resource types that can be both
+// listed and created, excluding kinds the cluster regenerates itself
+func namespacedResourceTypes(ctx context.Context, kubeconfig string) ([]string, error) {
+	out, err := kubectlOutput(ctx, kubeconfig, "api-resources", "--namespaced=true", "--verbs=list,create", "-o", "name")
+	if err != nil {
+		return nil, fmt.Errorf("list resource types: %w", err)
+	}
+
+	var types []string
+	for _, t := range strings.Fields(string(out)) {
+		switch strings.SplitN(t, ".", 2)[0] {
+		case "events", "endpoints", "endpointslices", "leases", "pods", "replicasets", "controllerrevisions":
+			continue
+		}
+		types = append(types, t)
+	}
+	if len(types) == 0 {
+		return nil, errors.New("no namespaced resource types found")
+	}
+	return types, nil
+}
+
+// kindNodes returns the node container names of a Kind cluster
+func kindNodes(ctx context.Context, clusterName string) ([]string, error) {
+	out, err := exec.CommandContext(ctx, "kind", "get", "nodes", "--name", clusterName).Output()
+	if err != nil {
+		return nil, fmt.Errorf("get kind nodes: %w", err)
+	}
+	nodes := strings.Fields(string(out))
+	slices.Sort(nodes)
+	return nodes, nil
+}
+
+// archiveNodePVCData writes a tar of a node's local-path PVC data to path
+func archiveNodePVCData(ctx context.Context, node, path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600) //nolint:gosec // path is inside the lab state dir
+	if err != nil {
+		return fmt.Errorf("create PVC archive: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	cmd := exec.CommandContext(ctx, "docker", "exec", node, "sh", "-c",
+		fmt.Sprintf("mkdir -p %[1]s && tar -C %[1]s -cf - .", localPathDir))
+	cmd.Stdout = f
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("archive PVC data from %s: %w", node, err)
+	}
+	return nil
+}
+
+// restoreNodePVCData extracts a PVC data archive onto a node
+func restoreNodePVCData(ctx context.Context, node, path string) error {
+	f, err := os.Open(path) //nolint:gosec // path is inside the lab state dir
+	if err != nil {
+		return fmt.Errorf("open PVC archive: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	cmd := exec.CommandContext(ctx, "docker", "exec", "-i", node, "sh", "-c",
+		fmt.Sprintf("mkdir -p %[1]s && tar -C %[1]s -xf -", localPathDir))
+	cmd.Stdin = f
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("restore PVC data to %s: %w", node, err)
+	}
+	return nil
+}
+
+// sanitizeResourceDump turns a `kubectl get -o yaml` List into objects that can
+// be applied to a fresh cluster. Objects owned by a controller, cluster-managed
+// kinds and anything in a system namespace are dropped; server-populated
+// metadata and status are stripped.
+func sanitizeResourceDump(data []byte) ([]map[string]any, error) {
+	var list struct {
+		Items []map[string]any `yaml:"items"`
+	}
+	if err := yaml.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("parse resource dump: %w", err)
+	}
+
+	var docs []map[string]any
+	for _, obj := range list.Items {
+		if !keepObject(obj) {
+			continue
+		}
+		stripServerFields(obj)
+		docs = append(docs, obj)
+	}
+	return docs, nil
+}
+
+// keepObject reports whether obj should be part of a snapshot
+func keepObject(obj map[string]any) bool {
+	kind, _ := obj["kind"].(string)
+	meta, _ := obj["metadata"].(map[string]any)
+	name, _ := meta["name"].(string)
+	namespace, _ := meta["namespace"].(string)
+
+	if slices.Contains(skippedKinds, kind) {
+		return false
+	}
+	if _, owned := meta["ownerReferences"]; owned {
+		return false
+	}
+	if slices.Contains(systemNamespaces, namespace) {
+		return false
+	}
+
+	switch kind {
+	case "Namespace":
+		return name != "default" && !slices.Contains(systemNamespaces, name)
+	case "PersistentVolume":
+		claimNamespace := nestedString(obj, "spec", "claimRef", "namespace")
+		return claimNamespace != "" && !slices.Contains(systemNamespaces, claimNamespace)
+	case "ServiceAccount":
+		return name != "default"
+	case "ConfigMap":
+		return name != "kube-root-ca.crt"
+	case "Secret":
+		return obj["type"] != "kubernetes.io/service-account-token"
+	case "Service":
+		return !(namespace == "default" && name == "kubernetes")
+	}
+	return true
+}
+
+// stripServerFields removes fields the API server assigns so obj can be created anew
+func stripServerFields(obj map[string]any) {
+	delete(obj, "status")
+
+	if meta, ok := obj["metadata"].(map[string]any); ok {
+		for _, k := range []string{"uid", "resourceVersion", "creationTimestamp", "generation", "managedFields", "selfLink"} {
+			delete(meta, k)
+		}
+	}
+
+	spec, _ := obj["spec"].(map[string]any)
+	switch obj["kind"] {
+	case "Service":
+		if spec["clusterIP"] != "None" {
+			delete(spec, "clusterIP")
+			delete(spec, "clusterIPs")
+		}
+	case "PersistentVolume":
+		if claimRef, ok := spec["claimRef"].(map[string]any); ok {
+			delete(claimRef, "uid")
+			delete(claimRef, "resourceVersion")
+		}
+	}
+}
+
+// nestedString returns the string at path in obj, or "" if absent
+func nestedString(obj map[string]any, path ...string) string {
+	var cur any = obj
+	for _, p := range path {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return ""
+		}
+		cur = m[p]
+	}
+	s, _ := cur.(string)
+	return s
+}
+
+// writeYAMLDocs writes docs to path as a multi-document YAML stream
+func writeYAMLDocs(path string, docs []map[string]any) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600) //nolint:gosec // path is inside the lab state dir
+	if err != nil {
+		return fmt.Errorf("create %s: %w", filepath.Base(path), err)
+	}
+	defer func() { _ = f.Close() }()
+
+	return encodeYAMLDocs(f, docs)
+}
+
+// readYAMLDocs reads the multi-document YAML stream written by writeYAMLDocs
+func readYAMLDocs(path string) ([]map[string]any, error) {
+	f, err := os.Open(path) //nolint:gosec // path is inside the lab state dir
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", filepath.Base(path), err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var docs []map[string]any
+	dec := yaml.NewDecoder(f)
+	for {
+		var doc map[string]any
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", filepath.Base(path), err)
+		}
+		if doc != nil {
+			docs = append(docs, doc)
+		}
+	}
+}
+
+// encodeYAMLDocs writes docs to w as a multi-document YAML stream
+func encodeYAMLDocs(w io.Writer, docs []map[string]any) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	for _, doc := range docs {
+		if err := enc.Encode(doc); err != nil {
+			return fmt.Errorf("encode resource: %w", err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("encode resources: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package env
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testResourceDump = `apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: settings
+    namespace: forgejo
+    uid: 1234
+    resourceVersion: "42"
+    creationTimestamp: "2026-01-01T00:00:00Z"
+    managedFields: []
+  data:
+    key: value
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: kube-root-ca.crt
+    namespace: forgejo
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: coredns
+    namespace: kube-system
+- apiVersion: apps/v1
+  kind: ReplicaSet
+  metadata:
+    name: forgejo-abc
+    namespace: forgejo
+    ownerReferences:
+    - kind: Deployment
+      name: forgejo
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: forgejo
+    namespace: forgejo
+  spec:
+    clusterIP: 10.43.0.10
+    clusterIPs: [10.43.0.10]
+  status:
+    loadBalancer: {}
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: forgejo-headless
+    namespace: forgejo
+  spec:
+    clusterIP: None
+- apiVersion: v1
+  kind: PersistentVolume
+  metadata:
+    name: pvc-1
+  spec:
+    claimRef:
+      namespace: forgejo
+      name: data
+      uid: 5678
+- apiVersion: v1
+  kind: Namespace
+  metadata:
+    name: kube-system
+`
+
+func TestSanitizeResourceDump(t *testing.T) {
+	docs, err := sanitizeResourceDump([]byte(testResourceDump))
+	if err != nil {
+		t.Fatalf("sanitize failed: %v", err)
+	}
+
+	var names []string
+	for _, doc := range docs {
+		names = append(names, nestedString(doc, "kind")+"/"+nestedString(doc, "metadata", "name"))
+	}
+	expected := "ConfigMap/settings,Service/forgejo,Service/forgejo-headless,PersistentVolume/pvc-1"
+	if got := strings.Join(names, ","); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+
+	meta := docs[0]["metadata"].(map[string]any)
+	for _, k := range []string{"uid", "resourceVersion", "creationTimestamp", "managedFields"} {
+		if _, ok := meta[k]; ok {
+			t.Errorf("expected metadata.%s to be stripped", k)
+		}
+	}
+
+	svc := docs[1]
+	if _, ok := svc["status"]; ok {
+		t.Error("expected status to be stripped")
+	}
+	if nestedString(svc, "spec", "clusterIP") != "" {
+		t.Error("expected clusterIP to be stripped")
+	}
+	if nestedString(docs[2], "spec", "clusterIP") != "None" {
+		t.Error("expected headless clusterIP to be kept")
+	}
+	if nestedString(docs[3], "spec", "claimRef", "uid") != "" {
+		t.Error("expected PV claimRef uid to be stripped")
+	}
+}
+
+func TestGetSnapshotDir(t *testing.T) {
+	mgr := NewManager(WithStateDir("/state"), WithConfigDir("/config"))
+	expected := "/state/staging/snapshots/tuned"
+	got := mgr.getSnapshotDir("staging", "tuned")
+	if got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
+
+func TestFindSnapshot(t *testing.T) {
+	env := &Environment{Snapshots: []Snapshot{{Tag: "a"}, {Tag: "b"}}}
+
+	snap, ok := env.findSnapshot("b")
+	if !ok || snap.Tag != "b" {
+		t.Error("expected to find snapshot b")
+	}
+	if _, ok := env.findSnapshot("c"); ok {
+		t.Error("expected snapshot c to be missing")
+	}
+}
+
+func TestValidateSnapshotTag(t *testing.T) {
+	for _, tag := range []string{"tuned", "v1.2", "before_upgrade", "2026-01-01"} {
+		if err := validateSnapshotTag(tag); err != nil {
+			t.Errorf("expected tag %q to be valid, got %v", tag, err)
+		}
+	}
+	for _, tag := range []string{"", ".", "..", "../..", "a/b", ".hidden", "-flag", "tag with space"} {
+		if err := validateSnapshotTag(tag); err == nil {
+			t.Errorf("expected tag %q to be rejected", tag)
+		}
+	}
+}
+
+func TestSnapshotRejectsTraversalTag(t *testing.T) {
+	tmpDir := t.TempDir()
+	mgr := NewManager(WithStateDir(tmpDir), WithConfigDir(tmpDir))
+
+	sentinel := filepath.Join(tmpDir, "staging", "state.json")
+	if err := os.MkdirAll(filepath.Dir(sentinel), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(sentinel, []byte("{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tag := range []string{"..", "../.."} {
+		if _, err := mgr.Snapshot(t.Context(), "staging", tag); err == nil {
+			t.Errorf("expected snapshot with tag %q to fail", tag)
+		}
+		if _, err := mgr.Restore(t.Context(), "staging", tag, "copy"); err == nil {
+			t.Errorf("expected restore with tag %q to fail", tag)
+		}
+	}
+
+	if _, err := os.Stat(sentinel); err != nil {
+		t.Errorf("expected environment state to be untouched: %v", err)
+	}
+}
+
+const testRestoreDocs = `apiVersion: v1
+kind: PersistentVolume
+metadata:
+  name: pvc-1
+spec:
+  nodeAffinity:
+    required:
+      nodeSelectorTerms:
+      - matchExpressions:
+        - key: kubernetes.io/hostname
+          operator: In
+          values:
+          - lab-dev-worker2
+---
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: data
+  namespace: forgejo
+  annotations:
+    volume.kubernetes.io/selected-node: lab-dev-worker2
+    note: moved from lab-dev-worker2
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: forgejo
+data:
+  node: lab-dev-worker2
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: creds
+  namespace: forgejo
+stringData:
+  password: lab-dev-secret
+`
+
+func TestRenameKindNodes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resources.yaml")
+	if err := os.WriteFile(path, []byte(testRestoreDocs), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	docs, err := readYAMLDocs(path)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if len(docs) != 4 {
+		t.Fatalf("expected 4 docs, got %d", len(docs))
+	}
+
+	renameKindNodes(docs, "lab-dev", "lab-copy")
+
+	pv := docs[0]["spec"].(map[string]any)["nodeAffinity"].(map[string]any)["required"].(map[string]any)["nodeSelectorTerms"].([]any)[0].(map[string]any)["matchExpressions"].([]any)[0].(map[string]any)
+	if got := pv["values"].([]any)[0]; got != "lab-copy-worker2" {
+		t.Errorf("expected PV node affinity to name lab-copy-worker2, got %v", got)
+	}
+	if got := nestedString(docs[1], "metadata", "annotations", "volume.kubernetes.io/selected-node"); got != "lab-copy-worker2" {
+		t.Errorf("expected selected-node to be lab-copy-worker2, got %s", got)
+	}
+
+	// Anything that merely mentions the old cluster name is left alone
+	if got := nestedString(docs[1], "metadata", "annotations", "note"); got != "moved from lab-dev-worker2" {
+		t.Errorf("expected other annotations to be unchanged, got %s", got)
+	}
+	if got := nestedString(docs[2], "data", "node"); got != "lab-dev-worker2" {
+		t.Errorf("expected ConfigMap data to be unchanged, got %s", got)
+	}
+	if got := nestedString(docs[3], "stringData", "password"); got != "lab-dev-secret" {
+		t.Errorf("expected Secret data to be unchanged, got %s", got)
+	}
+}
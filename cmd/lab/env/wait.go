@@ -0,0 +1,240 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// WaitTarget is a readiness condition that `lab env wait` can block on
+type WaitTarget string
+
+const (
+	// WaitNodes waits until every node reports Ready
+	WaitNodes WaitTarget = "nodes"
+	// WaitPods waits until every kube-system deployment is available
+	WaitPods WaitTarget = "pods"
+	// WaitApps waits until every ArgoCD Application is Healthy
+	WaitApps WaitTarget = "apps"
+)
+
+// ParseWaitTarget validates a --for value
+func ParseWaitTarget(s string) (WaitTarget, error) {
+	switch t := WaitTarget(s); t {
+	case WaitNodes, WaitPods, WaitApps:
+		return t, nil
+	default:
+		return "", fmt.Errorf("unknown wait target %q (expected nodes, pods or apps)", s)
+	}
+}
+
+// ReadinessStatus records the last observed readiness of a wait target
+type ReadinessStatus struct {
+	Ready     bool      `json:"ready"`
+	Message   string    `json:"message,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// argoApplicationGVR identifies ArgoCD Application resources
+var argoApplicationGVR = schema.GroupVersionResource{
+	Group:    "argoproj.io",
+	Version:  "v1alpha1",
+	Resource: "applications",
+}
+
+// clusterClients bundles the clients needed for readiness checks
+type clusterClients struct {
+	core    kubernetes.Interface
+	dynamic dynamic.Interface
+}
+
+// newClusterClients builds clients from a kubeconfig file
+func newClusterClients(kubeconfig string) (*clusterClients, error) {
+	restConfig, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("load kubeconfig: %w", err)
+	}
+
+	core, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("create kubernetes client: %w", err)
+	}
+
+	dyn, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("create dynamic client: %w", err)
+	}
+
+	return &clusterClients{core: core, dynamic: dyn}, nil
+}
+
+// Wait polls the environment's cluster until every target is ready or timeout
+// elapses. The latest status of each target is saved in the environment state
+// after every poll. interval must be positive.
+func (m *Manager) Wait(ctx context.Context, name string, targets []WaitTarget, timeout, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("poll interval must be positive, got %s", interval)
+	}
+
+	env, err := m.loadState(name)
+	if err != nil {
+		return err
+	}
+
+	clients, err := newClusterClients(env.Config.Kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	return m.waitWithClients(ctx, env, clients, targets, timeout, interval)
+}
+
+// waitWithClients implements Wait against the given clients
+func (m *Manager) waitWithClients(ctx context.Context, env *Environment, clients *clusterClients, targets []WaitTarget, timeout, interval time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if env.Readiness == nil {
+		env.Readiness = map[WaitTarget]ReadinessStatus{}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		allReady := true
+		for _, target := range targets {
+			status := checkTarget(ctx, clients, target)
+			env.Readiness[target] = status
+			if !status.Ready {
+				allReady = false
+			}
+		}
+
+		env.UpdatedAt = time.Now()
+		if err := m.saveState(env); err != nil {
+			return err
+		}
+
+		if allReady {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			pending := firstUnready(env, targets)
+			return fmt.Errorf("timed out waiting for %s: %s", pending, env.Readiness[pending].Message)
+		case <-ticker.C:
+		}
+	}
+}
+
+// firstUnready returns the first target that is not yet ready
+func firstUnready(env *Environment, targets []WaitTarget) WaitTarget {
+	for _, t := range targets {
+		if !env.Readiness[t].Ready {
+			return t
+		}
+	}
+	return ""
+}
+
+// checkTarget evaluates a single wait target once
+func checkTarget(ctx context.Context, clients *clusterClients, target WaitTarget) ReadinessStatus {
+	var ready bool
+	var msg string
+	var err error
+
+	switch target {
+	case WaitNodes:
+		ready, msg, err = checkNodes(ctx, clients.core)
+	case WaitPods:
+		ready, msg, err = checkSystemDeployments(ctx, clients.core)
+	case WaitApps:
+		ready, msg, err = checkArgoApplications(ctx, clients.dynamic)
+	default:
+		err = fmt.Errorf("unknown wait target %q", target)
+	}
+	if err != nil {
+		msg = err.Error()
+	}
+
+	return ReadinessStatus{Ready: ready, Message: msg, CheckedAt: time.Now()}
+}
+
+// checkNodes reports whether every node has a Ready=True condition
+func checkNodes(ctx context.Context, client kubernetes.Interface) (bool, string, error) {
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return false, "", fmt.Errorf("list nodes: %w", err)
+	}
+	if len(nodes.Items) == 0 {
+		return false, "no nodes registered", nil
+	}
+
+	ready := 0
+	for _, node := range nodes.Items {
+		for _, cond := range node.Status.Conditions {
+			if cond.Type == corev1.NodeReady && cond.Status == corev1.ConditionTrue {
+				ready++
+				break
+			}
+		}
+	}
+
+	return ready == len(nodes.Items), fmt.Sprintf("%d/%d nodes ready", ready, len(nodes.Items)), nil
+}
+
+// checkSystemDeployments reports whether every kube-system deployment is available
+func checkSystemDeployments(ctx context.Context, client kubernetes.Interface) (bool, string, error) {
+	deployments, err := client.AppsV1().Deployments("kube-system").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return false, "", fmt.Errorf("list kube-system deployments: %w", err)
+	}
+	if len(deployments.Items) == 0 {
+		return false, "no kube-system deployments found", nil
+	}
+
+	available := 0
+	for _, d := range deployments.Items {
+		for _, cond := range d.Status.Conditions {
+			if cond.Type == appsv1.DeploymentAvailable && cond.Status == corev1.ConditionTrue {
+				available++
+				break
+			}
+		}
+	}
+
+	return available == len(deployments.Items),
+		fmt.Sprintf("%d/%d kube-system deployments available", available, len(deployments.Items)), nil
+}
+
+// checkArgoApplications reports whether every ArgoCD Application is Healthy
+func checkArgoApplications(ctx context.Context, client dynamic.Interface) (bool, string, error) {
+	apps, err := client.Resource(argoApplicationGVR).Namespace("argocd").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return false, "", fmt.Errorf("list ArgoCD applications: %w", err)
+	}
+	if len(apps.Items) == 0 {
+		return false, "no ArgoCD applications found", nil
+	}
+
+	healthy := 0
+	for _, app := range apps.Items {
+		status, _, _ := unstructured.NestedString(app.Object, "status", "health", "status")
+		if status == "Healthy" {
+			healthy++
+		}
+	}
+
+	return healthy == len(apps.Items), fmt.Sprintf("%d/%d applications healthy", healthy, len(apps.Items)), nil
+}
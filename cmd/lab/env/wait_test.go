@@ -0,0 +1,170 @@
+package env
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func readyNode(name string, ready bool) *corev1.Node {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: status}},
+		},
+	}
+}
+
+func argoApp(name, health string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "Application",
+		"metadata":   map[string]any{"name": name, "namespace": "argocd"},
+		"status":     map[string]any{"health": map[string]any{"status": health}},
+	}}
+}
+
+func newFakeDynamic(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{argoApplicationGVR: "ApplicationList"}, objects...)
+}
+
+func TestParseWaitTarget(t *testing.T) {
+	for _, s := range []string{"nodes", "pods", "apps"} {
+		if _, err := ParseWaitTarget(s); err != nil {
+			t.Errorf("expected %q to be valid: %v", s, err)
+		}
+	}
+	if _, err := ParseWaitTarget("everything"); err == nil {
+		t.Error("expected error for unknown target")
+	}
+}
+
+func TestCheckNodes(t *testing.T) {
+	client := fake.NewSimpleClientset(readyNode("a", true), readyNode("b", false))
+
+	ready, msg, err := checkNodes(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ready {
+		t.Error("expected nodes to not be ready")
+	}
+	if msg != "1/2 nodes ready" {
+		t.Errorf("unexpected message %q", msg)
+	}
+}
+
+func TestCheckSystemDeployments(t *testing.T) {
+	coredns := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "coredns", Namespace: "kube-system"},
+		Status: appsv1.DeploymentStatus{
+			Conditions: []appsv1.DeploymentCondition{{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionTrue}},
+		},
+	}
+	client := fake.NewSimpleClientset(coredns)
+
+	ready, _, err := checkSystemDeployments(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ready {
+		t.Error("expected kube-system deployments to be available")
+	}
+}
+
+func TestCheckArgoApplications(t *testing.T) {
+	client := newFakeDynamic(argoApp("argocd", "Healthy"), argoApp("forgejo", "Progressing"))
+
+	ready, msg, err := checkArgoApplications(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ready {
+		t.Error("expected applications to not be healthy")
+	}
+	if msg != "1/2 applications healthy" {
+		t.Errorf("unexpected message %q", msg)
+	}
+}
+
+func TestWaitSavesReadiness(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "env-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	mgr := NewManager(WithStateDir(tmpDir), WithConfigDir(tmpDir))
+	env := &Environment{Name: "test", Type: TypeKind, Status: StatusRunning}
+	clients := &clusterClients{
+		core:    fake.NewSimpleClientset(readyNode("a", true)),
+		dynamic: newFakeDynamic(),
+	}
+
+	if err := mgr.waitWithClients(context.Background(), env, clients, []WaitTarget{WaitNodes}, time.Second, 10*time.Millisecond); err != nil {
+		t.Fatalf("wait failed: %v", err)
+	}
+
+	loaded, err := mgr.loadState("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Readiness[WaitNodes].Ready {
+		t.Error("expected nodes readiness to be saved as ready")
+	}
+}
+
+func TestWaitTimeout(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "env-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	mgr := NewManager(WithStateDir(tmpDir), WithConfigDir(tmpDir))
+	env := &Environment{Name: "test", Type: TypeKind, Status: StatusRunning}
+	clients := &clusterClients{
+		core:    fake.NewSimpleClientset(readyNode("a", false)),
+		dynamic: newFakeDynamic(),
+	}
+
+	err = mgr.waitWithClients(context.Background(), env, clients, []WaitTarget{WaitNodes}, 50*time.Millisecond, 10*time.Millisecond)
+	if err == nil {
+		t.Fatal("expected timeout error")
+	}
+
+	loaded, err := mgr.loadState("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Readiness[WaitNodes].Ready {
+		t.Error("expected nodes readiness to be saved as not ready")
+	}
+}
+
+func TestWaitRejectsNonPositiveInterval(t *testing.T) {
+	mgr := NewManager(WithStateDir(t.TempDir()), WithConfigDir(t.TempDir()))
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		err := mgr.Wait(context.Background(), "test", []WaitTarget{WaitNodes}, time.Second, interval)
+		if err == nil || !strings.Contains(err.Error(), "interval must be positive") {
+			t.Errorf("expected interval %s to be rejected, got %v", interval, err)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package argocd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Application is the sync and health state of an ArgoCD Application
+type Application struct {
+	Name     string `json:"name"`
+	Sync     string `json:"sync"`
+	Health   string `json:"health"`
+	Revision string `json:"revision,omitempty"`
+	// Message is the health message, or the last operation's message if the
+	// operation failed
+	Message string `json:"message,omitempty"`
+	// OperationPhase is the phase of the current or last sync operation
+	OperationPhase string `json:"operationPhase,omitempty"`
+	// OperationPending is set while a requested operation hasn't started
+	OperationPending bool `json:"operationPending,omitempty"`
+}
+
+// Healthy reports whether the Application is synced and healthy with no
+// operation in flight
+func (a *Application) Healthy() bool {
+	return a.Sync == "Synced" && a.Health == "Healthy" && !a.OperationPending &&
+		(a.OperationPhase == "" || a.OperationPhase == "Succeeded")
+}
+
+// failed reports whether the Application's last operation failed
+func (a *Application) failed() bool {
+	return !a.OperationPending && (a.OperationPhase == "Failed" || a.OperationPhase == "Error")
+}
+
+// application is the subset of the Application resource the client reads
+type application struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Operation *struct{} `json:"operation"`
+	Status    struct {
+		Sync struct {
+			Status   string `json:"status"`
+			Revision string `json:"revision"`
+		} `json:"sync"`
+		Health struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		} `json:"health"`
+		OperationState *struct {
+			Phase   string `json:"phase"`
+			Message string `json:"message"`
+		} `json:"operationState"`
+	} `json:"status"`
+}
+
+// state flattens the resource into an Application
+func (a *application) state() *Application {
+	app := &Application{
+		Name:             a.Metadata.Name,
+		Sync:             a.Status.Sync.Status,
+		Health:           a.Status.Health.Status,
+		Revision:         a.Status.Sync.Revision,
+		Message:          a.Status.Health.Message,
+		OperationPending: a.Operation != nil,
+	}
+	if op := a.Status.OperationState; op != nil {
+		app.OperationPhase = op.Phase
+		if app.failed() {
+			app.Message = op.Message
+		}
+	}
+	if app.Sync == "" {
+		app.Sync = "Unknown"
+	}
+	if app.Health == "" {
+		app.Health = "Unknown"
+	}
+	return app
+}
+
+// Application returns the current state of the named Application
+func (c *Client) Application(ctx context.Context, name string) (*Application, error) {
+	var app application
+	if err := c.do(ctx, http.MethodGet, appPath(name), nil, &app); err != nil {
+		return nil, fmt.Errorf("get application %s: %w", name, err)
+	}
+	return app.state(), nil
+}
+
+// SyncOptions configures a Client.Sync call
+type SyncOptions struct {
+	// Prune deletes resources that are no longer in git
+	Prune bool
+	// Revision syncs to a specific revision instead of the tracked one
+	Revision string
+	// DryRun previews the sync without applying it
+	DryRun bool
+}
+
+// Sync starts a sync of the named Application. It returns once ArgoCD has
+// accepted the operation; use WaitHealthy to wait for the result.
+func (c *Client) Sync(ctx context.Context, name string, opts SyncOptions) error {
+	body := map[string]any{
+		"prune":  opts.Prune,
+		"dryRun": opts.DryRun,
+	}
+	if opts.Revision != "" {
+		body["revision"] = opts.Revision
+	}
+	if err := c.do(ctx, http.MethodPost, appPath(name, "/sync"), body, nil); err != nil {
+		return fmt.Errorf("sync application %s: %w", name, err)
+	}
+	return nil
+}
+
+// WaitHealthy polls the named Application until it's synced and healthy with
+// no operation in flight, or until timeout. It returns ErrSyncFailed if the
+// sync operation fails and ErrNotHealthy with the last seen state on timeout.
+// The last seen state is returned in every case.
+func (c *Client) WaitHealthy(ctx context.Context, name string, timeout time.Duration) (*Application, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	var last *Application
+	for {
+		app, err := c.Application(ctx, name)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			return last, err
+		case err == nil && app.Healthy():
+			return app, nil
+		case err == nil && app.failed():
+			return app, fmt.Errorf("%w: %s: %s", ErrSyncFailed, name, app.Message)
+		case err == nil:
+			last = app
+		}
+
+		select {
+		case <-ctx.Done():
+			if last == nil {
+				return nil, fmt.Errorf("%w: %s: %w", ErrNotHealthy, name, ctx.Err())
+			}
+			return last, fmt.Errorf("%w: %s is %s and %s after %s", ErrNotHealthy, name, last.Sync, last.Health, timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// ResourceNode is one resource in an Application's resource tree
+type ResourceNode struct {
+	Group     string `json:"group,omitempty"`
+	Version   string `json:"version"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	// Health is empty for kinds ArgoCD doesn't assess
+	Health        string        `json:"health,omitempty"`
+	HealthMessage string        `json:"healthMessage,omitempty"`
+	ParentRefs    []ResourceRef `json:"parentRefs,omitempty"`
+}
+
+// ResourceRef identifies a resource in the tree
+type ResourceRef struct {
+	Group     string `json:"group,omitempty"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// String returns the resource as Kind/namespace/name
+func (n ResourceNode) String() string {
+	if n.Namespace == "" {
+		return n.Kind + "/" + n.Name
+	}
+	return n.Kind + "/" + n.Namespace + "/" + n.Name
+}
+
+// ResourceTree returns every resource the named Application manages,
+// including children such as ReplicaSets and Pods
+func (c *Client) ResourceTree(ctx context.Context, name string) ([]ResourceNode, error) {
+	var tree struct {
+		Nodes []struct {
+			ResourceRef
+			Version string `json:"version"`
+			Health  *struct {
+				Status  string `json:"status"`
+				Message string `json:"message"`
+			} `json:"health"`
+			ParentRefs []ResourceRef `json:"parentRefs"`
+		} `json:"nodes"`
+	}
+	if err := c.do(ctx, http.MethodGet, appPath(name, "/resource-tree"), nil, &tree); err != nil {
+		return nil, fmt.Errorf("get resource tree of %s: %w", name, err)
+	}
+
+	nodes := make([]ResourceNode, 0, len(tree.Nodes))
+	for _, n := range tree.Nodes {
+		node := ResourceNode{
+			Group:      n.Group,
+			Version:    n.Version,
+			Kind:       n.Kind,
+			Namespace:  n.Namespace,
+			Name:       n.Name,
+			ParentRefs: n.ParentRefs,
+		}
+		if n.Health != nil {
+			node.Health = n.Health.Status
+			node.HealthMessage = n.Health.Message
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
@@ -0,0 +1,236 @@
+// Package argocd is a small client for the ArgoCD REST API, covering what the
+// lab CLI needs: syncing Applications, waiting for them to become healthy and
+// reading their resource trees
+package argocd
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// Namespace is where ArgoCD runs
+	Namespace = "argocd"
+	// TokenEnvVar holds an API token, as with the argocd CLI
+	TokenEnvVar = "ARGOCD_AUTH_TOKEN"
+	// InitialAdminSecret holds the admin password ArgoCD generates on install
+	InitialAdminSecret = "argocd-initial-admin-secret"
+	// DefaultWaitInterval is how often WaitHealthy polls an Application
+	DefaultWaitInterval = 2 * time.Second
+
+	// tokenCookie is how argocd-server accepts tokens besides the
+	// Authorization header, which the API server's service proxy would take
+	// for itself
+	tokenCookie = "argocd.token"
+	// serverProxyPath reaches argocd-server's https port through the API server
+	serverProxyPath = "/api/v1/namespaces/" + Namespace + "/services/https:argocd-server:https/proxy"
+)
+
+var (
+	// ErrNotHealthy means an Application didn't become synced and healthy
+	// before the wait ended
+	ErrNotHealthy = errors.New("application not healthy")
+	// ErrSyncFailed means an Application's sync operation failed
+	ErrSyncFailed = errors.New("sync failed")
+)
+
+var secretGVR = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+
+// APIError is an error response from argocd-server
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("argocd: %s (HTTP %d)", e.Message, e.StatusCode)
+}
+
+// IsNotFound reports whether err is an APIError for a missing resource
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// Client talks to argocd-server's REST API
+type Client struct {
+	baseURL  string
+	token    string
+	http     *http.Client
+	interval time.Duration
+}
+
+// ClientOption is a functional option for configuring Client
+type ClientOption func(*Client)
+
+// WithToken authenticates requests with an ArgoCD API or session token
+func WithToken(token string) ClientOption {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to reach argocd-server
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(c *Client) {
+		c.http = client
+	}
+}
+
+// WithWaitInterval sets how often WaitHealthy polls
+func WithWaitInterval(interval time.Duration) ClientOption {
+	return func(c *Client) {
+		c.interval = interval
+	}
+}
+
+// NewClient returns a client for the argocd-server at baseURL
+func NewClient(baseURL string, opts ...ClientOption) *Client {
+	c := &Client{
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		http:     http.DefaultClient,
+		interval: DefaultWaitInterval,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// NewClientForCluster returns a client that reaches argocd-server through the
+// service proxy of the cluster described by restConfig, so no port-forward or
+// ingress is needed. Without WithToken, it logs in as admin with the password
+// from InitialAdminSecret.
+func NewClientForCluster(ctx context.Context, restConfig *rest.Config, opts ...ClientOption) (*Client, error) {
+	httpClient, err := rest.HTTPClientFor(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("create HTTP client: %w", err)
+	}
+	dyn, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("create dynamic client: %w", err)
+	}
+
+	opts = append([]ClientOption{WithHTTPClient(httpClient)}, opts...)
+	return newClientForCluster(ctx, strings.TrimSuffix(restConfig.Host, "/")+serverProxyPath, dyn, opts...)
+}
+
+// newClientForCluster returns a client for baseURL, logging in with the
+// initial admin secret read through secrets if no token was given
+func newClientForCluster(ctx context.Context, baseURL string, secrets dynamic.Interface, opts ...ClientOption) (*Client, error) {
+	c := NewClient(baseURL, opts...)
+	if c.token != "" {
+		return c, nil
+	}
+
+	secret, err := secrets.Resource(secretGVR).Namespace(Namespace).Get(ctx, InitialAdminSecret, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("no %s set and can't read %s: %w", TokenEnvVar, InitialAdminSecret, err)
+	}
+	encoded, _, _ := unstructured.NestedString(secret.Object, "data", "password")
+	password, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(password) == 0 {
+		return nil, fmt.Errorf("%s has no usable password", InitialAdminSecret)
+	}
+
+	if err := c.Login(ctx, "admin", string(password)); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Login exchanges a username and password for a session token, which is
+// used for later requests
+func (c *Client) Login(ctx context.Context, username, password string) error {
+	var resp struct {
+		Token string `json:"token"`
+	}
+	body := map[string]string{"username": username, "password": password}
+	if err := c.do(ctx, http.MethodPost, "/api/v1/session", body, &resp); err != nil {
+		return fmt.Errorf("log in to argocd: %w", err)
+	}
+	c.token = resp.Token
+	return nil
+}
+
+// do sends a JSON request to path and decodes the JSON response into out,
+// which may be nil
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("encode request: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reqBody)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.AddCookie(&http.Cookie{Name: tokenCookie, Value: c.token})
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr struct {
+			Message string `json:"message"`
+			Error   string `json:"error"`
+		}
+		_ = json.Unmarshal(data, &apiErr)
+		msg := apiErr.Message
+		if msg == "" {
+			msg = apiErr.Error
+		}
+		if msg == "" {
+			msg = http.StatusText(resp.StatusCode)
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: msg}
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decode %s response: %w", path, err)
+	}
+	return nil
+}
+
+// appPath returns the API path of an Application, with an optional suffix
+func appPath(name string, suffix ...string) string {
+	return "/api/v1/applications/" + url.PathEscape(name) + strings.Join(suffix, "")
+}
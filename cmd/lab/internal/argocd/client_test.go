@@ -0,0 +1,207 @@
+package argocd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+// fakeServer is a stand-in for argocd-server that serves one Application,
+// whose state advances through states on each GET
+type fakeServer struct {
+	token  string
+	states []map[string]any
+
+	mu       sync.Mutex
+	gets     int
+	syncBody map[string]any
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/api/v1/session" {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body["username"] != "admin" || body["password"] != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"invalid username or password","message":"invalid username or password"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"token":"` + f.token + `"}`))
+		return
+	}
+
+	if cookie, err := r.Cookie(tokenCookie); err != nil || cookie.Value != f.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"message":"no session information"}`))
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/applications/metallb":
+		state := f.states[min(f.gets, len(f.states)-1)]
+		f.gets++
+		_ = json.NewEncoder(w).Encode(state)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/applications/metallb/sync":
+		_ = json.NewDecoder(r.Body).Decode(&f.syncBody)
+		_, _ = w.Write([]byte(`{}`))
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/applications/metallb/resource-tree":
+		_, _ = w.Write([]byte(`{"nodes":[
+			{"group":"apps","version":"v1","kind":"Deployment","namespace":"metallb","name":"controller","health":{"status":"Healthy"}},
+			{"group":"apps","version":"v1","kind":"ReplicaSet","namespace":"metallb","name":"controller-abc","parentRefs":[{"group":"apps","kind":"Deployment","namespace":"metallb","name":"controller"}],"health":{"status":"Progressing","message":"waiting"}},
+			{"version":"v1","kind":"ConfigMap","namespace":"metallb","name":"config"}
+		]}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":"not found","message":"applications.argoproj.io \"` + r.URL.Path + `\" not found"}`))
+	}
+}
+
+func appState(sync, health, phase string, pending bool) map[string]any {
+	app := map[string]any{
+		"metadata": map[string]any{"name": "metallb"},
+		"status": map[string]any{
+			"sync":   map[string]any{"status": sync, "revision": "abc123"},
+			"health": map[string]any{"status": health},
+		},
+	}
+	if phase != "" {
+		app["status"].(map[string]any)["operationState"] = map[string]any{"phase": phase, "message": "one or more objects failed to apply"}
+	}
+	if pending {
+		app["operation"] = map[string]any{"sync": map[string]any{}}
+	}
+	return app
+}
+
+func newTestClient(t *testing.T, states ...map[string]any) (*Client, *fakeServer) {
+	t.Helper()
+	fake := &fakeServer{token: "tok", states: states}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return NewClient(server.URL, WithToken("tok"), WithWaitInterval(time.Millisecond)), fake
+}
+
+func TestSyncAndWaitHealthy(t *testing.T) {
+	client, fake := newTestClient(t,
+		appState("Synced", "Healthy", "Succeeded", true),
+		appState("OutOfSync", "Progressing", "Running", false),
+		appState("Synced", "Progressing", "Succeeded", false),
+		appState("Synced", "Healthy", "Succeeded", false),
+	)
+	ctx := context.Background()
+
+	if err := client.Sync(ctx, "metallb", SyncOptions{Prune: true}); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if fake.syncBody["prune"] != true {
+		t.Errorf("expected prune in sync request, got %v", fake.syncBody)
+	}
+
+	app, err := client.WaitHealthy(ctx, "metallb", time.Second)
+	if err != nil {
+		t.Fatalf("wait failed: %v", err)
+	}
+	if !app.Healthy() || app.Revision != "abc123" {
+		t.Errorf("unexpected application state %+v", app)
+	}
+	if fake.gets != 4 {
+		t.Errorf("expected to poll until healthy with no pending operation, got %d polls", fake.gets)
+	}
+}
+
+func TestWaitHealthySyncFailed(t *testing.T) {
+	client, _ := newTestClient(t, appState("OutOfSync", "Degraded", "Failed", false))
+
+	app, err := client.WaitHealthy(context.Background(), "metallb", time.Second)
+	if !errors.Is(err, ErrSyncFailed) {
+		t.Fatalf("expected ErrSyncFailed, got %v", err)
+	}
+	if app.Message != "one or more objects failed to apply" {
+		t.Errorf("expected operation message, got %q", app.Message)
+	}
+}
+
+func TestWaitHealthyTimeout(t *testing.T) {
+	client, _ := newTestClient(t, appState("Synced", "Progressing", "", false))
+
+	app, err := client.WaitHealthy(context.Background(), "metallb", 20*time.Millisecond)
+	if !errors.Is(err, ErrNotHealthy) {
+		t.Fatalf("expected ErrNotHealthy, got %v", err)
+	}
+	if app == nil || app.Health != "Progressing" {
+		t.Errorf("expected last seen state, got %+v", app)
+	}
+}
+
+func TestResourceTree(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	nodes, err := client.ResourceTree(context.Background(), "metallb")
+	if err != nil {
+		t.Fatalf("resource tree failed: %v", err)
+	}
+	if len(nodes) != 3 {
+		t.Fatalf("expected 3 nodes, got %+v", nodes)
+	}
+	rs := nodes[1]
+	if rs.String() != "ReplicaSet/metallb/controller-abc" || rs.Health != "Progressing" || rs.HealthMessage != "waiting" {
+		t.Errorf("unexpected node %+v", rs)
+	}
+	if len(rs.ParentRefs) != 1 || rs.ParentRefs[0].Kind != "Deployment" {
+		t.Errorf("expected Deployment parent, got %+v", rs.ParentRefs)
+	}
+	if nodes[2].Health != "" {
+		t.Errorf("expected no health for ConfigMap, got %q", nodes[2].Health)
+	}
+}
+
+func TestApplicationNotFound(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	_, err := client.Application(context.Background(), "missing")
+	if !IsNotFound(err) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestLoginWithInitialAdminSecret(t *testing.T) {
+	fake := &fakeServer{token: "session", states: []map[string]any{appState("Synced", "Healthy", "", false)}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	secret := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]any{"name": InitialAdminSecret, "namespace": Namespace},
+		"data":       map[string]any{"password": "czNjcmV0"}, // s3cret
+	}}
+	secrets := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), secret)
+
+	client, err := newClientForCluster(context.Background(), server.URL, secrets)
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if _, err := client.Application(context.Background(), "metallb"); err != nil {
+		t.Errorf("expected session token to be used, got %v", err)
+	}
+}
+
+func TestLoginWithoutSecret(t *testing.T) {
+	secrets := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+
+	if _, err := newClientForCluster(context.Background(), "http://argocd.invalid", secrets); err == nil {
+		t.Fatal("expected error without token or secret")
+	}
+}
@@ -3,14 +3,19 @@ package helm
 import (
 	"context"
 	"fmt"
+	"io/fs"
+	"maps"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 )
 
 // ChangedChartPaths returns chart paths that have changes relative to the given git ref.
-// If gitRef is empty, defaults to HEAD.
+// If gitRef is empty, defaults to HEAD. Untracked files under k8s/ count as changes,
+// and a change to a library chart under a charts/ directory marks every chart that
+// depends on it through a file:// repository as changed.
 func ChangedChartPaths(ctx context.Context, gitRef string) ([]string, error) {
 	if gitRef == "" {
 		gitRef = "HEAD"
@@ -22,13 +27,23 @@ func ChangedChartPaths(ctx context.Context, gitRef string) ([]string, error) {
 		return nil, fmt.Errorf("git diff: %w", err)
 	}
 
-	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	// New chart directories don't show up in git diff until they're added
+	cmd = exec.CommandContext(ctx, "git", "ls-files", "--others", "--exclude-standard", "--", "k8s/")
+	untracked, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-files: %w", err)
+	}
+
+	lines := slices.Concat(
+		strings.Split(strings.TrimSpace(string(out)), "\n"),
+		strings.Split(strings.TrimSpace(string(untracked)), "\n"),
+	)
 
 	if hasCueConfigChange(lines) {
 		return []string{"k8s"}, nil
 	}
 
-	return findChangedChartDirs(lines), nil
+	return findChangedChartDirs(lines)
 }
 
 // hasCueConfigChange reports whether any changed line is a CUE config file,
@@ -43,9 +58,10 @@ func hasCueConfigChange(lines []string) bool {
 }
 
 // findChangedChartDirs returns the chart directories (nearest ancestor containing a
-// Chart.yaml, excluding vendored charts/ subdirectories) for each changed k8s/ line.
-func findChangedChartDirs(lines []string) []string {
-	chartDirs := map[string]bool{}
+// Chart.yaml, excluding charts/ subdirectories) for each changed k8s/ line. Changed
+// charts inside a charts/ directory are replaced by the charts depending on them.
+func findChangedChartDirs(lines []string) ([]string, error) {
+	changed := map[string]bool{}
 	for _, line := range lines {
 		if line == "" || !strings.HasPrefix(line, "k8s/") {
 			continue
@@ -55,20 +71,68 @@ func findChangedChartDirs(lines []string) []string {
 		for dir != "." && dir != "k8s" {
 			chartYamlPath := filepath.Join(dir, "Chart.yaml")
 			if _, err := os.Stat(chartYamlPath); err == nil {
-				if !isInsideChartsDir(dir) {
-					chartDirs[dir] = true
-				}
+				changed[dir] = true
 				break
 			}
 			dir = filepath.Dir(dir)
 		}
 	}
 
-	result := make([]string, 0, len(chartDirs))
-	for dir := range chartDirs {
-		result = append(result, dir)
+	if slices.ContainsFunc(slices.Collect(maps.Keys(changed)), isInsideChartsDir) {
+		if err := addLocalDependents(changed, "k8s"); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]string, 0, len(changed))
+	for dir := range changed {
+		if !isInsideChartsDir(dir) {
+			result = append(result, dir)
+		}
+	}
+	slices.Sort(result)
+	return result, nil
+}
+
+// addLocalDependents adds every chart under k8sDir that depends, directly or
+// through other local charts, on a chart in changed via a file:// repository
+func addLocalDependents(changed map[string]bool, k8sDir string) error {
+	localDeps := map[string][]string{}
+	err := filepath.WalkDir(k8sDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() != "Chart.yaml" {
+			return nil
+		}
+
+		dir := filepath.Dir(path)
+		deps, err := readChartDependencies(dir)
+		if err != nil {
+			return fmt.Errorf("chart %s: %w", dir, err)
+		}
+		for _, dep := range deps {
+			if rel, ok := strings.CutPrefix(dep.Repository, "file://"); ok {
+				localDeps[dir] = append(localDeps[dir], filepath.Join(dir, rel))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("find local chart dependencies: %w", err)
+	}
+
+	// Propagate until no chart is newly marked, covering libraries of libraries
+	for added := true; added; {
+		added = false
+		for dir, deps := range localDeps {
+			if !changed[dir] && slices.ContainsFunc(deps, func(dep string) bool { return changed[dep] }) {
+				changed[dir] = true
+				added = true
+			}
+		}
 	}
-	return result
+	return nil
 }
 
 func isInsideChartsDir(path string) bool {
@@ -0,0 +1,109 @@
+package helm
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeChart writes a Chart.yaml with the given dependencies section under root/dir
+func writeChart(t *testing.T, root, dir, dependencies string) {
+	t.Helper()
+	chartDir := filepath.Join(root, dir)
+	require.NoError(t, os.MkdirAll(filepath.Join(chartDir, "templates"), 0o750))
+	chart := "apiVersion: v2\nname: " + filepath.Base(dir) + "\nversion: 0.1.0\n" + dependencies
+	require.NoError(t, os.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte(chart), 0o600))
+}
+
+// setupChartTree creates an app depending on a library chart, which itself
+// depends on a base library, next to an app that doesn't, and changes into it
+func setupChartTree(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	writeChart(t, root, "k8s/charts/base", "type: library\n")
+	writeChart(t, root, "k8s/charts/proxy", `type: library
+dependencies:
+  - name: base
+    version: 0.1.0
+    repository: file://../base
+`)
+	writeChart(t, root, "k8s/apps/syncthing", `dependencies:
+  - name: proxy
+    version: 0.1.0
+    repository: file://../../charts/proxy
+`)
+	writeChart(t, root, "k8s/apps/other", `dependencies:
+  - name: redis
+    version: 1.0.0
+    repository: https://example.com
+`)
+	t.Chdir(root)
+	return root
+}
+
+func TestFindChangedChartDirs(t *testing.T) {
+	setupChartTree(t)
+
+	tests := []struct {
+		name  string
+		lines []string
+		want  []string
+	}{
+		{
+			name:  "app chart",
+			lines: []string{"k8s/apps/other/templates/deployment.yaml", "README.md"},
+			want:  []string{"k8s/apps/other"},
+		},
+		{
+			name:  "library chart expands to dependents",
+			lines: []string{"k8s/charts/proxy/templates/_helpers.tpl"},
+			want:  []string{"k8s/apps/syncthing"},
+		},
+		{
+			name:  "library of a library",
+			lines: []string{"k8s/charts/base/Chart.yaml"},
+			want:  []string{"k8s/apps/syncthing"},
+		},
+		{
+			name:  "vendored dependency package",
+			lines: []string{"k8s/apps/other/charts/redis-1.0.0.tgz"},
+			want:  []string{"k8s/apps/other"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findChangedChartDirs(tt.lines)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestChangedChartPathsIncludesUntracked(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	root := setupChartTree(t)
+
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = root
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+
+	// A new chart directory that hasn't been added yet
+	writeChart(t, root, "k8s/apps/notes", "")
+
+	got, err := ChangedChartPaths(t.Context(), "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"k8s/apps/notes"}, got)
+}
@@ -2,6 +2,7 @@ package helm
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -127,6 +128,7 @@ func ParseChartInfo(chartDir string) (ChartInfo, error) {
 //   - Chart.yaml declares dependencies that have no matching .tgz in charts/
 //   - A Chart.lock exists and is newer than the newest .tgz file
 //   - A .tgz exists that doesn't match any declared dependency (stale artifact)
+//   - A file:// dependency, such as a library chart, changed after its .tgz was built
 func NeedsDependencyBuild(chartDir string) (bool, error) {
 	deps, err := readChartDependencies(chartDir)
 	if err != nil {
@@ -155,6 +157,50 @@ func NeedsDependencyBuild(chartDir string) (bool, error) {
 		return true, nil
 	}
 
+	return localDepsNewerThanTgz(chartDir, deps)
+}
+
+// localDepsNewerThanTgz reports whether any file:// dependency has a file modified
+// after the .tgz helm packaged it into, e.g. an edited library chart.
+func localDepsNewerThanTgz(chartDir string, deps []chartDependency) (bool, error) {
+	for _, dep := range deps {
+		rel, ok := strings.CutPrefix(dep.Repository, "file://")
+		if !ok {
+			continue
+		}
+		tgz, err := os.Stat(filepath.Join(chartDir, "charts", dep.Name+"-"+dep.Version+".tgz"))
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("stat %s package: %w", dep.Name, err)
+		}
+
+		newer := false
+		err = filepath.WalkDir(filepath.Join(chartDir, rel), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if info.ModTime().After(tgz.ModTime()) {
+				newer = true
+				return fs.SkipAll
+			}
+			return nil
+		})
+		if err != nil {
+			return false, fmt.Errorf("scan local dependency %s: %w", dep.Name, err)
+		}
+		if newer {
+			return true, nil
+		}
+	}
 	return false, nil
 }
 
@@ -199,3 +199,35 @@ dependencies:
 	require.NoError(t, err)
 	assert.False(t, needs)
 }
+
+func TestNeedsDependencyBuild_LocalDependencyNewerThanTgz(t *testing.T) {
+	tmp := t.TempDir()
+	libDir := filepath.Join(tmp, "charts-src", "lib")
+	require.NoError(t, os.MkdirAll(filepath.Join(libDir, "templates"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(libDir, "Chart.yaml"), []byte("apiVersion: v2\nname: lib\nversion: 0.1.0\ntype: library\n"), 0o600))
+
+	appDir := filepath.Join(tmp, "app")
+	require.NoError(t, os.MkdirAll(filepath.Join(appDir, "charts"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(appDir, "Chart.yaml"), []byte(`
+apiVersion: v2
+dependencies:
+  - name: lib
+    version: 0.1.0
+    repository: file://../charts-src/lib
+`), 0o600))
+	tgzPath := filepath.Join(appDir, "charts", "lib-0.1.0.tgz")
+	require.NoError(t, os.WriteFile(tgzPath, []byte("fake"), 0o600))
+	oldTime := time.Now().Add(-1 * time.Hour)
+	require.NoError(t, os.Chtimes(tgzPath, oldTime, oldTime))
+	require.NoError(t, os.Chtimes(filepath.Join(libDir, "Chart.yaml"), oldTime.Add(-time.Hour), oldTime.Add(-time.Hour)))
+
+	needs, err := NeedsDependencyBuild(appDir)
+	require.NoError(t, err)
+	assert.False(t, needs, "library unchanged since it was packaged")
+
+	require.NoError(t, os.WriteFile(filepath.Join(libDir, "templates", "_helpers.tpl"), []byte("{{- define \"lib.name\" -}}lib{{- end }}\n"), 0o600))
+
+	needs, err = NeedsDependencyBuild(appDir)
+	require.NoError(t, err)
+	assert.True(t, needs, "library edited after it was packaged")
+}
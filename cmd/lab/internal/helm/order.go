@@ -0,0 +1,175 @@
+package helm
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Annotations read from an app's application.yaml to order installs
+const (
+	// SyncWaveAnnotation is ArgoCD's sync wave; lower waves install first
+	SyncWaveAnnotation = "argocd.argoproj.io/sync-wave"
+	// DependsOnAnnotation lists, comma separated, the apps in the same tier
+	// that must be installed before this one
+	DependsOnAnnotation = "lab.homelab/depends-on"
+)
+
+var (
+	// ErrMissingDependency means an app depends on one that isn't being installed
+	ErrMissingDependency = errors.New("missing dependency")
+	// ErrDependencyCycle means apps depend on each other, directly or indirectly
+	ErrDependencyCycle = errors.New("dependency cycle")
+)
+
+// AppNode is an app's position in the install graph
+type AppNode struct {
+	Name      string
+	SyncWave  int
+	DependsOn []string
+}
+
+type applicationMetadata struct {
+	Metadata struct {
+		Annotations map[string]string `yaml:"annotations"`
+	} `yaml:"metadata"`
+}
+
+// ReadAppNode reads the sync wave and dependencies of the app in appDir from
+// its application.yaml. An app without one is in wave 0 with no dependencies.
+func ReadAppNode(appDir string) (AppNode, error) {
+	node := AppNode{Name: filepath.Base(appDir)}
+
+	data, err := os.ReadFile(filepath.Join(appDir, "application.yaml")) //nolint:gosec // appDir is an internal repo-relative path, not user input
+	if err != nil {
+		if os.IsNotExist(err) {
+			return node, nil
+		}
+		return node, fmt.Errorf("read application.yaml: %w", err)
+	}
+
+	var app applicationMetadata
+	if err := yaml.Unmarshal(data, &app); err != nil {
+		return node, fmt.Errorf("parse application.yaml: %w", err)
+	}
+
+	if wave := app.Metadata.Annotations[SyncWaveAnnotation]; wave != "" {
+		node.SyncWave, err = strconv.Atoi(strings.TrimSpace(wave))
+		if err != nil {
+			return node, fmt.Errorf("%s: invalid %s %q: %w", node.Name, SyncWaveAnnotation, wave, err)
+		}
+	}
+
+	for dep := range strings.SplitSeq(app.Metadata.Annotations[DependsOnAnnotation], ",") {
+		if dep = strings.TrimSpace(dep); dep != "" {
+			node.DependsOn = append(node.DependsOn, dep)
+		}
+	}
+
+	return node, nil
+}
+
+// InstallOrder sorts apps so each comes after everything it depends on and
+// lower sync waves come before higher ones, breaking ties by name. An app
+// that depends on one in a later wave is reported as a cycle, since the two
+// orderings can't both hold. All missing dependencies and cycles are joined
+// into the returned error.
+func InstallOrder(apps []AppNode) ([]string, error) {
+	byName := make(map[string]AppNode, len(apps))
+	for _, app := range apps {
+		byName[app.Name] = app
+	}
+
+	var errs []error
+	for _, app := range apps {
+		for _, dep := range app.DependsOn {
+			depNode, ok := byName[dep]
+			switch {
+			case !ok:
+				errs = append(errs, fmt.Errorf("%w: %s depends on %s, which is not enabled or has no directory", ErrMissingDependency, app.Name, dep))
+			case depNode.SyncWave > app.SyncWave:
+				errs = append(errs, fmt.Errorf("%w: %s (wave %d) depends on %s (wave %d)", ErrDependencyCycle, app.Name, app.SyncWave, dep, depNode.SyncWave))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	remaining := make(map[string]int, len(apps)) // unmet dependency count
+	dependents := make(map[string][]string, len(apps))
+	for _, app := range apps {
+		deps := slices.Compact(slices.Sorted(slices.Values(app.DependsOn)))
+		remaining[app.Name] = len(deps)
+		for _, dep := range deps {
+			dependents[dep] = append(dependents[dep], app.Name)
+		}
+	}
+
+	var ready []AppNode
+	for _, app := range apps {
+		if remaining[app.Name] == 0 {
+			ready = append(ready, app)
+		}
+	}
+
+	order := make([]string, 0, len(apps))
+	for len(ready) > 0 {
+		slices.SortFunc(ready, func(a, b AppNode) int {
+			return cmp.Or(cmp.Compare(a.SyncWave, b.SyncWave), cmp.Compare(a.Name, b.Name))
+		})
+		next := ready[0]
+		ready = ready[1:]
+		order = append(order, next.Name)
+
+		for _, name := range dependents[next.Name] {
+			remaining[name]--
+			if remaining[name] == 0 {
+				ready = append(ready, byName[name])
+			}
+		}
+	}
+
+	if len(order) < len(apps) {
+		return nil, fmt.Errorf("%w: %s", ErrDependencyCycle, strings.Join(findCycle(byName, remaining), " -> "))
+	}
+	return order, nil
+}
+
+// findCycle returns one dependency cycle among the apps that still have unmet
+// dependencies, starting and ending with the same app
+func findCycle(byName map[string]AppNode, remaining map[string]int) []string {
+	var stuck []string
+	for name, n := range remaining {
+		if n > 0 {
+			stuck = append(stuck, name)
+		}
+	}
+	slices.Sort(stuck)
+
+	// Every stuck app has a stuck dependency, so following them from any
+	// stuck app must eventually revisit one
+	seen := map[string]int{}
+	var path []string
+	for name := stuck[0]; ; {
+		if i, ok := seen[name]; ok {
+			return append(path[i:], name)
+		}
+		seen[name] = len(path)
+		path = append(path, name)
+
+		for _, dep := range slices.Sorted(slices.Values(byName[name].DependsOn)) {
+			if remaining[dep] > 0 {
+				name = dep
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package helm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAppNode(t *testing.T) {
+	appDir := filepath.Join(t.TempDir(), "traefik")
+	require.NoError(t, os.MkdirAll(appDir, 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(appDir, "application.yaml"), []byte(`
+metadata:
+  annotations:
+    argocd.argoproj.io/sync-wave: "-2"
+    lab.homelab/depends-on: gateway-api, metallb
+`), 0o600))
+
+	node, err := ReadAppNode(appDir)
+	require.NoError(t, err)
+
+	assert.Equal(t, AppNode{Name: "traefik", SyncWave: -2, DependsOn: []string{"gateway-api", "metallb"}}, node)
+}
+
+func TestReadAppNodeNoApplicationYaml(t *testing.T) {
+	appDir := filepath.Join(t.TempDir(), "kured")
+	require.NoError(t, os.MkdirAll(appDir, 0o750))
+
+	node, err := ReadAppNode(appDir)
+	require.NoError(t, err)
+
+	assert.Equal(t, AppNode{Name: "kured"}, node)
+}
+
+func TestReadAppNodeInvalidWave(t *testing.T) {
+	appDir := filepath.Join(t.TempDir(), "kured")
+	require.NoError(t, os.MkdirAll(appDir, 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(appDir, "application.yaml"), []byte(`
+metadata:
+  annotations:
+    argocd.argoproj.io/sync-wave: first
+`), 0o600))
+
+	_, err := ReadAppNode(appDir)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid argocd.argoproj.io/sync-wave")
+}
+
+func TestInstallOrder(t *testing.T) {
+	order, err := InstallOrder([]AppNode{
+		{Name: "traefik", DependsOn: []string{"gateway-api", "metallb"}},
+		{Name: "argocd", SyncWave: -1},
+		{Name: "gateway-api"},
+		{Name: "metallb", SyncWave: -2},
+		{Name: "cert-system", SyncWave: -3},
+		{Name: "secret-system", SyncWave: -4},
+		{Name: "cnpg-system"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"secret-system", "cert-system", "metallb", "argocd",
+		"cnpg-system", "gateway-api", "traefik",
+	}, order)
+}
+
+func TestInstallOrderDependencyBeforeDependentInSameWave(t *testing.T) {
+	order, err := InstallOrder([]AppNode{
+		{Name: "a", DependsOn: []string{"z"}},
+		{Name: "b"},
+		{Name: "z"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"b", "z", "a"}, order)
+}
+
+func TestInstallOrderMissingDependency(t *testing.T) {
+	_, err := InstallOrder([]AppNode{
+		{Name: "traefik", DependsOn: []string{"gateway-api"}},
+		{Name: "kured", DependsOn: []string{"node-feature-discovery"}},
+	})
+	require.ErrorIs(t, err, ErrMissingDependency)
+	assert.Contains(t, err.Error(), "traefik depends on gateway-api")
+	assert.Contains(t, err.Error(), "kured depends on node-feature-discovery")
+}
+
+func TestInstallOrderCycle(t *testing.T) {
+	_, err := InstallOrder([]AppNode{
+		{Name: "a", DependsOn: []string{"b"}},
+		{Name: "b", DependsOn: []string{"c"}},
+		{Name: "c", DependsOn: []string{"a"}},
+		{Name: "d"},
+	})
+	require.ErrorIs(t, err, ErrDependencyCycle)
+	assert.Contains(t, err.Error(), "a -> b -> c -> a")
+}
+
+func TestInstallOrderDependencyInLaterWave(t *testing.T) {
+	_, err := InstallOrder([]AppNode{
+		{Name: "argocd", SyncWave: -1, DependsOn: []string{"traefik"}},
+		{Name: "traefik"},
+	})
+	require.ErrorIs(t, err, ErrDependencyCycle)
+	assert.Contains(t, err.Error(), "argocd (wave -1) depends on traefik (wave 0)")
+}
@@ -0,0 +1,177 @@
+package helm
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// OAuth2ProxyChartVersion is the upstream oauth2-proxy chart version new
+// charts pin. Existing consumers pin their own.
+const OAuth2ProxyChartVersion = "10.7.0"
+
+// oauth2ProxyInstanceDir is the shared library chart for dedicated
+// oauth2-proxy instances, relative to the k8s directory
+const oauth2ProxyInstanceDir = "charts/oauth2-proxy-instance"
+
+// scaffoldFiles holds the chart skeleton. Templates use [[ ]] delimiters so
+// the Helm template syntax in them passes through untouched.
+//
+//go:embed all:scaffold
+var scaffoldFiles embed.FS
+
+// ScaffoldOptions describes a new chart
+type ScaffoldOptions struct {
+	Tier        string
+	Name        string
+	Description string
+	// Namespace and ReleaseName default to Name
+	Namespace   string
+	ReleaseName string
+	// Repository and AppVersion are the container image and its tag
+	Repository string
+	AppVersion string
+	Port       int
+	// RepoURL is the git repository ArgoCD syncs the chart from
+	RepoURL string
+
+	// Route adds an HTTPRoute for Host on the internal gateway listener, or
+	// on the public one if Public is set
+	Route  bool
+	Host   string
+	Public bool
+	// OAuth2Proxy puts a dedicated oauth2-proxy instance in front of the app.
+	// It needs Route.
+	OAuth2Proxy bool
+	// PodCIDR is trusted by oauth2-proxy for forwarded headers
+	PodCIDR string
+}
+
+// scaffoldData is what the skeleton templates see
+type scaffoldData struct {
+	ScaffoldOptions
+	CookieName                 string
+	OAuth2ProxyVersion         string
+	OAuth2ProxyInstanceVersion string
+}
+
+// Scaffold creates the chart skeleton for opts under k8sDir/<tier>/<name>,
+// including the application.yaml ParseChartInfo reads, and returns the files
+// it wrote. It refuses to touch an existing directory.
+func Scaffold(k8sDir string, opts ScaffoldOptions) ([]string, error) {
+	if opts.Namespace == "" {
+		opts.Namespace = opts.Name
+	}
+	if opts.ReleaseName == "" {
+		opts.ReleaseName = opts.Name
+	}
+	if opts.OAuth2Proxy && !opts.Route {
+		return nil, errors.New("an oauth2-proxy instance needs an HTTPRoute in front of it")
+	}
+
+	chartDir := filepath.Join(k8sDir, opts.Tier, opts.Name)
+	if _, err := os.Stat(chartDir); err == nil {
+		return nil, fmt.Errorf("%s already exists", chartDir)
+	}
+
+	data := scaffoldData{
+		ScaffoldOptions:    opts,
+		CookieName:         strings.ReplaceAll(opts.Name, "-", "_"),
+		OAuth2ProxyVersion: OAuth2ProxyChartVersion,
+	}
+	if opts.OAuth2Proxy {
+		version, err := chartVersion(filepath.Join(k8sDir, oauth2ProxyInstanceDir))
+		if err != nil {
+			return nil, err
+		}
+		data.OAuth2ProxyInstanceVersion = version
+	}
+
+	var written []string
+	err := fs.WalkDir(scaffoldFiles, "scaffold", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel := strings.TrimSuffix(strings.TrimPrefix(name, "scaffold/"), ".tmpl")
+		if !scaffoldFileWanted(rel, opts) {
+			return nil
+		}
+
+		content, err := renderScaffoldFile(name, data)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(chartDir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+			return fmt.Errorf("create %s: %w", filepath.Dir(target), err)
+		}
+		if err := os.WriteFile(target, content, 0o600); err != nil {
+			return fmt.Errorf("write %s: %w", target, err)
+		}
+		written = append(written, target)
+		return nil
+	})
+	if err != nil {
+		return written, fmt.Errorf("scaffold chart: %w", err)
+	}
+	return written, nil
+}
+
+// scaffoldFileWanted reports whether the skeleton file rel applies to opts
+func scaffoldFileWanted(rel string, opts ScaffoldOptions) bool {
+	switch path.Base(rel) {
+	case "httproute.yaml":
+		return opts.Route
+	case "oauth2-proxy-instance.yaml":
+		return opts.OAuth2Proxy
+	}
+	return true
+}
+
+// renderScaffoldFile executes the embedded template name with data
+func renderScaffoldFile(name string, data scaffoldData) ([]byte, error) {
+	text, err := scaffoldFiles.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", name, err)
+	}
+	tmpl, err := template.New(path.Base(name)).Delims("[[", "]]").Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("render %s: %w", name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// chartVersion reads the version from the Chart.yaml in chartDir
+func chartVersion(chartDir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(chartDir, "Chart.yaml")) //nolint:gosec // chartDir is an internal repo-relative path, not user input
+	if err != nil {
+		return "", fmt.Errorf("read Chart.yaml: %w", err)
+	}
+	var chart struct {
+		Version string `yaml:"version"`
+	}
+	if err := yaml.Unmarshal(data, &chart); err != nil {
+		return "", fmt.Errorf("parse %s/Chart.yaml: %w", chartDir, err)
+	}
+	if chart.Version == "" {
+		return "", fmt.Errorf("%s/Chart.yaml has no version", chartDir)
+	}
+	return chart.Version, nil
+}
@@ -0,0 +1,84 @@
+package helm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestScaffold(t *testing.T) {
+	k8sDir := filepath.Join(t.TempDir(), "k8s")
+	instanceDir := filepath.Join(k8sDir, "charts", "oauth2-proxy-instance")
+	require.NoError(t, os.MkdirAll(instanceDir, 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(instanceDir, "Chart.yaml"), []byte("name: oauth2-proxy-instance\nversion: 0.2.0\n"), 0o600))
+
+	opts := ScaffoldOptions{
+		Tier:        "apps",
+		Name:        "notes",
+		Description: "Notes app.",
+		Namespace:   "notes-system",
+		ReleaseName: "notes-release",
+		Repository:  "ghcr.io/example/notes",
+		AppVersion:  "1.2.3",
+		Port:        8080,
+		RepoURL:     "https://git.example.com/ops/k8s-homelab",
+		Route:       true,
+		Host:        "notes.example.com",
+		OAuth2Proxy: true,
+		PodCIDR:     "10.42.0.0/16",
+	}
+	files, err := Scaffold(k8sDir, opts)
+	require.NoError(t, err)
+
+	chartDir := filepath.Join(k8sDir, "apps", "notes")
+	assert.ElementsMatch(t, []string{
+		filepath.Join(chartDir, "Chart.yaml"),
+		filepath.Join(chartDir, "values.yaml"),
+		filepath.Join(chartDir, "application.yaml"),
+		filepath.Join(chartDir, "templates", "_helpers.tpl"),
+		filepath.Join(chartDir, "templates", "deployment.yaml"),
+		filepath.Join(chartDir, "templates", "service.yaml"),
+		filepath.Join(chartDir, "templates", "httproute.yaml"),
+		filepath.Join(chartDir, "templates", "oauth2-proxy-instance.yaml"),
+	}, files)
+
+	info, err := ParseChartInfo(chartDir)
+	require.NoError(t, err)
+	assert.Equal(t, "apps", info.Tier)
+	assert.Equal(t, "notes-system", info.Namespace)
+	assert.Equal(t, "notes-release", info.ReleaseName)
+
+	deps, err := readChartDependencies(chartDir)
+	require.NoError(t, err)
+	require.Len(t, deps, 2)
+	assert.Equal(t, chartDependency{Name: "oauth2-proxy-instance", Version: "0.2.0", Repository: "file://../../charts/oauth2-proxy-instance"}, deps[1])
+
+	for _, name := range []string{"values.yaml", "application.yaml"} {
+		data, err := os.ReadFile(filepath.Join(chartDir, name))
+		require.NoError(t, err)
+		var parsed map[string]any
+		require.NoError(t, yaml.Unmarshal(data, &parsed), name)
+	}
+
+	_, err = Scaffold(k8sDir, opts)
+	assert.Error(t, err, "an existing chart must not be overwritten")
+}
+
+func TestScaffoldWithoutRoute(t *testing.T) {
+	k8sDir := filepath.Join(t.TempDir(), "k8s")
+	files, err := Scaffold(k8sDir, ScaffoldOptions{Tier: "platform", Name: "worker", Repository: "worker", AppVersion: "1", Port: 9000, RepoURL: "https://example.com/repo"})
+	require.NoError(t, err)
+	assert.Len(t, files, 6)
+	assert.NoFileExists(t, filepath.Join(k8sDir, "platform", "worker", "templates", "httproute.yaml"))
+
+	deps, err := readChartDependencies(filepath.Join(k8sDir, "platform", "worker"))
+	require.NoError(t, err)
+	assert.Empty(t, deps)
+
+	_, err = Scaffold(k8sDir, ScaffoldOptions{Tier: "platform", Name: "other", OAuth2Proxy: true})
+	assert.Error(t, err, "oauth2-proxy needs a route")
+}
@@ -0,0 +1,141 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+// SuspendedAutoSyncAnnotation holds an Application's automated sync policy
+// while AutoSync.Suspend has it switched off
+const SuspendedAutoSyncAnnotation = "lab.homelab/suspended-auto-sync"
+
+// AutoSyncState describes whether ArgoCD would revert manual changes to an app
+type AutoSyncState struct {
+	// Managed is set if an ArgoCD Application of the same name exists
+	Managed bool `json:"managed"`
+	// Automated is set if the Application syncs automatically
+	Automated bool `json:"automated"`
+	// Suspended is set if Suspend switched automated sync off
+	Suspended bool `json:"suspended"`
+}
+
+// AutoSync switches ArgoCD automated sync off and back on for an
+// Application, e.g. so a manual rollback isn't immediately reverted
+type AutoSync struct {
+	client dynamic.Interface
+}
+
+// NewAutoSync returns an AutoSync for the cluster described by restConfig
+func NewAutoSync(restConfig *rest.Config) (*AutoSync, error) {
+	client, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("create dynamic client: %w", err)
+	}
+	return &AutoSync{client: client}, nil
+}
+
+// newAutoSyncWithClient returns an AutoSync using the given client
+func newAutoSyncWithClient(client dynamic.Interface) *AutoSync {
+	return &AutoSync{client: client}
+}
+
+// State reports whether app is an ArgoCD Application with automated sync.
+// A cluster without ArgoCD has no managed apps.
+func (a *AutoSync) State(ctx context.Context, app string) (AutoSyncState, error) {
+	obj, err := a.get(ctx, app)
+	if err != nil || obj == nil {
+		return AutoSyncState{}, err
+	}
+
+	_, automated, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "syncPolicy", "automated")
+	_, suspended := obj.GetAnnotations()[SuspendedAutoSyncAnnotation]
+	return AutoSyncState{Managed: true, Automated: automated, Suspended: suspended}, nil
+}
+
+// Suspend switches automated sync off for app, keeping the policy in
+// SuspendedAutoSyncAnnotation so Resume can restore it. It does nothing if
+// automated sync is already off.
+func (a *AutoSync) Suspend(ctx context.Context, app string) error {
+	obj, err := a.get(ctx, app)
+	if err != nil {
+		return err
+	}
+	if obj == nil {
+		return fmt.Errorf("application %s not found", app)
+	}
+
+	automated, found, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "syncPolicy", "automated")
+	if !found {
+		return nil
+	}
+	policy, err := json.Marshal(automated)
+	if err != nil {
+		return fmt.Errorf("encode automated sync policy: %w", err)
+	}
+
+	return a.patch(ctx, app, map[string]any{
+		"metadata": map[string]any{"annotations": map[string]any{SuspendedAutoSyncAnnotation: string(policy)}},
+		"spec":     map[string]any{"syncPolicy": map[string]any{"automated": nil}},
+	})
+}
+
+// Resume restores the automated sync policy Suspend switched off, reporting
+// whether there was one to restore
+func (a *AutoSync) Resume(ctx context.Context, app string) (bool, error) {
+	obj, err := a.get(ctx, app)
+	if err != nil || obj == nil {
+		return false, err
+	}
+
+	saved, ok := obj.GetAnnotations()[SuspendedAutoSyncAnnotation]
+	if !ok {
+		return false, nil
+	}
+	var automated map[string]any
+	if err := json.Unmarshal([]byte(saved), &automated); err != nil {
+		return false, fmt.Errorf("decode %s annotation: %w", SuspendedAutoSyncAnnotation, err)
+	}
+	if automated == nil {
+		automated = map[string]any{}
+	}
+
+	err = a.patch(ctx, app, map[string]any{
+		"metadata": map[string]any{"annotations": map[string]any{SuspendedAutoSyncAnnotation: nil}},
+		"spec":     map[string]any{"syncPolicy": map[string]any{"automated": automated}},
+	})
+	return err == nil, err
+}
+
+// get returns the Application named app, or nil if it or ArgoCD doesn't exist
+func (a *AutoSync) get(ctx context.Context, app string) (*unstructured.Unstructured, error) {
+	obj, err := a.client.Resource(applicationGVR).Namespace(ArgoCDNamespace).Get(ctx, app, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get application %s: %w", app, err)
+	}
+	return obj, nil
+}
+
+// patch applies a JSON merge patch to the Application named app
+func (a *AutoSync) patch(ctx context.Context, app string, patch map[string]any) error {
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return fmt.Errorf("encode patch: %w", err)
+	}
+	_, err = a.client.Resource(applicationGVR).Namespace(ArgoCDNamespace).Patch(ctx, app, types.MergePatchType, data, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("patch application %s: %w", app, err)
+	}
+	return nil
+}
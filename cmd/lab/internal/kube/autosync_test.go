@@ -0,0 +1,71 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestAutoSyncSuspendResume(t *testing.T) {
+	app := application("forgejo", "Synced", "Healthy")
+	app.Object["spec"].(map[string]any)["syncPolicy"] = map[string]any{
+		"automated":   map[string]any{"prune": true, "selfHeal": true},
+		"syncOptions": []any{"CreateNamespace=true"},
+	}
+	client := newTestStatusClient(app)
+	autoSync := newAutoSyncWithClient(client)
+	ctx := context.Background()
+
+	state, err := autoSync.State(ctx, "forgejo")
+	if err != nil {
+		t.Fatalf("state failed: %v", err)
+	}
+	if state != (AutoSyncState{Managed: true, Automated: true}) {
+		t.Errorf("expected managed automated app, got %+v", state)
+	}
+
+	if err := autoSync.Suspend(ctx, "forgejo"); err != nil {
+		t.Fatalf("suspend failed: %v", err)
+	}
+	if state, _ = autoSync.State(ctx, "forgejo"); state != (AutoSyncState{Managed: true, Suspended: true}) {
+		t.Errorf("expected suspended app, got %+v", state)
+	}
+
+	resumed, err := autoSync.Resume(ctx, "forgejo")
+	if err != nil || !resumed {
+		t.Fatalf("expected resume, got %v (err %v)", resumed, err)
+	}
+	live, err := client.Resource(applicationGVR).Namespace(ArgoCDNamespace).Get(ctx, "forgejo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	selfHeal, _, _ := unstructured.NestedBool(live.Object, "spec", "syncPolicy", "automated", "selfHeal")
+	options, _, _ := unstructured.NestedStringSlice(live.Object, "spec", "syncPolicy", "syncOptions")
+	if !selfHeal || len(options) != 1 {
+		t.Errorf("expected original sync policy to be restored, got %v", live.Object["spec"])
+	}
+	if _, ok := live.GetAnnotations()[SuspendedAutoSyncAnnotation]; ok {
+		t.Error("expected suspended annotation to be removed")
+	}
+
+	if resumed, err = autoSync.Resume(ctx, "forgejo"); err != nil || resumed {
+		t.Errorf("expected nothing to resume, got %v (err %v)", resumed, err)
+	}
+}
+
+func TestAutoSyncUnmanaged(t *testing.T) {
+	autoSync := newAutoSyncWithClient(newTestStatusClient())
+
+	state, err := autoSync.State(context.Background(), "homepage")
+	if err != nil {
+		t.Fatalf("state failed: %v", err)
+	}
+	if state.Managed {
+		t.Errorf("expected unmanaged app, got %+v", state)
+	}
+	if err := autoSync.Suspend(context.Background(), "homepage"); err == nil {
+		t.Error("expected suspending an unmanaged app to fail")
+	}
+}
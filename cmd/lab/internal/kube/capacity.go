@@ -0,0 +1,299 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Where a NodeCapacity came from
+const (
+	CapacitySourceCluster = "cluster"
+	CapacitySourceFacter  = "facter"
+)
+
+// Resources is an amount of CPU and memory requested and limited. CPU is in
+// millicores and memory in bytes.
+type Resources struct {
+	CPURequests    int64 `json:"cpu_requests_millis"`
+	CPULimits      int64 `json:"cpu_limits_millis"`
+	MemoryRequests int64 `json:"memory_requests_bytes"`
+	MemoryLimits   int64 `json:"memory_limits_bytes"`
+}
+
+// Add adds other to r
+func (r *Resources) Add(other Resources) {
+	r.CPURequests += other.CPURequests
+	r.CPULimits += other.CPULimits
+	r.MemoryRequests += other.MemoryRequests
+	r.MemoryLimits += other.MemoryLimits
+}
+
+// scale returns r multiplied by n
+func (r Resources) scale(n int64) Resources {
+	return Resources{
+		CPURequests:    r.CPURequests * n,
+		CPULimits:      r.CPULimits * n,
+		MemoryRequests: r.MemoryRequests * n,
+		MemoryLimits:   r.MemoryLimits * n,
+	}
+}
+
+// max returns the larger of r and other for each field
+func (r Resources) max(other Resources) Resources {
+	return Resources{
+		CPURequests:    max(r.CPURequests, other.CPURequests),
+		CPULimits:      max(r.CPULimits, other.CPULimits),
+		MemoryRequests: max(r.MemoryRequests, other.MemoryRequests),
+		MemoryLimits:   max(r.MemoryLimits, other.MemoryLimits),
+	}
+}
+
+// WorkloadResources returns the resources obj's pods request and limit in
+// total: the pod's resources times the number of pods it runs. DaemonSets run
+// one pod on each of nodes, CronJobs are counted as one Job at a time and
+// objects without a pod spec have none.
+func WorkloadResources(obj *unstructured.Unstructured, nodes int) Resources {
+	path, ok := podSpecPaths[obj.GetKind()]
+	if !ok {
+		return Resources{}
+	}
+	spec, found, _ := unstructured.NestedMap(obj.Object, path...)
+	if !found {
+		return Resources{}
+	}
+	return podResources(spec).scale(podCount(obj, nodes))
+}
+
+// podCount returns how many pods obj runs at once
+func podCount(obj *unstructured.Unstructured, nodes int) int64 {
+	switch obj.GetKind() {
+	case "DaemonSet":
+		return int64(nodes)
+	case "Deployment", "StatefulSet", "ReplicaSet":
+		if replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas"); found {
+			return replicas
+		}
+	case "Job":
+		if parallelism, found, _ := unstructured.NestedInt64(obj.Object, "spec", "parallelism"); found {
+			return parallelism
+		}
+	case "CronJob":
+		if parallelism, found, _ := unstructured.NestedInt64(obj.Object, "spec", "jobTemplate", "spec", "parallelism"); found {
+			return parallelism
+		}
+	}
+	return 1
+}
+
+// podResources returns the effective resources of a pod spec the way the
+// scheduler sees them: the sum of its containers, or its largest init
+// container if that is more, plus the pod overhead
+func podResources(spec map[string]any) Resources {
+	var total, init Resources
+	containers, _, _ := unstructured.NestedSlice(spec, "containers")
+	for _, c := range containers {
+		total.Add(containerResources(c))
+	}
+	initContainers, _, _ := unstructured.NestedSlice(spec, "initContainers")
+	for _, c := range initContainers {
+		init = init.max(containerResources(c))
+	}
+	total = total.max(init)
+
+	overhead, _, _ := unstructured.NestedStringMap(spec, "overhead")
+	total.Add(Resources{
+		CPURequests:    milliValue(overhead[string(corev1.ResourceCPU)]),
+		CPULimits:      milliValue(overhead[string(corev1.ResourceCPU)]),
+		MemoryRequests: value(overhead[string(corev1.ResourceMemory)]),
+		MemoryLimits:   value(overhead[string(corev1.ResourceMemory)]),
+	})
+	return total
+}
+
+// containerResources reads a container's requests and limits. Like the API
+// server, a limit without a request counts as the request too.
+func containerResources(c any) Resources {
+	container, ok := c.(map[string]any)
+	if !ok {
+		return Resources{}
+	}
+	requests := quantities(container, "requests")
+	limits := quantities(container, "limits")
+	for name, limit := range limits {
+		if _, ok := requests[name]; !ok {
+			requests[name] = limit
+		}
+	}
+
+	return Resources{
+		CPURequests:    milliValue(requests[string(corev1.ResourceCPU)]),
+		CPULimits:      milliValue(limits[string(corev1.ResourceCPU)]),
+		MemoryRequests: value(requests[string(corev1.ResourceMemory)]),
+		MemoryLimits:   value(limits[string(corev1.ResourceMemory)]),
+	}
+}
+
+// quantities returns container.resources.<field> as strings. Helm renders
+// plain numbers (cpu: 1) as integers, so those are converted too.
+func quantities(container map[string]any, field string) map[string]string {
+	out := map[string]string{}
+	values, _, _ := unstructured.NestedMap(container, "resources", field)
+	for name, v := range values {
+		switch v := v.(type) {
+		case string:
+			out[name] = v
+		case int64, float64:
+			out[name] = fmt.Sprint(v)
+		}
+	}
+	return out
+}
+
+// milliValue parses a quantity in thousandths, treating unparsable or empty
+// quantities as zero
+func milliValue(s string) int64 {
+	q, err := resource.ParseQuantity(s)
+	if err != nil {
+		return 0
+	}
+	return q.MilliValue()
+}
+
+// value parses a quantity, treating unparsable or empty quantities as zero
+func value(s string) int64 {
+	q, err := resource.ParseQuantity(s)
+	if err != nil {
+		return 0
+	}
+	return q.Value()
+}
+
+// NodeCapacity is the CPU and memory one node offers to pods
+type NodeCapacity struct {
+	Name string `json:"name"`
+	// CPU is in millicores
+	CPU int64 `json:"cpu_millis"`
+	// Memory is in bytes
+	Memory int64 `json:"memory_bytes"`
+	// Source is CapacitySourceCluster for allocatable resources reported by
+	// the node, or CapacitySourceFacter for hardware read from facter.json
+	Source string `json:"source"`
+}
+
+// NodeCapacities returns the allocatable CPU and memory of every cluster
+// node, sorted by name
+func (s *StatusReader) NodeCapacities(ctx context.Context) ([]NodeCapacity, error) {
+	list, err := s.client.Resource(nodeGVR).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list nodes: %w", err)
+	}
+
+	nodes := make([]NodeCapacity, 0, len(list.Items))
+	for _, item := range list.Items {
+		var node corev1.Node
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &node); err != nil {
+			return nil, fmt.Errorf("decode node %s: %w", item.GetName(), err)
+		}
+		nodes = append(nodes, NodeCapacity{
+			Name:   node.Name,
+			CPU:    node.Status.Allocatable.Cpu().MilliValue(),
+			Memory: node.Status.Allocatable.Memory().Value(),
+			Source: CapacitySourceCluster,
+		})
+	}
+
+	slices.SortFunc(nodes, func(a, b NodeCapacity) int { return strings.Compare(a.Name, b.Name) })
+	return nodes, nil
+}
+
+// facterReport is the part of a nixos-facter report capacity needs
+type facterReport struct {
+	Hardware struct {
+		CPU []struct {
+			PhysicalID int `json:"physical_id"`
+			// Siblings counts the logical CPUs (threads) of the package
+			Siblings int `json:"siblings"`
+		} `json:"cpu"`
+		Memory []struct {
+			Resources []struct {
+				Type  string `json:"type"`
+				Range int64  `json:"range"`
+			} `json:"resources"`
+		} `json:"memory"`
+	} `json:"hardware"`
+}
+
+// FacterCapacity reads a host's CPU and memory from the nixos-facter report
+// at path. This is the raw hardware, so it overstates what the kubelet offers
+// to pods by whatever the system reserves.
+func FacterCapacity(name, path string) (NodeCapacity, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // path is built from host names in the CUE config
+	if err != nil {
+		return NodeCapacity{}, fmt.Errorf("read facter report: %w", err)
+	}
+	var report facterReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return NodeCapacity{}, fmt.Errorf("parse facter report %s: %w", path, err)
+	}
+
+	capacity := NodeCapacity{Name: name, Source: CapacitySourceFacter}
+	// facter lists each CPU package once per logical CPU or once in total,
+	// depending on the version, so count each physical ID once
+	seen := map[int]bool{}
+	for _, cpu := range report.Hardware.CPU {
+		if !seen[cpu.PhysicalID] {
+			seen[cpu.PhysicalID] = true
+			capacity.CPU += int64(cpu.Siblings) * 1000
+		}
+	}
+	for _, mem := range report.Hardware.Memory {
+		for _, r := range mem.Resources {
+			if r.Type == "phys_mem" {
+				capacity.Memory += r.Range
+			}
+		}
+	}
+
+	if capacity.CPU == 0 || capacity.Memory == 0 {
+		return NodeCapacity{}, fmt.Errorf("facter report %s has no CPU or memory information", path)
+	}
+	return capacity, nil
+}
+
+// ClusterCapacity is the combined capacity of a set of nodes
+type ClusterCapacity struct {
+	// CPU and Memory are the totals of all nodes
+	CPU    int64 `json:"cpu_millis"`
+	Memory int64 `json:"memory_bytes"`
+	// SpareCPU and SpareMemory are what is left after losing the node with
+	// the most of each, i.e. what requests must fit into to survive any one
+	// node going down
+	SpareCPU    int64 `json:"spare_cpu_millis"`
+	SpareMemory int64 `json:"spare_memory_bytes"`
+}
+
+// TotalCapacity sums the capacity of nodes, and what remains of it without
+// the largest node
+func TotalCapacity(nodes []NodeCapacity) ClusterCapacity {
+	var total ClusterCapacity
+	var largestCPU, largestMemory int64
+	for _, n := range nodes {
+		total.CPU += n.CPU
+		total.Memory += n.Memory
+		largestCPU = max(largestCPU, n.CPU)
+		largestMemory = max(largestMemory, n.Memory)
+	}
+	total.SpareCPU = total.CPU - largestCPU
+	total.SpareMemory = total.Memory - largestMemory
+	return total
+}
@@ -0,0 +1,108 @@
+package kube
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestWorkloadResources(t *testing.T) {
+	deployment := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]any{"name": "web"},
+		"spec": map[string]any{
+			"replicas": int64(3),
+			"template": map[string]any{"spec": map[string]any{
+				"initContainers": []any{map[string]any{"name": "migrate", "resources": map[string]any{
+					"requests": map[string]any{"cpu": "2", "memory": "64Mi"},
+				}}},
+				"containers": []any{
+					map[string]any{"name": "app", "resources": map[string]any{
+						"requests": map[string]any{"cpu": "250m", "memory": "128Mi"},
+						"limits":   map[string]any{"cpu": int64(1), "memory": "256Mi"},
+					}},
+					// A limit without a request is also the request
+					map[string]any{"name": "sidecar", "resources": map[string]any{
+						"limits": map[string]any{"memory": "32Mi"},
+					}},
+				},
+			}},
+		},
+	}}
+
+	want := Resources{
+		CPURequests:    3 * 2000, // the init container needs more than the containers
+		CPULimits:      3 * 1000,
+		MemoryRequests: 3 * 160 << 20,
+		MemoryLimits:   3 * 288 << 20,
+	}
+	if got := WorkloadResources(deployment, 4); got != want {
+		t.Errorf("WorkloadResources(deployment) = %+v, want %+v", got, want)
+	}
+
+	daemonSet := deployment.DeepCopy()
+	daemonSet.SetKind("DaemonSet")
+	if got := WorkloadResources(daemonSet, 4); got.CPULimits != 4*1000 {
+		t.Errorf("expected a DaemonSet pod per node, got %+v", got)
+	}
+
+	if got := WorkloadResources(configMap("demo", nil, nil), 4); got != (Resources{}) {
+		t.Errorf("expected no resources for a ConfigMap, got %+v", got)
+	}
+}
+
+func TestNodeCapacities(t *testing.T) {
+	small := node("borg-1", true)
+	big := node("borg-0", true)
+	_ = unstructured.SetNestedStringMap(small.Object, map[string]string{"cpu": "8", "memory": "32Gi"}, "status", "allocatable")
+	_ = unstructured.SetNestedStringMap(big.Object, map[string]string{"cpu": "24", "memory": "128Gi"}, "status", "allocatable")
+
+	nodes, err := newStatusReaderWithClient(newTestStatusClient(small, big)).NodeCapacities(t.Context())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []NodeCapacity{
+		{Name: "borg-0", CPU: 24000, Memory: 128 << 30, Source: CapacitySourceCluster},
+		{Name: "borg-1", CPU: 8000, Memory: 32 << 30, Source: CapacitySourceCluster},
+	}
+	if !slices.Equal(nodes, want) {
+		t.Fatalf("NodeCapacities() = %+v, want %+v", nodes, want)
+	}
+
+	total := TotalCapacity(nodes)
+	if total.CPU != 32000 || total.SpareCPU != 8000 || total.Memory != 160<<30 || total.SpareMemory != 32<<30 {
+		t.Errorf("unexpected total capacity %+v", total)
+	}
+}
+
+func TestFacterCapacity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "facter.json")
+	report := `{"hardware": {
+		"cpu": [{"physical_id": 0, "siblings": 12, "cores": 6}],
+		"memory": [{"resources": [{"type": "mem", "range": 1000}, {"type": "phys_mem", "range": 34359738368}]}]
+	}}`
+	if err := os.WriteFile(path, []byte(report), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := FacterCapacity("borg-3", path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := NodeCapacity{Name: "borg-3", CPU: 12000, Memory: 32 << 30, Source: CapacitySourceFacter}
+	if got != want {
+		t.Errorf("FacterCapacity() = %+v, want %+v", got, want)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"hardware": {}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FacterCapacity("borg-3", path); err == nil {
+		t.Error("expected an error for a report without CPU or memory")
+	}
+}
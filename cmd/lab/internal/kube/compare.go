@@ -0,0 +1,127 @@
+package kube
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// chartLabels are labels helm charts put on every object. Their values track
+// the chart version rather than the resource, so they're ignored when
+// comparing renders.
+var chartLabels = []string{"helm.sh/chart", "app.kubernetes.io/version", "chart", "heritage"}
+
+// checksumAnnotationPrefix marks pod template annotations charts use to roll
+// pods when a ConfigMap or Secret changes. The change they track shows up in
+// the ConfigMap or Secret itself.
+const checksumAnnotationPrefix = "checksum/"
+
+// CompareManifests diffs two renders of the same manifests without a cluster.
+// Objects are matched by group, kind, namespace and name; objects only in head
+// are added and objects only in base are removed. Chart version labels and
+// checksum annotations are ignored anywhere in an object, so bumping a chart
+// only reports the resources whose content changed. Results follow head's
+// order, followed by removed objects in base's order.
+func CompareManifests(base, head []*unstructured.Unstructured) ([]ResourceDiff, error) {
+	baseByKey := make(map[string]*unstructured.Unstructured, len(base))
+	for _, obj := range base {
+		if !isHelmTestHook(obj) {
+			baseByKey[objectKey(obj)] = obj
+		}
+	}
+
+	results := make([]ResourceDiff, 0, len(head))
+	seen := map[string]bool{}
+	for _, obj := range head {
+		if isHelmTestHook(obj) {
+			continue
+		}
+		key := objectKey(obj)
+		seen[key] = true
+
+		result := ResourceDiff{APIVersion: obj.GetAPIVersion(), Kind: obj.GetKind(), Namespace: obj.GetNamespace(), Name: obj.GetName()}
+		before, ok := baseByKey[key]
+		if !ok {
+			result.Change = ChangeAdded
+			results = append(results, result)
+			continue
+		}
+
+		before, after := stripChartNoise(before), stripChartNoise(obj)
+		if equality.Semantic.DeepEqual(before.Object, after.Object) {
+			result.Change = ChangeUnchanged
+			results = append(results, result)
+			continue
+		}
+
+		diff, err := unifiedDiff(result.String(), before, after, "base", "head")
+		if err != nil {
+			return nil, err
+		}
+		result.Change = ChangeChanged
+		result.Diff = diff
+		results = append(results, result)
+	}
+
+	for _, obj := range base {
+		if key := objectKey(obj); !seen[key] && !isHelmTestHook(obj) {
+			seen[key] = true
+			results = append(results, ResourceDiff{
+				APIVersion: obj.GetAPIVersion(),
+				Kind:       obj.GetKind(),
+				Namespace:  obj.GetNamespace(),
+				Name:       obj.GetName(),
+				Change:     ChangeRemoved,
+			})
+		}
+	}
+
+	return results, nil
+}
+
+// objectKey identifies a rendered object independent of API version
+func objectKey(obj *unstructured.Unstructured) string {
+	return resourceKey(obj.GroupVersionKind().GroupKind(), obj.GetNamespace(), obj.GetName())
+}
+
+// stripChartNoise returns a copy of obj without chart version labels or
+// checksum annotations, wherever they're nested (pod templates, job templates)
+func stripChartNoise(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	out := obj.DeepCopy()
+	stripChartNoiseIn(out.Object)
+	return out
+}
+
+// stripChartNoiseIn walks v, removing chart labels from every "labels" map and
+// checksum annotations from every "annotations" map
+func stripChartNoiseIn(v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, child := range v {
+			m, ok := child.(map[string]any)
+			switch {
+			case key == "labels" && ok:
+				for _, label := range chartLabels {
+					delete(m, label)
+				}
+			case key == "annotations" && ok:
+				for name := range m {
+					if strings.HasPrefix(name, checksumAnnotationPrefix) {
+						delete(m, name)
+					}
+				}
+			default:
+				stripChartNoiseIn(child)
+				continue
+			}
+			if len(m) == 0 {
+				delete(v, key)
+			}
+		}
+	case []any:
+		for _, item := range v {
+			stripChartNoiseIn(item)
+		}
+	}
+}
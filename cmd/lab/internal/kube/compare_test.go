@@ -0,0 +1,93 @@
+package kube
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func chartDeployment(chartVersion, image, checksum string) *unstructured.Unstructured {
+	labels := func() map[string]any {
+		return map[string]any{
+			"app.kubernetes.io/name":    "demo",
+			"helm.sh/chart":             "demo-" + chartVersion,
+			"app.kubernetes.io/version": chartVersion,
+		}
+	}
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]any{"name": "demo", "namespace": "demo", "labels": labels()},
+		"spec": map[string]any{
+			"selector": map[string]any{"matchLabels": map[string]any{"app.kubernetes.io/name": "demo"}},
+			"template": map[string]any{
+				"metadata": map[string]any{
+					"labels":      labels(),
+					"annotations": map[string]any{"checksum/config": checksum},
+				},
+				"spec": map[string]any{"containers": []any{map[string]any{"name": "demo", "image": image}}},
+			},
+		},
+	}}
+}
+
+func TestCompareManifests(t *testing.T) {
+	base := []*unstructured.Unstructured{
+		chartDeployment("1.0.0", "demo:1.0", "aaa"),
+		configMap("same", nil, map[string]any{"a": "1"}),
+		configMap("edited", nil, map[string]any{"a": "1"}),
+		configMap("gone", nil, nil),
+	}
+	head := []*unstructured.Unstructured{
+		chartDeployment("1.1.0", "demo:1.0", "bbb"),
+		configMap("same", nil, map[string]any{"a": "1"}),
+		configMap("edited", nil, map[string]any{"a": "2"}),
+		configMap("new", nil, nil),
+	}
+
+	results, err := CompareManifests(base, head)
+	if err != nil {
+		t.Fatalf("compare failed: %v", err)
+	}
+
+	want := []struct {
+		name   string
+		change Change
+	}{
+		{"Deployment/demo/demo", ChangeUnchanged},
+		{"ConfigMap/demo/same", ChangeUnchanged},
+		{"ConfigMap/demo/edited", ChangeChanged},
+		{"ConfigMap/demo/new", ChangeAdded},
+		{"ConfigMap/demo/gone", ChangeRemoved},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("expected %d results, got %+v", len(want), results)
+	}
+	for i, w := range want {
+		if results[i].String() != w.name || results[i].Change != w.change {
+			t.Errorf("result %d: expected %s %s, got %s %s", i, w.name, w.change, results[i], results[i].Change)
+		}
+	}
+
+	diff := results[2].Diff
+	if !strings.Contains(diff, "--- base/ConfigMap/demo/edited") || !strings.Contains(diff, `+  a: "2"`) {
+		t.Errorf("unexpected diff:\n%s", diff)
+	}
+}
+
+func TestCompareManifestsReportsImageChange(t *testing.T) {
+	results, err := CompareManifests(
+		[]*unstructured.Unstructured{chartDeployment("1.0.0", "demo:1.0", "aaa")},
+		[]*unstructured.Unstructured{chartDeployment("1.1.0", "demo:1.1", "aaa")},
+	)
+	if err != nil {
+		t.Fatalf("compare failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Change != ChangeChanged {
+		t.Fatalf("expected changed deployment, got %+v", results)
+	}
+	if strings.Contains(results[0].Diff, "helm.sh/chart") {
+		t.Errorf("expected chart labels to be left out of the diff:\n%s", results[0].Diff)
+	}
+}
@@ -0,0 +1,425 @@
+// Package kube provides client-go based helpers for talking to a cluster
+package kube
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"sigs.k8s.io/yaml"
+)
+
+// Change is what applying a resource would do to the cluster
+type Change string
+
+const (
+	ChangeAdded     Change = "added"
+	ChangeChanged   Change = "changed"
+	ChangeUnchanged Change = "unchanged"
+	// ChangePruned means the resource is live but no longer rendered
+	ChangePruned Change = "pruned"
+	// ChangeRemoved means the resource was rendered at the base of an offline
+	// diff but no longer is
+	ChangeRemoved Change = "removed"
+)
+
+// DefaultFieldManager is the server-side apply field manager used for dry runs
+const DefaultFieldManager = "lab"
+
+// ResourceDiff is the dry-run result for a single resource
+type ResourceDiff struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	Change     Change `json:"change"`
+	// Diff is a unified diff of the live object against the dry-run result
+	Diff string `json:"diff,omitempty"`
+	// Message explains results that couldn't be fully evaluated
+	Message string `json:"message,omitempty"`
+}
+
+// String returns the resource as Kind/namespace/name
+func (r ResourceDiff) String() string {
+	if r.Namespace == "" {
+		return r.Kind + "/" + r.Name
+	}
+	return r.Kind + "/" + r.Namespace + "/" + r.Name
+}
+
+// DiffOptions configures a Differ.Diff call
+type DiffOptions struct {
+	// Namespace is used for namespaced resources that don't set one
+	Namespace string
+	// PruneSelector is a label selector matching the live resources the manifests
+	// own. Matching resources that aren't rendered are reported as pruned.
+	// Empty disables prune detection.
+	PruneSelector string
+	// FieldManager defaults to DefaultFieldManager
+	FieldManager string
+}
+
+// pruneKinds are the resource types checked for would-be-pruned objects in
+// addition to the types being applied, mirroring kubectl apply --prune's
+// default allowlist
+var pruneKinds = []schema.GroupVersionKind{
+	{Version: "v1", Kind: "ConfigMap"},
+	{Version: "v1", Kind: "PersistentVolumeClaim"},
+	{Version: "v1", Kind: "Secret"},
+	{Version: "v1", Kind: "Service"},
+	{Version: "v1", Kind: "ServiceAccount"},
+	{Group: "apps", Version: "v1", Kind: "DaemonSet"},
+	{Group: "apps", Version: "v1", Kind: "Deployment"},
+	{Group: "apps", Version: "v1", Kind: "StatefulSet"},
+	{Group: "batch", Version: "v1", Kind: "CronJob"},
+	{Group: "networking.k8s.io", Version: "v1", Kind: "Ingress"},
+}
+
+// Differ compares rendered manifests against a live cluster using server-side
+// apply in dry-run mode, so defaulting, admission and field ownership are
+// accounted for the same way a real apply would be
+type Differ struct {
+	client dynamic.Interface
+	mapper meta.RESTMapper
+}
+
+// NewDiffer returns a Differ for the cluster described by restConfig
+func NewDiffer(restConfig *rest.Config) (*Differ, error) {
+	client, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("create dynamic client: %w", err)
+	}
+
+	disco, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("create discovery client: %w", err)
+	}
+
+	return &Differ{
+		client: client,
+		mapper: restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(disco)),
+	}, nil
+}
+
+// newDifferWithClients returns a Differ using the given clients
+func newDifferWithClients(client dynamic.Interface, mapper meta.RESTMapper) *Differ {
+	return &Differ{client: client, mapper: mapper}
+}
+
+// ParseManifests decodes a multi-document YAML or JSON stream, such as the
+// output of `helm template`, into objects. Empty documents are skipped and
+// List kinds are flattened.
+func ParseManifests(data []byte) ([]*unstructured.Unstructured, error) {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+
+	var objs []*unstructured.Unstructured
+	for {
+		var raw map[string]any
+		if err := decoder.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("decode manifest: %w", err)
+		}
+		if len(raw) == 0 {
+			continue
+		}
+
+		obj := &unstructured.Unstructured{Object: raw}
+		if obj.IsList() {
+			list, err := obj.ToList()
+			if err != nil {
+				return nil, fmt.Errorf("decode list: %w", err)
+			}
+			for i := range list.Items {
+				objs = append(objs, &list.Items[i])
+			}
+			continue
+		}
+		if obj.GetKind() == "" || obj.GetName() == "" {
+			return nil, fmt.Errorf("manifest is missing kind or metadata.name: %v", raw)
+		}
+		objs = append(objs, obj)
+	}
+
+	return objs, nil
+}
+
+// Diff dry-run applies each object and reports how it would change the cluster.
+// Results are ordered as the objects were, followed by any pruned resources.
+func (d *Differ) Diff(ctx context.Context, objs []*unstructured.Unstructured, opts DiffOptions) ([]ResourceDiff, error) {
+	if opts.FieldManager == "" {
+		opts.FieldManager = DefaultFieldManager
+	}
+
+	results := make([]ResourceDiff, 0, len(objs))
+	rendered := map[string]bool{}
+	gvks := slices.Clone(pruneKinds)
+
+	for _, obj := range objs {
+		if isHelmTestHook(obj) {
+			continue
+		}
+
+		result, err := d.diffObject(ctx, obj, opts)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+		rendered[resourceKey(obj.GroupVersionKind().GroupKind(), result.Namespace, result.Name)] = true
+
+		if gvk := obj.GroupVersionKind(); !slices.Contains(gvks, gvk) {
+			gvks = append(gvks, gvk)
+		}
+	}
+
+	if opts.PruneSelector != "" {
+		pruned, err := d.findPruned(ctx, gvks, rendered, opts.PruneSelector)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, pruned...)
+	}
+
+	return results, nil
+}
+
+// diffObject dry-run applies a single object and compares the result with the live object
+func (d *Differ) diffObject(ctx context.Context, obj *unstructured.Unstructured, opts DiffOptions) (ResourceDiff, error) {
+	gvk := obj.GroupVersionKind()
+	result := ResourceDiff{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+	}
+
+	mapping, err := d.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			// The CRD is typically part of the same render and not installed yet
+			result.Change = ChangeAdded
+			result.Message = "resource type is not registered in the cluster"
+			return result, nil
+		}
+		return result, fmt.Errorf("map %s: %w", gvk, err)
+	}
+
+	var client dynamic.ResourceInterface = d.client.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		if result.Namespace == "" {
+			result.Namespace = opts.Namespace
+		}
+		obj = obj.DeepCopy()
+		obj.SetNamespace(result.Namespace)
+		client = d.client.Resource(mapping.Resource).Namespace(result.Namespace)
+	} else {
+		result.Namespace = ""
+	}
+
+	live, err := client.Get(ctx, result.Name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		live = nil
+	case err != nil:
+		return result, fmt.Errorf("get %s: %w", result, err)
+	}
+
+	applied, err := client.Apply(ctx, result.Name, obj, metav1.ApplyOptions{
+		FieldManager: opts.FieldManager,
+		Force:        true,
+		DryRun:       []string{metav1.DryRunAll},
+	})
+	if err != nil {
+		if apierrors.IsNotFound(err) && live == nil {
+			// The namespace doesn't exist yet, so the server can't dry-run the create
+			result.Change = ChangeAdded
+			result.Message = "namespace does not exist yet"
+			return result, nil
+		}
+		return result, fmt.Errorf("dry-run apply %s: %w", result, err)
+	}
+
+	if live == nil {
+		result.Change = ChangeAdded
+		return result, nil
+	}
+
+	before, after := normalize(live), normalize(applied)
+	if equality.Semantic.DeepEqual(before.Object, after.Object) {
+		result.Change = ChangeUnchanged
+		return result, nil
+	}
+
+	result.Change = ChangeChanged
+	result.Diff, err = unifiedDiff(result.String(), before, after, "live", "merged")
+	if err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// findPruned lists live resources matching selector that weren't rendered.
+// Resources owned by another object are skipped, since their owner manages them.
+func (d *Differ) findPruned(ctx context.Context, gvks []schema.GroupVersionKind, rendered map[string]bool, selector string) ([]ResourceDiff, error) {
+	var pruned []ResourceDiff
+	seen := map[schema.GroupVersionResource]bool{}
+
+	for _, gvk := range gvks {
+		mapping, err := d.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			continue // Not served by this cluster
+		}
+		if seen[mapping.Resource] {
+			continue
+		}
+		seen[mapping.Resource] = true
+
+		list, err := d.client.Resource(mapping.Resource).List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			if apierrors.IsNotFound(err) || apierrors.IsMethodNotSupported(err) || apierrors.IsForbidden(err) {
+				continue
+			}
+			return nil, fmt.Errorf("list %s: %w", mapping.Resource.Resource, err)
+		}
+
+		for _, item := range list.Items {
+			if len(item.GetOwnerReferences()) > 0 {
+				continue
+			}
+			if rendered[resourceKey(gvk.GroupKind(), item.GetNamespace(), item.GetName())] {
+				continue
+			}
+			pruned = append(pruned, ResourceDiff{
+				APIVersion: item.GetAPIVersion(),
+				Kind:       item.GetKind(),
+				Namespace:  item.GetNamespace(),
+				Name:       item.GetName(),
+				Change:     ChangePruned,
+			})
+		}
+	}
+
+	return pruned, nil
+}
+
+// resourceKey identifies a resource independent of API version
+func resourceKey(gk schema.GroupKind, namespace, name string) string {
+	return gk.String() + "/" + namespace + "/" + name
+}
+
+// isHelmTestHook reports whether obj is a `helm test` hook, which is never installed by a sync
+func isHelmTestHook(obj *unstructured.Unstructured) bool {
+	hook := obj.GetAnnotations()["helm.sh/hook"]
+	return slices.ContainsFunc(strings.Split(hook, ","), func(h string) bool {
+		return strings.HasPrefix(strings.TrimSpace(h), "test")
+	})
+}
+
+// normalize strips server-maintained fields that change on every write and
+// would otherwise show up as spurious differences
+func normalize(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	out := obj.DeepCopy()
+	unstructured.RemoveNestedField(out.Object, "metadata", "managedFields")
+	unstructured.RemoveNestedField(out.Object, "metadata", "resourceVersion")
+	unstructured.RemoveNestedField(out.Object, "metadata", "generation")
+	unstructured.RemoveNestedField(out.Object, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(out.Object, "metadata", "uid")
+	unstructured.RemoveNestedField(out.Object, "status")
+	return out
+}
+
+// unifiedDiff renders before and after as YAML and returns their unified
+// diff, with file names prefixed by from and to. Secret values are masked.
+func unifiedDiff(name string, before, after *unstructured.Unstructured, from, to string) (string, error) {
+	before, after = maskSecrets(before, after)
+
+	a, err := yaml.Marshal(before.Object)
+	if err != nil {
+		return "", fmt.Errorf("marshal %s %s: %w", from, name, err)
+	}
+	b, err := yaml.Marshal(after.Object)
+	if err != nil {
+		return "", fmt.Errorf("marshal %s %s: %w", to, name, err)
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(a)),
+		B:        difflib.SplitLines(string(b)),
+		FromFile: from + "/" + name,
+		ToFile:   to + "/" + name,
+		Context:  3,
+	})
+	if err != nil {
+		return "", fmt.Errorf("diff %s: %w", name, err)
+	}
+	return diff, nil
+}
+
+// Masks for Secret values in diffs, as used by kubectl diff
+const (
+	secretMask       = "***"
+	secretMaskBefore = "*** (before)"
+	secretMaskAfter  = "*** (after)"
+)
+
+// maskSecrets returns copies of before and after with the values in a
+// Secret's data and stringData replaced by a fixed mask, so diffs show which
+// keys changed without revealing their contents. Objects that aren't core
+// Secrets are returned unchanged.
+func maskSecrets(before, after *unstructured.Unstructured) (*unstructured.Unstructured, *unstructured.Unstructured) {
+	if !isSecret(before) && !isSecret(after) {
+		return before, after
+	}
+	before, after = before.DeepCopy(), after.DeepCopy()
+	for _, field := range []string{"data", "stringData"} {
+		a, _, _ := unstructured.NestedMap(before.Object, field)
+		b, _, _ := unstructured.NestedMap(after.Object, field)
+		for key, av := range a {
+			bv, ok := b[key]
+			switch {
+			case !ok:
+				a[key] = secretMask
+			case equality.Semantic.DeepEqual(av, bv):
+				a[key], b[key] = secretMask, secretMask
+			default:
+				a[key], b[key] = secretMaskBefore, secretMaskAfter
+			}
+		}
+		for key := range b {
+			if _, ok := a[key]; !ok {
+				b[key] = secretMask
+			}
+		}
+		if a != nil {
+			_ = unstructured.SetNestedMap(before.Object, a, field)
+		}
+		if b != nil {
+			_ = unstructured.SetNestedMap(after.Object, b, field)
+		}
+	}
+	return before, after
+}
+
+// isSecret reports whether obj is a core Secret
+func isSecret(obj *unstructured.Unstructured) bool {
+	gvk := obj.GroupVersionKind()
+	return gvk.Group == "" && gvk.Kind == "Secret"
+}
@@ -0,0 +1,254 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var (
+	configMapGVR = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	namespaceGVR = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+	secretGVR    = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+)
+
+// testMapper knows the core types used in these tests
+func testMapper() meta.RESTMapper {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Secret"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	return mapper
+}
+
+// newTestDiffer returns a Differ whose dry-run applies echo the applied object
+// back with the live object's server-set metadata, like a real API server
+func newTestDiffer(t *testing.T, objects ...runtime.Object) *Differ {
+	t.Helper()
+
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			configMapGVR:  "ConfigMapList",
+			deploymentGVR: "DeploymentList",
+			namespaceGVR:  "NamespaceList",
+			secretGVR:     "SecretList",
+		}, objects...)
+
+	client.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchActionImpl)
+		if len(patch.PatchOptions.DryRun) == 0 {
+			t.Error("expected apply to be a dry run")
+		}
+
+		applied := &unstructured.Unstructured{}
+		if err := json.Unmarshal(patch.GetPatch(), &applied.Object); err != nil {
+			return true, nil, err
+		}
+		live, err := client.Tracker().Get(patch.GetResource(), patch.GetNamespace(), patch.GetName())
+		if err == nil {
+			liveObj := live.(*unstructured.Unstructured)
+			applied.SetUID(liveObj.GetUID())
+			applied.SetResourceVersion("2")
+		}
+		return true, applied, nil
+	})
+
+	return newDifferWithClients(client, testMapper())
+}
+
+func configMap(name string, labels map[string]any, data map[string]any) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]any{"name": name, "namespace": "demo", "labels": labels},
+		"data":       data,
+	}}
+}
+
+func TestParseManifests(t *testing.T) {
+	manifests := `---
+# Source: demo/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+data:
+  key: value
+---
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: a
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: b
+`
+
+	objs, err := ParseManifests([]byte(manifests))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(objs) != 3 {
+		t.Fatalf("expected 3 objects, got %d", len(objs))
+	}
+	if objs[0].GetKind() != "ConfigMap" || objs[2].GetName() != "b" {
+		t.Errorf("unexpected objects: %v, %v", objs[0], objs[2])
+	}
+}
+
+func TestParseManifestsMissingName(t *testing.T) {
+	if _, err := ParseManifests([]byte("apiVersion: v1\nkind: ConfigMap\n")); err == nil {
+		t.Error("expected error for manifest without a name")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	labels := map[string]any{"app.kubernetes.io/instance": "demo"}
+	liveUnchanged := configMap("unchanged", labels, map[string]any{"key": "value"})
+	liveChanged := configMap("changed", labels, map[string]any{"key": "old"})
+	liveOrphan := configMap("orphan", labels, map[string]any{"key": "value"})
+	liveOwned := configMap("owned", labels, nil)
+	liveOwned.SetOwnerReferences([]metav1.OwnerReference{{APIVersion: "v1", Kind: "Pod", Name: "p", UID: "1"}})
+	unrelated := configMap("unrelated", map[string]any{"app.kubernetes.io/instance": "other"}, nil)
+
+	differ := newTestDiffer(t, liveUnchanged, liveChanged, liveOrphan, liveOwned, unrelated)
+
+	rendered := []*unstructured.Unstructured{
+		configMap("unchanged", labels, map[string]any{"key": "value"}),
+		configMap("changed", labels, map[string]any{"key": "new"}),
+		configMap("added", labels, map[string]any{"key": "value"}),
+	}
+	// No namespace set: the default namespace applies
+	unstructured.RemoveNestedField(rendered[2].Object, "metadata", "namespace")
+
+	results, err := differ.Diff(context.Background(), rendered, DiffOptions{
+		Namespace:     "demo",
+		PruneSelector: "app.kubernetes.io/instance=demo",
+	})
+	if err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+
+	changes := map[string]ResourceDiff{}
+	for _, r := range results {
+		changes[r.Name] = r
+	}
+	if len(changes) != 4 {
+		t.Errorf("expected 4 results, got %+v", results)
+	}
+
+	if changes["unchanged"].Change != ChangeUnchanged {
+		t.Errorf("expected unchanged, got %+v", changes["unchanged"])
+	}
+	if r := changes["changed"]; r.Change != ChangeChanged || !strings.Contains(r.Diff, "-  key: old") || !strings.Contains(r.Diff, "+  key: new") {
+		t.Errorf("expected changed with diff, got %+v", r)
+	}
+	if r := changes["added"]; r.Change != ChangeAdded || r.Namespace != "demo" {
+		t.Errorf("expected added in default namespace, got %+v", r)
+	}
+	if changes["orphan"].Change != ChangePruned {
+		t.Errorf("expected orphan to be pruned, got %+v", changes["orphan"])
+	}
+	if _, ok := changes["owned"]; ok {
+		t.Error("expected owned resource to be skipped")
+	}
+	if _, ok := changes["unrelated"]; ok {
+		t.Error("expected resource from another app to be skipped")
+	}
+}
+
+func TestDiffMasksSecrets(t *testing.T) {
+	secretWith := func(data, stringData map[string]any) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata":   map[string]any{"name": "admin", "namespace": "demo"},
+			"data":       data,
+			"stringData": stringData,
+		}}
+	}
+	live := secretWith(
+		map[string]any{"password": "b2xkLXBhc3N3b3Jk", "username": "YWRtaW4=", "removed": "c3RhbGU="},
+		map[string]any{"token": "old-token"},
+	)
+	rendered := secretWith(
+		map[string]any{"password": "bmV3LXBhc3N3b3Jk", "username": "YWRtaW4=", "added": "ZnJlc2g="},
+		map[string]any{"token": "new-token"},
+	)
+
+	results, err := newTestDiffer(t, live).Diff(context.Background(), []*unstructured.Unstructured{rendered}, DiffOptions{Namespace: "demo"})
+	if err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Change != ChangeChanged {
+		t.Fatalf("expected changed secret, got %+v", results)
+	}
+
+	diff := results[0].Diff
+	for _, plaintext := range []string{"b2xkLXBhc3N3b3Jk", "bmV3LXBhc3N3b3Jk", "YWRtaW4=", "c3RhbGU=", "ZnJlc2g=", "old-token", "new-token"} {
+		if strings.Contains(diff, plaintext) {
+			t.Errorf("diff reveals secret value %q:\n%s", plaintext, diff)
+		}
+	}
+	for _, line := range []string{
+		"-  password: '*** (before)'",
+		"+  password: '*** (after)'",
+		"   username: '***'",
+		"-  removed: '***'",
+		"+  added: '***'",
+		"-  token: '*** (before)'",
+		"+  token: '*** (after)'",
+	} {
+		if !strings.Contains(diff, line) {
+			t.Errorf("expected diff to contain %q, got:\n%s", line, diff)
+		}
+	}
+}
+
+func TestDiffUnregisteredKind(t *testing.T) {
+	differ := newTestDiffer(t)
+
+	cert := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "cert-manager.io/v1",
+		"kind":       "Certificate",
+		"metadata":   map[string]any{"name": "demo"},
+	}}
+
+	results, err := differ.Diff(context.Background(), []*unstructured.Unstructured{cert}, DiffOptions{Namespace: "demo"})
+	if err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Change != ChangeAdded || results[0].Message == "" {
+		t.Errorf("expected added with message, got %+v", results)
+	}
+}
+
+func TestDiffSkipsHelmTests(t *testing.T) {
+	differ := newTestDiffer(t)
+
+	hook := configMap("test-connection", nil, nil)
+	hook.SetAnnotations(map[string]string{"helm.sh/hook": "test"})
+
+	results, err := differ.Diff(context.Background(), []*unstructured.Unstructured{hook}, DiffOptions{Namespace: "demo"})
+	if err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("expected helm test hook to be skipped, got %+v", results)
+	}
+}
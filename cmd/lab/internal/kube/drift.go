@@ -0,0 +1,310 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+// driftSkipGroups are API groups whose objects are never declared in git
+var driftSkipGroups = []string{
+	"metrics.k8s.io",
+	"coordination.k8s.io",
+	"events.k8s.io",
+}
+
+// driftSkipResources are core resources that only ever hold generated or
+// transient objects
+var driftSkipResources = []string{"events", "endpoints", "nodes", "componentstatuses"}
+
+// systemNamespaces are created by Kubernetes itself
+var systemNamespaces = []string{"default", "kube-system", "kube-public", "kube-node-lease"}
+
+// apiserverConfigMaps are kept up to date in kube-system by kube-apiserver
+var apiserverConfigMaps = []string{"extension-apiserver-authentication", "kube-apiserver-legacy-service-account-token-tracking"}
+
+// longhornDriver is the CSI driver name of Longhorn
+const longhornDriver = "driver.longhorn.io"
+
+// longhornStorageClasses are the StorageClasses longhorn-manager creates from
+// its settings rather than from the chart's manifests
+var longhornStorageClasses = []string{"longhorn", "longhorn-static"}
+
+// statefulSetGVR lists StatefulSets for their volume claim templates
+var statefulSetGVR = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"}
+
+// DriftObject is a live object that no rendered chart or ArgoCD Application
+// produces
+type DriftObject struct {
+	APIVersion string    `json:"apiVersion"`
+	Kind       string    `json:"kind"`
+	Namespace  string    `json:"namespace,omitempty"`
+	Name       string    `json:"name"`
+	Created    time.Time `json:"created"`
+}
+
+// String returns the object as Kind/name
+func (o DriftObject) String() string {
+	return o.Kind + "/" + o.Name
+}
+
+// DriftOptions configures a DriftScanner.Scan call
+type DriftOptions struct {
+	// Expected are the objects git produces, e.g. rendered charts.
+	// Namespaced objects need their namespace set; for cluster-scoped kinds
+	// it is ignored.
+	Expected []*unstructured.Unstructured
+	// Ignore reports whether a live object of kind in API group should be
+	// left out of the results
+	Ignore func(kind, group, namespace, name string) bool
+}
+
+// DriftScanner finds live objects that nothing in git accounts for
+type DriftScanner struct {
+	client dynamic.Interface
+	// resources returns the API resources to scan
+	resources func() ([]*metav1.APIResourceList, error)
+}
+
+// NewDriftScanner returns a DriftScanner for the cluster described by
+// restConfig
+func NewDriftScanner(restConfig *rest.Config) (*DriftScanner, error) {
+	client, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("create dynamic client: %w", err)
+	}
+
+	disco, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("create discovery client: %w", err)
+	}
+
+	resources := func() ([]*metav1.APIResourceList, error) {
+		lists, err := disco.ServerPreferredResources()
+		// An unavailable aggregated API shouldn't hide drift in the rest
+		if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+			return nil, fmt.Errorf("discover API resources: %w", err)
+		}
+		return lists, nil
+	}
+	return &DriftScanner{client: client, resources: resources}, nil
+}
+
+// newDriftScannerWithClient returns a DriftScanner using the given client
+// and API resources
+func newDriftScannerWithClient(client dynamic.Interface, resources []*metav1.APIResourceList) *DriftScanner {
+	return &DriftScanner{
+		client:    client,
+		resources: func() ([]*metav1.APIResourceList, error) { return resources, nil },
+	}
+}
+
+// Scan lists every object of every listable API resource and returns those
+// that aren't expected, aren't among the resources of an ArgoCD Application,
+// and aren't created by a controller (have no owner references) or by
+// Kubernetes itself. Results are sorted by namespace, kind and name.
+func (s *DriftScanner) Scan(ctx context.Context, opts DriftOptions) ([]DriftObject, error) {
+	lists, err := s.resources()
+	if err != nil {
+		return nil, err
+	}
+
+	known := map[string]bool{}
+	for _, obj := range opts.Expected {
+		known[resourceKey(obj.GroupVersionKind().GroupKind(), obj.GetNamespace(), obj.GetName())] = true
+		// Charts may set a namespace on cluster-scoped objects too
+		known[resourceKey(obj.GroupVersionKind().GroupKind(), "*", obj.GetName())] = true
+	}
+	if err := s.addApplicationResources(ctx, known); err != nil {
+		return nil, err
+	}
+	claims, err := s.statefulSetClaims(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var drift []DriftObject
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil || slices.Contains(driftSkipGroups, gv.Group) {
+			continue
+		}
+		for _, res := range list.APIResources {
+			if !driftScannable(gv, res) {
+				continue
+			}
+
+			items, err := s.client.Resource(gv.WithResource(res.Name)).List(ctx, metav1.ListOptions{})
+			switch {
+			case apierrors.IsNotFound(err) || apierrors.IsForbidden(err) || apierrors.IsMethodNotSupported(err):
+				continue
+			case err != nil:
+				return nil, fmt.Errorf("list %s: %w", res.Name, err)
+			}
+
+			gk := schema.GroupKind{Group: gv.Group, Kind: res.Kind}
+			for _, item := range items.Items {
+				namespace := item.GetNamespace()
+				switch {
+				case known[resourceKey(gk, namespace, item.GetName())]:
+				case !res.Namespaced && known[resourceKey(gk, "*", item.GetName())]:
+				case len(item.GetOwnerReferences()) > 0:
+				case isSystemObject(gk, &item):
+				case gk == schema.GroupKind{Kind: "PersistentVolumeClaim"} && claims.matches(namespace, item.GetName()):
+				case opts.Ignore != nil && opts.Ignore(res.Kind, gv.Group, namespace, item.GetName()):
+				default:
+					drift = append(drift, DriftObject{
+						APIVersion: gv.String(),
+						Kind:       res.Kind,
+						Namespace:  namespace,
+						Name:       item.GetName(),
+						Created:    item.GetCreationTimestamp().Time,
+					})
+				}
+			}
+		}
+	}
+
+	slices.SortFunc(drift, func(a, b DriftObject) int {
+		return strings.Compare(a.Namespace+"/"+a.Kind+"/"+a.Name, b.Namespace+"/"+b.Kind+"/"+b.Name)
+	})
+	return drift, nil
+}
+
+// addApplicationResources marks the resources every ArgoCD Application
+// reports as its own as known. Clusters without ArgoCD have none.
+func (s *DriftScanner) addApplicationResources(ctx context.Context, known map[string]bool) error {
+	apps, err := s.client.Resource(applicationGVR).Namespace(ArgoCDNamespace).List(ctx, metav1.ListOptions{})
+	switch {
+	case apierrors.IsNotFound(err) || meta.IsNoMatchError(err):
+		return nil
+	case err != nil:
+		return fmt.Errorf("list ArgoCD applications: %w", err)
+	}
+
+	for _, app := range apps.Items {
+		resources, _, _ := unstructured.NestedSlice(app.Object, "status", "resources")
+		for _, r := range resources {
+			res, ok := r.(map[string]any)
+			if !ok {
+				continue
+			}
+			group, _ := res["group"].(string)
+			kind, _ := res["kind"].(string)
+			namespace, _ := res["namespace"].(string)
+			name, _ := res["name"].(string)
+			known[resourceKey(schema.GroupKind{Group: group, Kind: kind}, namespace, name)] = true
+		}
+	}
+	return nil
+}
+
+// claimTemplates maps a namespace to the "<template>-<statefulset>-" name
+// prefixes of the PVCs its StatefulSets' volumeClaimTemplates create
+type claimTemplates map[string][]string
+
+// matches reports whether name is an ordinal's claim from a StatefulSet in
+// namespace
+func (c claimTemplates) matches(namespace, name string) bool {
+	for _, prefix := range c[namespace] {
+		ordinal, ok := strings.CutPrefix(name, prefix)
+		if ok && ordinal != "" && strings.Trim(ordinal, "0123456789") == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// statefulSetClaims returns the PVC name prefixes of every live StatefulSet's
+// volumeClaimTemplates. The StatefulSet controller creates those PVCs without
+// owner references unless a retention policy asks for them.
+func (s *DriftScanner) statefulSetClaims(ctx context.Context) (claimTemplates, error) {
+	sets, err := s.client.Resource(statefulSetGVR).List(ctx, metav1.ListOptions{})
+	switch {
+	case apierrors.IsNotFound(err) || apierrors.IsForbidden(err):
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("list statefulsets: %w", err)
+	}
+
+	claims := claimTemplates{}
+	for _, set := range sets.Items {
+		templates, _, _ := unstructured.NestedSlice(set.Object, "spec", "volumeClaimTemplates")
+		for _, t := range templates {
+			template, ok := t.(map[string]any)
+			if !ok {
+				continue
+			}
+			if name, _, _ := unstructured.NestedString(template, "metadata", "name"); name != "" {
+				claims[set.GetNamespace()] = append(claims[set.GetNamespace()], name+"-"+set.GetName()+"-")
+			}
+		}
+	}
+	return claims, nil
+}
+
+// driftScannable reports whether objects of res can be listed and may be
+// declared in git
+func driftScannable(gv schema.GroupVersion, res metav1.APIResource) bool {
+	if strings.Contains(res.Name, "/") || !slices.Contains(res.Verbs, "list") {
+		return false
+	}
+	return gv.Group != "" || !slices.Contains(driftSkipResources, res.Name)
+}
+
+// isSystemObject reports whether Kubernetes or a controller, rather than
+// anyone applying manifests, created obj: system namespaces, per-namespace
+// defaults, built-in RBAC, API services and priority classes, objects k3s
+// applies from its server manifests, Helm release records, cert-manager
+// certificate Secrets, and volumes and attachments Longhorn or any other
+// provisioner creates
+func isSystemObject(gk schema.GroupKind, obj *unstructured.Unstructured) bool {
+	labels := obj.GetLabels()
+	annotations := obj.GetAnnotations()
+	switch {
+	case labels["kubernetes.io/bootstrapping"] == "rbac-defaults",
+		labels["kube-aggregator.kubernetes.io/automanaged"] != "",
+		annotations["apf.kubernetes.io/autoupdate-spec"] != "",
+		labels["objectset.rio.cattle.io/hash"] != "",
+		labels["longhorn.io/managed-by"] != "",
+		labels["owner"] == "helm" && gk.Kind == "Secret",
+		annotations["cert-manager.io/certificate-name"] != "" && gk.Kind == "Secret":
+		return true
+	}
+
+	switch gk {
+	case schema.GroupKind{Kind: "Namespace"}:
+		return slices.Contains(systemNamespaces, obj.GetName())
+	case schema.GroupKind{Kind: "ServiceAccount"}:
+		return obj.GetName() == "default"
+	case schema.GroupKind{Kind: "ConfigMap"}:
+		return obj.GetName() == "kube-root-ca.crt" ||
+			obj.GetNamespace() == "kube-system" && slices.Contains(apiserverConfigMaps, obj.GetName())
+	case schema.GroupKind{Kind: "Service"}:
+		return obj.GetNamespace() == "default" && obj.GetName() == "kubernetes"
+	case schema.GroupKind{Kind: "PersistentVolume"}:
+		driver, _, _ := unstructured.NestedString(obj.Object, "spec", "csi", "driver")
+		return annotations["pv.kubernetes.io/provisioned-by"] != "" || driver == longhornDriver
+	case schema.GroupKind{Group: "storage.k8s.io", Kind: "VolumeAttachment"}:
+		return true
+	case schema.GroupKind{Group: "storage.k8s.io", Kind: "CSIDriver"}:
+		return obj.GetName() == longhornDriver
+	case schema.GroupKind{Group: "storage.k8s.io", Kind: "StorageClass"}:
+		provisioner, _, _ := unstructured.NestedString(obj.Object, "provisioner")
+		return provisioner == longhornDriver && slices.Contains(longhornStorageClasses, obj.GetName())
+	case schema.GroupKind{Group: "scheduling.k8s.io", Kind: "PriorityClass"}:
+		return strings.HasPrefix(obj.GetName(), "system-")
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package kube
+
+import (
+	"slices"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestDriftScan(t *testing.T) {
+	rendered := configMap("rendered", nil, nil)
+	manual := configMap("manual", nil, nil)
+	argoManaged := configMap("argo-managed", nil, nil)
+	ignored := configMap("scratch-1", nil, nil)
+	rootCA := configMap("kube-root-ca.crt", nil, nil)
+	owned := configMap("owned", nil, nil)
+	owned.SetOwnerReferences([]metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "web", UID: "1"}})
+
+	// Charts may render cluster-scoped objects with the release namespace
+	liveNS := namespaceObject("demo")
+	expectedNS := namespaceObject("demo")
+	expectedNS.SetNamespace("demo")
+	leftover := namespaceObject("old-app")
+	system := namespaceObject("kube-system")
+
+	// Created by controllers without owner references
+	statefulSet := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "StatefulSet",
+		"metadata":   map[string]any{"name": "db", "namespace": "demo"},
+		"spec": map[string]any{"volumeClaimTemplates": []any{
+			map[string]any{"metadata": map[string]any{"name": "data"}},
+		}},
+	}}
+	stsClaim := claim("data-db-0")
+	manualClaim := claim("data-db-backup")
+	certSecret := secret("web-tls", map[string]any{"cert-manager.io/certificate-name": "web"})
+	manualSecret := secret("api-token", nil)
+	longhornClaim := claim("restored")
+	longhornClaim.SetLabels(map[string]string{"longhorn.io/managed-by": "longhorn-manager"})
+	k3sManifest := configMap("coredns", map[string]any{"objectset.rio.cattle.io/hash": "abc"}, nil)
+	k3sManifest.SetNamespace("kube-system")
+	manualSystem := configMap("hotfix", nil, nil)
+	manualSystem.SetNamespace("kube-system")
+
+	app := application("demo", "Synced", "Healthy")
+	_ = unstructured.SetNestedSlice(app.Object, []any{
+		map[string]any{"version": "v1", "kind": "ConfigMap", "namespace": "demo", "name": "argo-managed"},
+	}, "status", "resources")
+
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			applicationGVR:                                      "ApplicationList",
+			statefulSetGVR:                                      "StatefulSetList",
+			{Version: "v1", Resource: "configmaps"}:             "ConfigMapList",
+			{Version: "v1", Resource: "namespaces"}:             "NamespaceList",
+			{Version: "v1", Resource: "persistentvolumeclaims"}: "PersistentVolumeClaimList",
+			{Version: "v1", Resource: "secrets"}:                "SecretList",
+		},
+		rendered, manual, argoManaged, ignored, rootCA, owned, liveNS, leftover, system, app,
+		statefulSet, stsClaim, manualClaim, certSecret, manualSecret, longhornClaim, k3sManifest, manualSystem)
+
+	resources := []*metav1.APIResourceList{
+		{GroupVersion: "v1", APIResources: []metav1.APIResource{
+			{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: []string{"list"}},
+			{Name: "persistentvolumeclaims", Kind: "PersistentVolumeClaim", Namespaced: true, Verbs: []string{"list"}},
+			{Name: "secrets", Kind: "Secret", Namespaced: true, Verbs: []string{"list"}},
+			{Name: "namespaces", Kind: "Namespace", Verbs: []string{"list"}},
+			{Name: "namespaces/status", Kind: "Namespace", Verbs: []string{"get"}},
+			{Name: "events", Kind: "Event", Namespaced: true, Verbs: []string{"list"}},
+		}},
+	}
+
+	drift, err := newDriftScannerWithClient(client, resources).Scan(t.Context(), DriftOptions{
+		Expected: []*unstructured.Unstructured{rendered, expectedNS},
+		Ignore: func(kind, group, namespace, name string) bool {
+			return kind == "ConfigMap" && name == "scratch-1"
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got []string
+	for _, obj := range drift {
+		got = append(got, obj.Namespace+"/"+obj.Kind+"/"+obj.Name)
+	}
+	want := []string{
+		"/Namespace/old-app",
+		"demo/ConfigMap/manual",
+		"demo/PersistentVolumeClaim/data-db-backup",
+		"demo/Secret/api-token",
+		"kube-system/ConfigMap/hotfix",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected drift %v, got %v", want, got)
+	}
+}
+
+func namespaceObject(name string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Namespace",
+		"metadata":   map[string]any{"name": name},
+	}}
+}
+
+func claim(name string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "PersistentVolumeClaim",
+		"metadata":   map[string]any{"name": name, "namespace": "demo"},
+	}}
+}
+
+func secret(name string, annotations map[string]any) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]any{"name": name, "namespace": "demo", "annotations": annotations},
+	}}
+}
+
+func TestIsSystemObject(t *testing.T) {
+	object := func(apiVersion, kind, name string, fields map[string]any) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": apiVersion,
+			"kind":       kind,
+			"metadata":   map[string]any{"name": name},
+		}}
+		for k, v := range fields {
+			obj.Object[k] = v
+		}
+		return obj
+	}
+
+	tests := []struct {
+		name string
+		obj  *unstructured.Unstructured
+		want bool
+	}{
+		{"longhorn PV", object("v1", "PersistentVolume", "pvc-1", map[string]any{"spec": map[string]any{"csi": map[string]any{"driver": "driver.longhorn.io"}}}), true},
+		{"static PV", object("v1", "PersistentVolume", "nfs", map[string]any{"spec": map[string]any{"nfs": map[string]any{"server": "nas"}}}), false},
+		{"volume attachment", object("storage.k8s.io/v1", "VolumeAttachment", "csi-123", nil), true},
+		{"longhorn storage class", object("storage.k8s.io/v1", "StorageClass", "longhorn", map[string]any{"provisioner": "driver.longhorn.io"}), true},
+		{"other storage class", object("storage.k8s.io/v1", "StorageClass", "fast", map[string]any{"provisioner": "driver.longhorn.io"}), false},
+		{"system priority class", object("scheduling.k8s.io/v1", "PriorityClass", "system-node-critical", nil), true},
+		{"own priority class", object("scheduling.k8s.io/v1", "PriorityClass", "batch", nil), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isSystemObject(tt.obj.GroupVersionKind().GroupKind(), tt.obj); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package kube
+
+import (
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Problems reported by ImageRef.Issues
+const (
+	ImageIssueLatest   = "latest tag"
+	ImageIssueUntagged = "untagged"
+	ImageIssueNoDigest = "no digest"
+)
+
+// ImageRef is a container image reference split into its parts
+type ImageRef struct {
+	// Image is the reference as written in the manifest
+	Image      string `json:"image"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+}
+
+// ParseImageRef splits image into repository, tag and digest. A registry port
+// (registry:5000/app) isn't mistaken for a tag.
+func ParseImageRef(image string) ImageRef {
+	ref := ImageRef{Image: image, Repository: image}
+	if repo, digest, ok := strings.Cut(ref.Repository, "@"); ok {
+		ref.Repository, ref.Digest = repo, digest
+	}
+	if i := strings.LastIndex(ref.Repository, ":"); i > strings.LastIndex(ref.Repository, "/") {
+		ref.Repository, ref.Tag = ref.Repository[:i], ref.Repository[i+1:]
+	}
+	return ref
+}
+
+// Issues lists what makes the reference unreproducible: a latest or missing
+// tag, which can change under the same name, and a missing digest
+func (r ImageRef) Issues() []string {
+	var issues []string
+	switch {
+	case r.Tag == "latest":
+		issues = append(issues, ImageIssueLatest)
+	case r.Tag == "" && r.Digest == "":
+		issues = append(issues, ImageIssueUntagged)
+	}
+	if r.Digest == "" {
+		issues = append(issues, ImageIssueNoDigest)
+	}
+	return issues
+}
+
+// podSpecPaths locates the pod spec in each workload kind
+var podSpecPaths = map[string][]string{
+	"Pod":         {"spec"},
+	"Deployment":  {"spec", "template", "spec"},
+	"StatefulSet": {"spec", "template", "spec"},
+	"DaemonSet":   {"spec", "template", "spec"},
+	"ReplicaSet":  {"spec", "template", "spec"},
+	"Job":         {"spec", "template", "spec"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// ContainerImages returns the images of every container, init container and
+// ephemeral container in obj's pod spec, without duplicates, in the order they
+// appear. Objects without a pod spec have none.
+func ContainerImages(obj *unstructured.Unstructured) []string {
+	path, ok := podSpecPaths[obj.GetKind()]
+	if !ok {
+		return nil
+	}
+	spec, found, _ := unstructured.NestedMap(obj.Object, path...)
+	if !found {
+		return nil
+	}
+
+	var images []string
+	for _, field := range []string{"initContainers", "containers", "ephemeralContainers"} {
+		containers, _, _ := unstructured.NestedSlice(spec, field)
+		for _, c := range containers {
+			container, ok := c.(map[string]any)
+			if !ok {
+				continue
+			}
+			if image, _ := container["image"].(string); image != "" && !slices.Contains(images, image) {
+				images = append(images, image)
+			}
+		}
+	}
+	return images
+}
@@ -0,0 +1,56 @@
+package kube
+
+import (
+	"slices"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestParseImageRef(t *testing.T) {
+	tests := []struct {
+		image  string
+		want   ImageRef
+		issues []string
+	}{
+		{"nginx", ImageRef{Repository: "nginx"}, []string{ImageIssueUntagged, ImageIssueNoDigest}},
+		{"nginx:latest", ImageRef{Repository: "nginx", Tag: "latest"}, []string{ImageIssueLatest, ImageIssueNoDigest}},
+		{"ghcr.io/org/app:1.2.3", ImageRef{Repository: "ghcr.io/org/app", Tag: "1.2.3"}, []string{ImageIssueNoDigest}},
+		{"registry:5000/app", ImageRef{Repository: "registry:5000/app"}, []string{ImageIssueUntagged, ImageIssueNoDigest}},
+		{"registry:5000/app:v1@sha256:abc", ImageRef{Repository: "registry:5000/app", Tag: "v1", Digest: "sha256:abc"}, nil},
+		{"app@sha256:abc", ImageRef{Repository: "app", Digest: "sha256:abc"}, nil},
+	}
+
+	for _, tt := range tests {
+		got := ParseImageRef(tt.image)
+		tt.want.Image = tt.image
+		if got != tt.want {
+			t.Errorf("ParseImageRef(%q) = %+v, want %+v", tt.image, got, tt.want)
+		}
+		if issues := got.Issues(); !slices.Equal(issues, tt.issues) {
+			t.Errorf("%q: expected issues %v, got %v", tt.image, tt.issues, issues)
+		}
+	}
+}
+
+func TestContainerImages(t *testing.T) {
+	cronJob := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "batch/v1",
+		"kind":       "CronJob",
+		"metadata":   map[string]any{"name": "backup"},
+		"spec": map[string]any{"jobTemplate": map[string]any{"spec": map[string]any{"template": map[string]any{"spec": map[string]any{
+			"initContainers": []any{map[string]any{"name": "init", "image": "busybox:1.36"}},
+			"containers": []any{
+				map[string]any{"name": "backup", "image": "restic/restic:0.16"},
+				map[string]any{"name": "sidecar", "image": "busybox:1.36"},
+			},
+		}}}}},
+	}}
+
+	if got := ContainerImages(cronJob); !slices.Equal(got, []string{"busybox:1.36", "restic/restic:0.16"}) {
+		t.Errorf("unexpected images %v", got)
+	}
+	if got := ContainerImages(configMap("demo", nil, nil)); got != nil {
+		t.Errorf("expected no images for a ConfigMap, got %v", got)
+	}
+}
@@ -0,0 +1,256 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+// ErrNotReady means resources didn't become ready before the wait ended
+var ErrNotReady = errors.New("resources not ready")
+
+// DefaultReadyInterval is how often WaitReady re-checks resources
+const DefaultReadyInterval = 2 * time.Second
+
+// endpointSliceServiceLabel links an EndpointSlice to its Service
+const endpointSliceServiceLabel = "kubernetes.io/service-name"
+
+var (
+	deploymentGVR        = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	crdGVR               = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+	validatingWebhookGVR = schema.GroupVersionResource{Group: "admissionregistration.k8s.io", Version: "v1", Resource: "validatingwebhookconfigurations"}
+	mutatingWebhookGVR   = schema.GroupVersionResource{Group: "admissionregistration.k8s.io", Version: "v1", Resource: "mutatingwebhookconfigurations"}
+	endpointSliceGVR     = schema.GroupVersionResource{Group: "discovery.k8s.io", Version: "v1", Resource: "endpointslices"}
+)
+
+// ReadyChecker waits for installed resources to be usable: Deployments rolled
+// out, CRDs established and admission webhooks backed by ready endpoints with
+// a CA bundle. Other kinds are considered ready as soon as they're applied.
+type ReadyChecker struct {
+	client   dynamic.Interface
+	interval time.Duration
+}
+
+// NewReadyChecker returns a ReadyChecker for the cluster described by restConfig
+func NewReadyChecker(restConfig *rest.Config) (*ReadyChecker, error) {
+	client, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("create dynamic client: %w", err)
+	}
+	return &ReadyChecker{client: client, interval: DefaultReadyInterval}, nil
+}
+
+// newReadyCheckerWithClient returns a ReadyChecker using the given client
+func newReadyCheckerWithClient(client dynamic.Interface, interval time.Duration) *ReadyChecker {
+	return &ReadyChecker{client: client, interval: interval}
+}
+
+// Pending returns a description of each object in objs that isn't ready yet.
+// Namespaced objects without a namespace are looked up in namespace.
+func (c *ReadyChecker) Pending(ctx context.Context, objs []*unstructured.Unstructured, namespace string) ([]string, error) {
+	var pending []string
+	for _, obj := range objs {
+		reason, err := c.notReadyReason(ctx, obj, namespace)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			pending = append(pending, reason)
+		}
+	}
+	return pending, nil
+}
+
+// WaitReady polls until every object in objs is ready, returning ErrNotReady
+// with the resources still pending if ctx ends first
+func (c *ReadyChecker) WaitReady(ctx context.Context, objs []*unstructured.Unstructured, namespace string) error {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		pending, err := c.Pending(ctx, objs, namespace)
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+		if err == nil && len(pending) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if len(pending) == 0 {
+				return fmt.Errorf("%w: %w", ErrNotReady, ctx.Err())
+			}
+			return fmt.Errorf("%w: %s", ErrNotReady, strings.Join(pending, "; "))
+		case <-ticker.C:
+		}
+	}
+}
+
+// notReadyReason explains why obj isn't ready, or returns "" if it is
+func (c *ReadyChecker) notReadyReason(ctx context.Context, obj *unstructured.Unstructured, namespace string) (string, error) {
+	gk := obj.GroupVersionKind().GroupKind()
+	ns := obj.GetNamespace()
+	if ns == "" {
+		ns = namespace
+	}
+
+	switch gk {
+	case schema.GroupKind{Group: "apps", Kind: "Deployment"}:
+		live, reason, err := c.get(ctx, deploymentGVR, ns, obj)
+		if live == nil {
+			return reason, err
+		}
+		return deploymentNotReady(live), nil
+
+	case schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}:
+		live, reason, err := c.get(ctx, crdGVR, "", obj)
+		if live == nil {
+			return reason, err
+		}
+		if !hasTrueCondition(live, "Established") {
+			return "CustomResourceDefinition/" + live.GetName() + " not established", nil
+		}
+		return "", nil
+
+	case schema.GroupKind{Group: "admissionregistration.k8s.io", Kind: "ValidatingWebhookConfiguration"}:
+		return c.webhookNotReady(ctx, validatingWebhookGVR, obj)
+
+	case schema.GroupKind{Group: "admissionregistration.k8s.io", Kind: "MutatingWebhookConfiguration"}:
+		return c.webhookNotReady(ctx, mutatingWebhookGVR, obj)
+	}
+
+	return "", nil
+}
+
+// get fetches the live copy of obj. If it doesn't exist yet, the returned
+// object is nil and reason says so.
+func (c *ReadyChecker) get(ctx context.Context, gvr schema.GroupVersionResource, namespace string, obj *unstructured.Unstructured) (*unstructured.Unstructured, string, error) {
+	var ri dynamic.ResourceInterface = c.client.Resource(gvr)
+	desc := obj.GetKind() + "/" + obj.GetName()
+	if namespace != "" {
+		ri = c.client.Resource(gvr).Namespace(namespace)
+		desc = obj.GetKind() + "/" + namespace + "/" + obj.GetName()
+	}
+
+	live, err := ri.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, desc + " not found", nil
+		}
+		return nil, "", fmt.Errorf("get %s: %w", desc, err)
+	}
+	return live, "", nil
+}
+
+// deploymentNotReady explains why a live Deployment hasn't finished rolling
+// out, or returns ""
+func deploymentNotReady(d *unstructured.Unstructured) string {
+	desc := "Deployment/" + d.GetNamespace() + "/" + d.GetName()
+
+	observed, _, _ := unstructured.NestedInt64(d.Object, "status", "observedGeneration")
+	if observed < d.GetGeneration() {
+		return desc + " not yet observed by the controller"
+	}
+
+	replicas, found, _ := unstructured.NestedInt64(d.Object, "spec", "replicas")
+	if !found {
+		replicas = 1
+	}
+	updated, _, _ := unstructured.NestedInt64(d.Object, "status", "updatedReplicas")
+	available, _, _ := unstructured.NestedInt64(d.Object, "status", "availableReplicas")
+	if updated < replicas || available < replicas {
+		return fmt.Sprintf("%s has %d/%d updated and %d/%d available replicas", desc, updated, replicas, available, replicas)
+	}
+	return ""
+}
+
+// webhookNotReady checks that every service-backed webhook in a live webhook
+// configuration has a CA bundle and at least one ready endpoint
+func (c *ReadyChecker) webhookNotReady(ctx context.Context, gvr schema.GroupVersionResource, obj *unstructured.Unstructured) (string, error) {
+	live, reason, err := c.get(ctx, gvr, "", obj)
+	if live == nil {
+		return reason, err
+	}
+
+	webhooks, _, _ := unstructured.NestedSlice(live.Object, "webhooks")
+	for _, wh := range webhooks {
+		webhook, ok := wh.(map[string]any)
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(webhook, "name")
+		desc := live.GetKind() + "/" + live.GetName() + " webhook " + name
+
+		svcName, found, _ := unstructured.NestedString(webhook, "clientConfig", "service", "name")
+		if !found {
+			continue // URL webhooks point outside the cluster
+		}
+		svcNamespace, _, _ := unstructured.NestedString(webhook, "clientConfig", "service", "namespace")
+
+		if caBundle, _, _ := unstructured.NestedString(webhook, "clientConfig", "caBundle"); caBundle == "" {
+			return desc + " has no CA bundle yet", nil
+		}
+
+		ready, err := c.serviceHasReadyEndpoint(ctx, svcNamespace, svcName)
+		if err != nil {
+			return "", err
+		}
+		if !ready {
+			return fmt.Sprintf("%s: service %s/%s has no ready endpoints", desc, svcNamespace, svcName), nil
+		}
+	}
+	return "", nil
+}
+
+// serviceHasReadyEndpoint reports whether any EndpointSlice of the service has
+// an endpoint that isn't marked unready
+func (c *ReadyChecker) serviceHasReadyEndpoint(ctx context.Context, namespace, name string) (bool, error) {
+	list, err := c.client.Resource(endpointSliceGVR).Namespace(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: endpointSliceServiceLabel + "=" + name,
+	})
+	if err != nil {
+		return false, fmt.Errorf("list endpoints of %s/%s: %w", namespace, name, err)
+	}
+
+	for _, slice := range list.Items {
+		endpoints, _, _ := unstructured.NestedSlice(slice.Object, "endpoints")
+		for _, ep := range endpoints {
+			endpoint, ok := ep.(map[string]any)
+			if !ok {
+				continue
+			}
+			// A nil ready condition means unknown, which consumers treat as ready
+			ready, found, _ := unstructured.NestedBool(endpoint, "conditions", "ready")
+			if !found || ready {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// hasTrueCondition reports whether obj's status has a condition of condType
+// with status True
+func hasTrueCondition(obj *unstructured.Unstructured, condType string) bool {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]any)
+		if !ok {
+			continue
+		}
+		if cond["type"] == condType && cond["status"] == "True" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newTestReadyChecker(objects ...runtime.Object) *ReadyChecker {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			deploymentGVR:        "DeploymentList",
+			crdGVR:               "CustomResourceDefinitionList",
+			validatingWebhookGVR: "ValidatingWebhookConfigurationList",
+			mutatingWebhookGVR:   "MutatingWebhookConfigurationList",
+			endpointSliceGVR:     "EndpointSliceList",
+		}, objects...)
+	return newReadyCheckerWithClient(client, time.Millisecond)
+}
+
+func deployment(name string, generation, observed, replicas, available int64) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]any{"name": name, "namespace": "cert-manager", "generation": generation},
+		"spec":       map[string]any{"replicas": replicas},
+		"status": map[string]any{
+			"observedGeneration": observed,
+			"updatedReplicas":    available,
+			"availableReplicas":  available,
+		},
+	}}
+}
+
+func crd(name string, established bool) *unstructured.Unstructured {
+	status := "False"
+	if established {
+		status = "True"
+	}
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata":   map[string]any{"name": name},
+		"status": map[string]any{
+			"conditions": []any{map[string]any{"type": "Established", "status": status}},
+		},
+	}}
+}
+
+func validatingWebhook(name, caBundle string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "admissionregistration.k8s.io/v1",
+		"kind":       "ValidatingWebhookConfiguration",
+		"metadata":   map[string]any{"name": name},
+		"webhooks": []any{map[string]any{
+			"name": "webhook.cert-manager.io",
+			"clientConfig": map[string]any{
+				"caBundle": caBundle,
+				"service":  map[string]any{"name": "cert-manager-webhook", "namespace": "cert-manager"},
+			},
+		}},
+	}}
+}
+
+func endpointSlice(service string, ready bool) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "discovery.k8s.io/v1",
+		"kind":       "EndpointSlice",
+		"metadata": map[string]any{
+			"name":      service + "-abcde",
+			"namespace": "cert-manager",
+			"labels":    map[string]any{endpointSliceServiceLabel: service},
+		},
+		"endpoints": []any{map[string]any{
+			"addresses":  []any{"10.0.0.1"},
+			"conditions": map[string]any{"ready": ready},
+		}},
+	}}
+}
+
+func TestPending(t *testing.T) {
+	checker := newTestReadyChecker(
+		deployment("ready", 2, 2, 1, 1),
+		deployment("rolling", 2, 2, 2, 1),
+		deployment("stale", 3, 2, 1, 1),
+		crd("certificates.cert-manager.io", true),
+		crd("issuers.cert-manager.io", false),
+		validatingWebhook("no-ca", ""),
+		validatingWebhook("unserved", "Y2E="),
+		endpointSlice("cert-manager-webhook", false),
+	)
+
+	objs := []*unstructured.Unstructured{
+		deployment("ready", 0, 0, 1, 0),
+		deployment("rolling", 0, 0, 2, 0),
+		deployment("stale", 0, 0, 1, 0),
+		deployment("missing", 0, 0, 1, 0),
+		crd("certificates.cert-manager.io", false),
+		crd("issuers.cert-manager.io", false),
+		validatingWebhook("no-ca", ""),
+		validatingWebhook("unserved", ""),
+		configMap("ignored", nil, nil),
+	}
+
+	pending, err := checker.Pending(context.Background(), objs, "cert-manager")
+	if err != nil {
+		t.Fatalf("pending failed: %v", err)
+	}
+
+	want := []string{
+		"Deployment/cert-manager/rolling has 1/2 updated and 1/2 available replicas",
+		"Deployment/cert-manager/stale not yet observed by the controller",
+		"Deployment/cert-manager/missing not found",
+		"CustomResourceDefinition/issuers.cert-manager.io not established",
+		"ValidatingWebhookConfiguration/no-ca webhook webhook.cert-manager.io has no CA bundle yet",
+		"ValidatingWebhookConfiguration/unserved webhook webhook.cert-manager.io: service cert-manager/cert-manager-webhook has no ready endpoints",
+	}
+	if strings.Join(pending, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected pending resources:\ngot:\n%s\nwant:\n%s", strings.Join(pending, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestWaitReady(t *testing.T) {
+	checker := newTestReadyChecker(
+		validatingWebhook("cert-manager-webhook", "Y2E="),
+		endpointSlice("cert-manager-webhook", true),
+	)
+
+	objs := []*unstructured.Unstructured{validatingWebhook("cert-manager-webhook", "")}
+	if err := checker.WaitReady(context.Background(), objs, ""); err != nil {
+		t.Errorf("expected webhook to be ready, got %v", err)
+	}
+}
+
+func TestWaitReadyTimeout(t *testing.T) {
+	checker := newTestReadyChecker(crd("issuers.cert-manager.io", false))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := checker.WaitReady(ctx, []*unstructured.Unstructured{crd("issuers.cert-manager.io", false)}, "")
+	if !errors.Is(err, ErrNotReady) {
+		t.Fatalf("expected ErrNotReady, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "issuers.cert-manager.io not established") {
+		t.Errorf("expected pending CRD in error, got %v", err)
+	}
+}
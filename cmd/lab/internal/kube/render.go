@@ -0,0 +1,129 @@
+package kube
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// FileChange is what writing hydrated manifests would do to one file
+type FileChange struct {
+	Path string `json:"path"`
+	// Change is ChangeAdded, ChangeChanged or ChangePruned
+	Change Change `json:"change"`
+}
+
+// RenderFiles lays objs out as one normalized YAML document per file, keyed by
+// file name. Files are named <kind>-<name>.yaml, or <kind>-<namespace>-<name>.yaml
+// when the same kind and name appear in several namespaces. Keys are sorted,
+// server-maintained fields are dropped and helm test hooks are skipped, so the
+// output only changes when the rendered manifests do.
+func RenderFiles(objs []*unstructured.Unstructured) (map[string][]byte, error) {
+	counts := map[string]int{}
+	for _, obj := range objs {
+		if !isHelmTestHook(obj) {
+			counts[renderedFileName(obj, false)]++
+		}
+	}
+
+	files := make(map[string][]byte, len(objs))
+	for _, obj := range objs {
+		if isHelmTestHook(obj) {
+			continue
+		}
+
+		name := renderedFileName(obj, counts[renderedFileName(obj, false)] > 1)
+		if _, ok := files[name]; ok {
+			return nil, fmt.Errorf("%s is rendered more than once", resourceString(obj))
+		}
+
+		data, err := yaml.Marshal(normalize(obj).Object)
+		if err != nil {
+			return nil, fmt.Errorf("marshal %s: %w", resourceString(obj), err)
+		}
+		files[name] = data
+	}
+	return files, nil
+}
+
+// renderedFileName returns the file name RenderFiles uses for obj
+func renderedFileName(obj *unstructured.Unstructured, withNamespace bool) string {
+	parts := []string{strings.ToLower(obj.GetKind())}
+	if withNamespace && obj.GetNamespace() != "" {
+		parts = append(parts, obj.GetNamespace())
+	}
+	parts = append(parts, obj.GetName())
+	// RBAC names such as system:auth-delegator aren't portable file names
+	return strings.NewReplacer(":", "_", "/", "_").Replace(strings.Join(parts, "-")) + ".yaml"
+}
+
+// resourceString returns obj as Kind/namespace/name
+func resourceString(obj *unstructured.Unstructured) string {
+	return ResourceDiff{Kind: obj.GetKind(), Namespace: obj.GetNamespace(), Name: obj.GetName()}.String()
+}
+
+// SyncFiles makes the YAML files in dir match files, writing new and changed
+// files and removing ones that are no longer rendered. The directory itself is
+// removed once it holds no files. With dryRun nothing is written, so the
+// returned changes report whether dir is up to date. Changes are sorted by path.
+func SyncFiles(dir string, files map[string][]byte, dryRun bool) ([]FileChange, error) {
+	existing, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("list %s: %w", dir, err)
+	}
+
+	var changes []FileChange
+	for _, path := range existing {
+		if _, ok := files[filepath.Base(path)]; !ok {
+			changes = append(changes, FileChange{Path: path, Change: ChangePruned})
+		}
+	}
+
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		current, err := os.ReadFile(path) //nolint:gosec // path is under the render output directory
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			changes = append(changes, FileChange{Path: path, Change: ChangeAdded})
+		case err != nil:
+			return nil, fmt.Errorf("read %s: %w", path, err)
+		case !bytes.Equal(current, data):
+			changes = append(changes, FileChange{Path: path, Change: ChangeChanged})
+		}
+	}
+
+	slices.SortFunc(changes, func(a, b FileChange) int { return strings.Compare(a.Path, b.Path) })
+	if dryRun || len(changes) == 0 {
+		return changes, nil
+	}
+
+	if len(files) > 0 {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			return nil, fmt.Errorf("create %s: %w", dir, err)
+		}
+	}
+	for _, c := range changes {
+		if c.Change == ChangePruned {
+			if err := os.Remove(c.Path); err != nil {
+				return nil, fmt.Errorf("remove %s: %w", c.Path, err)
+			}
+			continue
+		}
+		if err := os.WriteFile(c.Path, files[filepath.Base(c.Path)], 0o600); err != nil {
+			return nil, fmt.Errorf("write %s: %w", c.Path, err)
+		}
+	}
+	if len(files) == 0 {
+		// Leaves the directory alone if something other than rendered YAML lives there
+		_ = os.Remove(dir)
+	}
+	return changes, nil
+}
@@ -0,0 +1,132 @@
+package kube
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRenderFiles(t *testing.T) {
+	role := func(namespace string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "rbac.authorization.k8s.io/v1",
+			"kind":       "Role",
+			"metadata":   map[string]any{"name": "reader", "namespace": namespace},
+		}}
+	}
+	clusterRole := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "rbac.authorization.k8s.io/v1",
+		"kind":       "ClusterRole",
+		"metadata":   map[string]any{"name": "system:reader", "creationTimestamp": nil},
+	}}
+	hook := configMap("demo-test", nil, nil)
+	hook.SetAnnotations(map[string]string{"helm.sh/hook": "test"})
+
+	files, err := RenderFiles([]*unstructured.Unstructured{
+		configMap("demo", nil, map[string]any{"b": "2", "a": "1"}),
+		role("demo"),
+		role("kube-system"),
+		clusterRole,
+		hook,
+	})
+	if err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	want := []string{"clusterrole-system_reader.yaml", "configmap-demo.yaml", "role-demo-reader.yaml", "role-kube-system-reader.yaml"}
+	if !slices.Equal(names, want) {
+		t.Errorf("expected files %v, got %v", want, names)
+	}
+
+	wantConfigMap := `apiVersion: v1
+data:
+  a: "1"
+  b: "2"
+kind: ConfigMap
+metadata:
+  labels: null
+  name: demo
+  namespace: demo
+`
+	if got := string(files["configmap-demo.yaml"]); got != wantConfigMap {
+		t.Errorf("unexpected configmap file:\n%s", got)
+	}
+	if got := string(files["clusterrole-system_reader.yaml"]); got != "apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRole\nmetadata:\n  name: system:reader\n" {
+		t.Errorf("expected creationTimestamp to be dropped, got:\n%s", got)
+	}
+}
+
+func TestRenderFilesDuplicate(t *testing.T) {
+	_, err := RenderFiles([]*unstructured.Unstructured{configMap("demo", nil, nil), configMap("demo", nil, nil)})
+	if err == nil {
+		t.Fatal("expected error for duplicate object")
+	}
+}
+
+func TestSyncFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "demo")
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{"same.yaml": "a: 1\n", "old.yaml": "b: 1\n", "stale.yaml": "c: 1\n", "README.md": "keep"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string][]byte{"same.yaml": []byte("a: 1\n"), "old.yaml": []byte("b: 2\n"), "new.yaml": []byte("d: 1\n")}
+
+	want := []FileChange{
+		{Path: filepath.Join(dir, "new.yaml"), Change: ChangeAdded},
+		{Path: filepath.Join(dir, "old.yaml"), Change: ChangeChanged},
+		{Path: filepath.Join(dir, "stale.yaml"), Change: ChangePruned},
+	}
+
+	changes, err := SyncFiles(dir, files, true)
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if !slices.Equal(changes, want) {
+		t.Errorf("expected changes %v, got %v", want, changes)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new.yaml")); !os.IsNotExist(err) {
+		t.Errorf("expected dry run not to write files, got %v", err)
+	}
+
+	if changes, err = SyncFiles(dir, files, false); err != nil || !slices.Equal(changes, want) {
+		t.Fatalf("expected changes %v, got %v (err %v)", want, changes, err)
+	}
+	if changes, err = SyncFiles(dir, files, true); err != nil || len(changes) != 0 {
+		t.Errorf("expected directory to be up to date, got %v (err %v)", changes, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "old.yaml")); string(data) != "b: 2\n" {
+		t.Errorf("expected changed file to be rewritten, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "README.md")); err != nil {
+		t.Errorf("expected non-YAML files to be left alone: %v", err)
+	}
+}
+
+func TestSyncFilesRemovesEmptyDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "gone")
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "configmap-gone.yaml"), []byte("a: 1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := SyncFiles(dir, nil, false); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected empty directory to be removed, got %v", err)
+	}
+}
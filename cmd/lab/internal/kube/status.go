@@ -0,0 +1,233 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+// nodeRoleLabelPrefix marks node roles, e.g. node-role.kubernetes.io/control-plane
+const nodeRoleLabelPrefix = "node-role.kubernetes.io/"
+
+var (
+	nodeGVR        = schema.GroupVersionResource{Version: "v1", Resource: "nodes"}
+	applicationGVR = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "applications"}
+)
+
+// ArgoCDNamespace is where ArgoCD Applications live
+const ArgoCDNamespace = "argocd"
+
+// NodeStatus is the state of one cluster node
+type NodeStatus struct {
+	Name       string    `json:"name"`
+	Ready      bool      `json:"ready"`
+	Roles      []string  `json:"roles"`
+	Version    string    `json:"version"`
+	InternalIP string    `json:"internal_ip,omitempty"`
+	OSImage    string    `json:"os_image,omitempty"`
+	Created    time.Time `json:"created"`
+}
+
+// ApplicationStatus is the state of one ArgoCD Application
+type ApplicationStatus struct {
+	Name     string `json:"name"`
+	Project  string `json:"project"`
+	Sync     string `json:"sync"`
+	Health   string `json:"health"`
+	Revision string `json:"revision,omitempty"`
+	// Message is the health message, or the last operation's message if the
+	// operation failed
+	Message string `json:"message,omitempty"`
+}
+
+// StatusSummary counts nodes and Applications by state, so dashboards can show
+// the cluster at a glance without walking the lists
+type StatusSummary struct {
+	Nodes         int `json:"nodes"`
+	NodesReady    int `json:"nodes_ready"`
+	Applications  int `json:"applications"`
+	AppsSynced    int `json:"apps_synced"`
+	AppsHealthy   int `json:"apps_healthy"`
+	AppsDegraded  int `json:"apps_degraded"`
+	AppsOutOfSync int `json:"apps_out_of_sync"`
+}
+
+// ClusterStatus is a snapshot of node and ArgoCD Application state
+type ClusterStatus struct {
+	Summary      StatusSummary       `json:"summary"`
+	Nodes        []NodeStatus        `json:"nodes"`
+	Applications []ApplicationStatus `json:"applications"`
+	// ApplicationsError explains why Applications is empty when they
+	// couldn't be listed, e.g. because ArgoCD isn't installed
+	ApplicationsError string `json:"applications_error,omitempty"`
+}
+
+// StatusReader reads cluster status through the Kubernetes API
+type StatusReader struct {
+	client dynamic.Interface
+}
+
+// NewStatusReader returns a StatusReader for the cluster described by restConfig
+func NewStatusReader(restConfig *rest.Config) (*StatusReader, error) {
+	client, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("create dynamic client: %w", err)
+	}
+	return &StatusReader{client: client}, nil
+}
+
+// newStatusReaderWithClient returns a StatusReader using the given client
+func newStatusReaderWithClient(client dynamic.Interface) *StatusReader {
+	return &StatusReader{client: client}
+}
+
+// Status returns the current node and Application state. Failing to list
+// Applications is recorded in ApplicationsError rather than returned, since
+// the cluster may not run ArgoCD.
+func (s *StatusReader) Status(ctx context.Context) (*ClusterStatus, error) {
+	nodes, err := s.nodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &ClusterStatus{Nodes: nodes, Applications: []ApplicationStatus{}}
+	apps, err := s.applications(ctx)
+	switch {
+	case apierrors.IsNotFound(err) || meta.IsNoMatchError(err):
+		status.ApplicationsError = "ArgoCD is not installed"
+	case err != nil:
+		status.ApplicationsError = err.Error()
+	default:
+		status.Applications = apps
+	}
+
+	status.Summary = summarize(status)
+	return status, nil
+}
+
+// nodes lists cluster nodes, sorted by name
+func (s *StatusReader) nodes(ctx context.Context) ([]NodeStatus, error) {
+	list, err := s.client.Resource(nodeGVR).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list nodes: %w", err)
+	}
+
+	nodes := make([]NodeStatus, 0, len(list.Items))
+	for _, item := range list.Items {
+		var node corev1.Node
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &node); err != nil {
+			return nil, fmt.Errorf("decode node %s: %w", item.GetName(), err)
+		}
+		nodes = append(nodes, nodeStatus(&node))
+	}
+
+	slices.SortFunc(nodes, func(a, b NodeStatus) int { return strings.Compare(a.Name, b.Name) })
+	return nodes, nil
+}
+
+// nodeStatus extracts the fields `kubectl get nodes -o wide` shows
+func nodeStatus(node *corev1.Node) NodeStatus {
+	ns := NodeStatus{
+		Name:    node.Name,
+		Roles:   []string{},
+		Version: node.Status.NodeInfo.KubeletVersion,
+		OSImage: node.Status.NodeInfo.OSImage,
+		Created: node.CreationTimestamp.Time,
+	}
+
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			ns.Ready = cond.Status == corev1.ConditionTrue
+		}
+	}
+	for label := range node.Labels {
+		if role, ok := strings.CutPrefix(label, nodeRoleLabelPrefix); ok && role != "" {
+			ns.Roles = append(ns.Roles, role)
+		}
+	}
+	slices.Sort(ns.Roles)
+	for _, addr := range node.Status.Addresses {
+		if addr.Type == corev1.NodeInternalIP {
+			ns.InternalIP = addr.Address
+			break
+		}
+	}
+
+	return ns
+}
+
+// applications lists ArgoCD Applications, sorted by name
+func (s *StatusReader) applications(ctx context.Context) ([]ApplicationStatus, error) {
+	list, err := s.client.Resource(applicationGVR).Namespace(ArgoCDNamespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list applications: %w", err)
+	}
+
+	apps := make([]ApplicationStatus, 0, len(list.Items))
+	for i := range list.Items {
+		apps = append(apps, applicationStatus(&list.Items[i]))
+	}
+
+	slices.SortFunc(apps, func(a, b ApplicationStatus) int { return strings.Compare(a.Name, b.Name) })
+	return apps, nil
+}
+
+// applicationStatus extracts sync and health state from an Application
+func applicationStatus(app *unstructured.Unstructured) ApplicationStatus {
+	as := ApplicationStatus{Name: app.GetName()}
+	as.Project, _, _ = unstructured.NestedString(app.Object, "spec", "project")
+	as.Sync, _, _ = unstructured.NestedString(app.Object, "status", "sync", "status")
+	as.Revision, _, _ = unstructured.NestedString(app.Object, "status", "sync", "revision")
+	as.Health, _, _ = unstructured.NestedString(app.Object, "status", "health", "status")
+	as.Message, _, _ = unstructured.NestedString(app.Object, "status", "health", "message")
+
+	phase, _, _ := unstructured.NestedString(app.Object, "status", "operationState", "phase")
+	if phase == "Failed" || phase == "Error" {
+		as.Message, _, _ = unstructured.NestedString(app.Object, "status", "operationState", "message")
+	}
+
+	if as.Sync == "" {
+		as.Sync = "Unknown"
+	}
+	if as.Health == "" {
+		as.Health = "Unknown"
+	}
+	return as
+}
+
+// summarize counts nodes and Applications by state
+func summarize(status *ClusterStatus) StatusSummary {
+	sum := StatusSummary{Nodes: len(status.Nodes), Applications: len(status.Applications)}
+	for _, n := range status.Nodes {
+		if n.Ready {
+			sum.NodesReady++
+		}
+	}
+	for _, a := range status.Applications {
+		switch a.Sync {
+		case "Synced":
+			sum.AppsSynced++
+		case "OutOfSync":
+			sum.AppsOutOfSync++
+		}
+		switch a.Health {
+		case "Healthy":
+			sum.AppsHealthy++
+		case "Degraded", "Missing":
+			sum.AppsDegraded++
+		}
+	}
+	return sum
+}
@@ -0,0 +1,136 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newTestStatusClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			nodeGVR:        "NodeList",
+			applicationGVR: "ApplicationList",
+		}, objects...)
+}
+
+func node(name string, ready bool, roles ...string) *unstructured.Unstructured {
+	status := "False"
+	if ready {
+		status = "True"
+	}
+	labels := map[string]any{"kubernetes.io/hostname": name}
+	for _, role := range roles {
+		labels[nodeRoleLabelPrefix+role] = "true"
+	}
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Node",
+		"metadata":   map[string]any{"name": name, "labels": labels},
+		"status": map[string]any{
+			"conditions": []any{map[string]any{"type": "Ready", "status": status}},
+			"addresses": []any{
+				map[string]any{"type": "Hostname", "address": name},
+				map[string]any{"type": "InternalIP", "address": "10.69.80.10"},
+			},
+			"nodeInfo": map[string]any{"kubeletVersion": "v1.33.1+k3s1", "osImage": "NixOS 25.05"},
+		},
+	}}
+}
+
+func application(name, sync, health string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "Application",
+		"metadata":   map[string]any{"name": name, "namespace": ArgoCDNamespace},
+		"spec":       map[string]any{"project": "default"},
+		"status": map[string]any{
+			"sync":   map[string]any{"status": sync, "revision": "abc123"},
+			"health": map[string]any{"status": health},
+		},
+	}}
+}
+
+func TestStatus(t *testing.T) {
+	failed := application("forgejo", "OutOfSync", "Degraded")
+	failed.Object["status"].(map[string]any)["operationState"] = map[string]any{"phase": "Failed", "message": "one or more objects failed to apply"}
+
+	reader := newStatusReaderWithClient(newTestStatusClient(
+		node("borg-1", false),
+		node("borg-0", true, "control-plane", "etcd"),
+		application("metallb", "Synced", "Healthy"),
+		failed,
+		application("kured", "Synced", "Progressing"),
+	))
+
+	status, err := reader.Status(context.Background())
+	if err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+
+	want := StatusSummary{Nodes: 2, NodesReady: 1, Applications: 3, AppsSynced: 2, AppsHealthy: 1, AppsDegraded: 1, AppsOutOfSync: 1}
+	if status.Summary != want {
+		t.Errorf("expected summary %+v, got %+v", want, status.Summary)
+	}
+
+	if len(status.Nodes) != 2 || status.Nodes[0].Name != "borg-0" {
+		t.Fatalf("expected nodes sorted by name, got %+v", status.Nodes)
+	}
+	n := status.Nodes[0]
+	if !n.Ready || n.Version != "v1.33.1+k3s1" || n.InternalIP != "10.69.80.10" || len(n.Roles) != 2 || n.Roles[0] != "control-plane" {
+		t.Errorf("unexpected node status %+v", n)
+	}
+	if len(status.Nodes[1].Roles) != 0 || status.Nodes[1].Roles == nil {
+		t.Errorf("expected empty (not null) roles, got %#v", status.Nodes[1].Roles)
+	}
+
+	if len(status.Applications) != 3 || status.Applications[0].Name != "forgejo" {
+		t.Fatalf("expected applications sorted by name, got %+v", status.Applications)
+	}
+	if msg := status.Applications[0].Message; msg != "one or more objects failed to apply" {
+		t.Errorf("expected failed operation message, got %q", msg)
+	}
+}
+
+func TestStatusWithoutArgoCD(t *testing.T) {
+	client := newTestStatusClient(node("kind-control-plane", true, "control-plane"))
+	client.PrependReactor("list", "applications", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewNotFound(schema.GroupResource{Group: "argoproj.io", Resource: "applications"}, "")
+	})
+
+	status, err := newStatusReaderWithClient(client).Status(context.Background())
+	if err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+	if status.ApplicationsError != "ArgoCD is not installed" {
+		t.Errorf("expected ArgoCD not installed, got %q", status.ApplicationsError)
+	}
+	if status.Summary.NodesReady != 1 {
+		t.Errorf("expected node to be counted, got %+v", status.Summary)
+	}
+}
+
+func TestClusterStatusJSONKeys(t *testing.T) {
+	status := ClusterStatus{
+		Summary:           StatusSummary{NodesReady: 1, AppsOutOfSync: 1},
+		Nodes:             []NodeStatus{{Name: "node1", InternalIP: "10.0.0.1", OSImage: "NixOS"}},
+		ApplicationsError: "argocd not installed",
+	}
+	data, err := json.Marshal(status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{`"nodes_ready"`, `"apps_out_of_sync"`, `"internal_ip"`, `"os_image"`, `"applications_error"`} {
+		if !strings.Contains(string(data), key) {
+			t.Errorf("expected key %s in %s", key, data)
+		}
+	}
+}
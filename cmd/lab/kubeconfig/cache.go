@@ -0,0 +1,153 @@
+package kubeconfig
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/teekennedy/homelab/cmd/lab/internal/paths"
+)
+
+// DefaultCacheTTL is how long a persistent decrypted kubeconfig may stay on
+// disk before ExpireCache removes it
+const DefaultCacheTTL = 12 * time.Hour
+
+// CacheEntry is a decrypted kubeconfig in the cache directory
+type CacheEntry struct {
+	Env     string    `json:"environment"`
+	Path    string    `json:"path"`
+	ModTime time.Time `json:"mod_time"`
+	// Handle means the copy belongs to a Handle, which removes it on Close
+	Handle bool `json:"handle"`
+	// Expired means the copy is older than the cache TTL
+	Expired bool `json:"expired"`
+	// Stale means the encrypted kubeconfig has changed since the copy was decrypted
+	Stale bool `json:"stale"`
+}
+
+// defaultCacheDir prefers the XDG runtime dir, which is usually a per-user
+// tmpfs cleared on logout, over the persistent XDG cache. The runtime dir is
+// only used when XDG_RUNTIME_DIR is set and exists: the xdg package defaults
+// it to /run/user/<uid>, which doesn't exist on every system.
+func defaultCacheDir() string {
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		if info, err := os.Stat(runtimeDir); err == nil && info.IsDir() {
+			return filepath.Join(runtimeDir, "lab", "k8s")
+		}
+	}
+	return paths.CacheDir("k8s")
+}
+
+// ListCached returns the decrypted kubeconfigs in the cache directory, both
+// persistent copies (<env>.yaml) and per-handle copies (<env>.<random>.yaml)
+func (m *Manager) ListCached() ([]CacheEntry, error) {
+	kubeconfigCacheDir := filepath.Join(m.cacheDir, "kubeconfig")
+	entries, err := os.ReadDir(kubeconfigCacheDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read kubeconfig cache dir: %w", err)
+	}
+
+	now := time.Now()
+	var cached []CacheEntry
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".yaml" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // Removed since ReadDir
+		}
+
+		env, _, handle := strings.Cut(strings.TrimSuffix(entry.Name(), ".yaml"), ".")
+		c := CacheEntry{
+			Env:     env,
+			Path:    filepath.Join(kubeconfigCacheDir, entry.Name()),
+			ModTime: info.ModTime(),
+			Handle:  handle,
+			Expired: m.cacheTTL > 0 && now.Sub(info.ModTime()) > m.cacheTTL,
+		}
+		if encInfo, err := os.Stat(m.GetEncryptedPath(env)); err == nil && encInfo.ModTime().After(c.ModTime) {
+			c.Stale = true
+		}
+		cached = append(cached, c)
+	}
+
+	return cached, nil
+}
+
+// ExpireCache securely removes decrypted kubeconfigs older than the cache TTL
+// and returns their paths. A TTL of zero or less disables expiry. This covers
+// per-handle copies too, so credentials left behind by a killed process don't
+// outlive the TTL; a command still running after the TTL loses its copy.
+func (m *Manager) ExpireCache() ([]string, error) {
+	if m.cacheTTL <= 0 {
+		return nil, nil
+	}
+
+	cached, err := m.ListCached()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	var errs []error
+	for _, c := range cached {
+		if !c.Expired {
+			continue
+		}
+		if err := secureRemove(c.Path); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		removed = append(removed, c.Path)
+	}
+
+	return removed, errors.Join(errs...)
+}
+
+// secureRemove overwrites a file with zeros before removing it, so the
+// decrypted credentials don't linger in freed blocks of a persistent disk.
+// A missing file is not an error.
+func secureRemove(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0) //nolint:gosec // path is a decrypted kubeconfig in the lab cache dir
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+
+	info, err := f.Stat()
+	if err == nil {
+		_, err = io.CopyN(f, zeroReader{}, info.Size())
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("overwrite %s: %w", path, err)
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove %s: %w", path, err)
+	}
+	return nil
+}
+
+// zeroReader is an io.Reader that produces an endless stream of zero bytes
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
@@ -0,0 +1,210 @@
+package kubeconfig
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/teekennedy/homelab/cmd/lab/internal/paths"
+)
+
+// writeCacheFile writes a decrypted kubeconfig into the manager's cache dir with the given age
+func writeCacheFile(t *testing.T, mgr *Manager, name string, age time.Duration) string {
+	t.Helper()
+
+	path := filepath.Join(mgr.cacheDir, "kubeconfig", name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("apiVersion: v1\nkind: Config\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(-age)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestListCached(t *testing.T) {
+	tmpDir := t.TempDir()
+	mgr := NewManager(
+		WithConfigDir(filepath.Join(tmpDir, "config")),
+		WithCacheDir(filepath.Join(tmpDir, "cache")),
+		WithCacheTTL(time.Hour),
+	)
+
+	// The encrypted kubeconfig was updated 30 minutes ago
+	encPath := mgr.GetEncryptedPath("production")
+	if err := os.MkdirAll(filepath.Dir(encPath), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(encPath, []byte("sops: {}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	encTime := time.Now().Add(-30 * time.Minute)
+	if err := os.Chtimes(encPath, encTime, encTime); err != nil {
+		t.Fatal(err)
+	}
+
+	writeCacheFile(t, mgr, "production.yaml", 2*time.Hour)
+	writeCacheFile(t, mgr, "production.123456.yaml", time.Minute)
+	writeCacheFile(t, mgr, "staging.yaml", time.Minute)
+	writeCacheFile(t, mgr, "staging.654321.yaml", 2*time.Hour)
+	writeCacheFile(t, mgr, "notes.txt", 2*time.Hour)
+
+	cached, err := mgr.ListCached()
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(cached) != 4 {
+		t.Fatalf("expected 4 cached kubeconfigs, got %d: %+v", len(cached), cached)
+	}
+
+	byName := map[string]CacheEntry{}
+	for _, c := range cached {
+		byName[filepath.Base(c.Path)] = c
+	}
+
+	if c := byName["production.yaml"]; c.Env != "production" || !c.Expired || !c.Stale {
+		t.Errorf("expected old production copy to be expired and stale, got %+v", c)
+	}
+	if c := byName["production.123456.yaml"]; c.Env != "production" || !c.Handle || c.Expired || c.Stale {
+		t.Errorf("expected handle copy to be fresh, got %+v", c)
+	}
+	if c := byName["staging.yaml"]; c.Env != "staging" || c.Handle || c.Expired || c.Stale {
+		t.Errorf("expected staging copy to be fresh, got %+v", c)
+	}
+	if c := byName["staging.654321.yaml"]; c.Env != "staging" || !c.Handle || !c.Expired {
+		t.Errorf("expected old handle copy to be expired, got %+v", c)
+	}
+}
+
+func TestExpireCache(t *testing.T) {
+	tmpDir := t.TempDir()
+	mgr := NewManager(
+		WithConfigDir(filepath.Join(tmpDir, "config")),
+		WithCacheDir(filepath.Join(tmpDir, "cache")),
+		WithCacheTTL(time.Hour),
+	)
+
+	expired := writeCacheFile(t, mgr, "production.yaml", 2*time.Hour)
+	fresh := writeCacheFile(t, mgr, "staging.yaml", time.Minute)
+	// Left behind by a killed process
+	orphan := writeCacheFile(t, mgr, "production.123456.yaml", 2*time.Hour)
+	live := writeCacheFile(t, mgr, "staging.654321.yaml", time.Minute)
+
+	removed, err := mgr.ExpireCache()
+	if err != nil {
+		t.Fatalf("expire failed: %v", err)
+	}
+	slices.Sort(removed)
+	if want := []string{orphan, expired}; !slices.Equal(removed, want) {
+		t.Errorf("expected %v to be removed, got %v", want, removed)
+	}
+	for _, path := range []string{expired, orphan} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed", path)
+		}
+	}
+	for _, path := range []string{fresh, live} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected %s to remain", path)
+		}
+	}
+}
+
+func TestExpireCacheDisabled(t *testing.T) {
+	tmpDir := t.TempDir()
+	mgr := NewManager(WithCacheDir(filepath.Join(tmpDir, "cache")), WithCacheTTL(0))
+
+	path := writeCacheFile(t, mgr, "production.yaml", 365*24*time.Hour)
+
+	removed, err := mgr.ExpireCache()
+	if err != nil || len(removed) != 0 {
+		t.Errorf("expected expiry to be disabled, got %v, %v", removed, err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Error("expected copy to remain when expiry is disabled")
+	}
+}
+
+func TestCleanupAllSkipsLiveHandles(t *testing.T) {
+	tmpDir := t.TempDir()
+	mgr := NewManager(WithCacheDir(filepath.Join(tmpDir, "cache")), WithCacheTTL(time.Hour))
+
+	persistent := writeCacheFile(t, mgr, "production.yaml", time.Minute)
+	orphan := writeCacheFile(t, mgr, "production.123456.yaml", 2*time.Hour)
+	live := writeCacheFile(t, mgr, "staging.654321.yaml", time.Minute)
+
+	if err := mgr.CleanupAll(); err != nil {
+		t.Fatalf("cleanup failed: %v", err)
+	}
+	for _, path := range []string{persistent, orphan} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed", path)
+		}
+	}
+	if _, err := os.Stat(live); err != nil {
+		t.Error("expected live handle copy to remain")
+	}
+}
+
+func TestDefaultCacheDir(t *testing.T) {
+	runtimeDir := t.TempDir()
+
+	tests := []struct {
+		name       string
+		runtimeDir string
+		want       string
+	}{
+		{"runtime dir", runtimeDir, filepath.Join(runtimeDir, "lab", "k8s")},
+		{"unset", "", paths.CacheDir("k8s")},
+		{"missing", filepath.Join(runtimeDir, "missing"), paths.CacheDir("k8s")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_RUNTIME_DIR", tt.runtimeDir)
+			if got := defaultCacheDir(); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSecureRemoveOverwrites(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "production.yaml")
+	secret := []byte("client-key-data: c2VjcmV0\n")
+	if err := os.WriteFile(path, secret, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A hard link keeps the inode reachable so we can inspect it after removal
+	link := filepath.Join(tmpDir, "link")
+	if err := os.Link(path, link); err != nil {
+		t.Skipf("hard links not supported: %v", err)
+	}
+
+	if err := secureRemove(path); err != nil {
+		t.Fatalf("secure remove failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expected file to be removed")
+	}
+
+	content, err := os.ReadFile(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, make([]byte, len(secret))) {
+		t.Errorf("expected file contents to be zeroed, got %q", content)
+	}
+
+	if err := secureRemove(path); err != nil {
+		t.Errorf("expected removing a missing file to succeed, got %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package kubeconfig
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Certificate kinds found in a kubeconfig
+const (
+	CertKindCA     = "ca"
+	CertKindClient = "client"
+)
+
+// ErrNoCertificates means a kubeconfig has no certificates to check, e.g. it
+// authenticates with a token
+var ErrNoCertificates = errors.New("no certificates in kubeconfig")
+
+// CertInfo describes a certificate embedded in or referenced by a kubeconfig
+type CertInfo struct {
+	// Kind is CertKindCA for cluster CAs or CertKindClient for user certificates
+	Kind string `json:"kind"`
+	// Name is the kubeconfig cluster or user entry the certificate belongs to
+	Name      string    `json:"name"`
+	Subject   string    `json:"subject"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+}
+
+// DaysLeft returns the number of whole days until the certificate expires,
+// negative once it has expired
+func (c CertInfo) DaysLeft(now time.Time) int {
+	return int(math.Floor(c.NotAfter.Sub(now).Hours() / 24))
+}
+
+// ParseCertificates returns the cluster CA and user client certificates in a
+// kubeconfig, sorted by expiry (soonest first). Certificates may be inline
+// (*-data fields) or referenced by file path.
+func ParseCertificates(data []byte) ([]CertInfo, error) {
+	cfg, err := clientcmd.Load(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse kubeconfig: %w", err)
+	}
+
+	var certs []CertInfo
+	for name, cluster := range cfg.Clusters {
+		found, err := parseCertSource(cluster.CertificateAuthorityData, cluster.CertificateAuthority, CertKindCA, name)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, found...)
+	}
+	for name, user := range cfg.AuthInfos {
+		found, err := parseCertSource(user.ClientCertificateData, user.ClientCertificate, CertKindClient, name)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, found...)
+	}
+
+	slices.SortFunc(certs, func(a, b CertInfo) int {
+		return a.NotAfter.Compare(b.NotAfter)
+	})
+
+	return certs, nil
+}
+
+// parseCertSource parses PEM data, reading it from path if no inline data is set
+func parseCertSource(data []byte, path, kind, name string) ([]CertInfo, error) {
+	if len(data) == 0 && path != "" {
+		var err error
+		data, err = os.ReadFile(path) //nolint:gosec // path comes from the kubeconfig being inspected
+		if err != nil {
+			return nil, fmt.Errorf("read %s certificate for %s: %w", kind, name, err)
+		}
+	}
+
+	var certs []CertInfo
+	for rest := data; len(rest) > 0; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s certificate for %s: %w", kind, name, err)
+		}
+		certs = append(certs, CertInfo{
+			Kind:      kind,
+			Name:      name,
+			Subject:   cert.Subject.String(),
+			NotBefore: cert.NotBefore,
+			NotAfter:  cert.NotAfter,
+		})
+	}
+
+	return certs, nil
+}
+
+// Certificates decrypts the kubeconfig for an environment and returns its
+// certificates, soonest expiry first
+func (m *Manager) Certificates(ctx context.Context, env string) ([]CertInfo, error) {
+	content, err := m.Decrypt(ctx, env)
+	if err != nil {
+		return nil, err
+	}
+
+	certs, err := ParseCertificates(content)
+	if err != nil {
+		return nil, fmt.Errorf("environment %q: %w", env, err)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("environment %q: %w", env, ErrNoCertificates)
+	}
+
+	return certs, nil
+}
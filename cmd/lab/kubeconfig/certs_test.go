@@ -0,0 +1,124 @@
+package kubeconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// generateTestCert returns a PEM-encoded self-signed certificate valid until notAfter
+func generateTestCert(t *testing.T, cn string, notAfter time.Time) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestParseCertificates(t *testing.T) {
+	now := time.Now()
+	caPEM := generateTestCert(t, "k3s-server-ca", now.Add(3650*24*time.Hour))
+	clientPEM := generateTestCert(t, "system:admin", now.Add(20*24*time.Hour))
+
+	data := `apiVersion: v1
+kind: Config
+clusters:
+- name: production
+  cluster:
+    server: https://10.69.80.101:6443
+    certificate-authority-data: ` + base64.StdEncoding.EncodeToString(caPEM) + `
+users:
+- name: production
+  user:
+    client-certificate-data: ` + base64.StdEncoding.EncodeToString(clientPEM) + `
+`
+
+	certs, err := ParseCertificates([]byte(data))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(certs) != 2 {
+		t.Fatalf("expected 2 certificates, got %d", len(certs))
+	}
+
+	// Soonest expiry first
+	if certs[0].Kind != CertKindClient || certs[0].Name != "production" || certs[0].Subject != "CN=system:admin" {
+		t.Errorf("unexpected first certificate: %+v", certs[0])
+	}
+	if certs[1].Kind != CertKindCA {
+		t.Errorf("expected CA certificate second, got %+v", certs[1])
+	}
+	if days := certs[0].DaysLeft(now); days != 19 && days != 20 {
+		t.Errorf("expected ~20 days left, got %d", days)
+	}
+}
+
+func TestParseCertificatesFromFile(t *testing.T) {
+	certPath := filepath.Join(t.TempDir(), "client.crt")
+	if err := os.WriteFile(certPath, generateTestCert(t, "admin", time.Now().Add(time.Hour)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	data := `apiVersion: v1
+kind: Config
+users:
+- name: admin
+  user:
+    client-certificate: ` + certPath + `
+`
+
+	certs, err := ParseCertificates([]byte(data))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(certs) != 1 || certs[0].Name != "admin" {
+		t.Errorf("unexpected certificates: %+v", certs)
+	}
+}
+
+func TestParseCertificatesTokenAuth(t *testing.T) {
+	data := `apiVersion: v1
+kind: Config
+users:
+- name: admin
+  user:
+    token: abc123
+`
+
+	certs, err := ParseCertificates([]byte(data))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(certs) != 0 {
+		t.Errorf("expected no certificates, got %+v", certs)
+	}
+}
+
+func TestDaysLeftExpired(t *testing.T) {
+	now := time.Now()
+	cert := CertInfo{NotAfter: now.Add(-36 * time.Hour)}
+	if days := cert.DaysLeft(now); days != -2 {
+		t.Errorf("expected -2 days, got %d", days)
+	}
+}
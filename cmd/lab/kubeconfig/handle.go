@@ -0,0 +1,76 @@
+package kubeconfig
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Handle is a decrypted kubeconfig scoped to one environment. It never touches
+// the process environment, so handles for several environments can be open at
+// once; commands pick one up through Env or Command.
+type Handle struct {
+	// Environment is the name of the environment the kubeconfig belongs to
+	Environment string
+	// Path is the decrypted kubeconfig file, unique to this handle
+	Path string
+	// Env is the process environment with KUBECONFIG pointing at Path, for exec.Cmd.Env
+	Env []string
+
+	// borrowed handles point at a plaintext kubeconfig the handle doesn't own
+	borrowed bool
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// newHandle returns a handle for the kubeconfig at path
+func newHandle(env, path string) *Handle {
+	return &Handle{
+		Environment: env,
+		Path:        path,
+		Env:         withKubeconfig(os.Environ(), path),
+	}
+}
+
+// NewHandle returns a handle for an existing plaintext kubeconfig, such as
+// the one Kind writes for an ephemeral environment. Closing the handle leaves
+// the file in place.
+func NewHandle(env, path string) *Handle {
+	h := newHandle(env, path)
+	h.borrowed = true
+	return h
+}
+
+// Command returns an exec.Cmd that runs name against the handle's kubeconfig
+func (h *Handle) Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = h.Env
+	return cmd
+}
+
+// Close overwrites and removes the decrypted kubeconfig. It is safe to call more
+// than once, and does nothing for handles from NewHandle.
+func (h *Handle) Close() error {
+	h.closeOnce.Do(func() {
+		if h.borrowed {
+			return
+		}
+		if err := secureRemove(h.Path); err != nil {
+			h.closeErr = fmt.Errorf("remove decrypted kubeconfig: %w", err)
+		}
+	})
+	return h.closeErr
+}
+
+// withKubeconfig returns a copy of environ with KUBECONFIG replaced by path
+func withKubeconfig(environ []string, path string) []string {
+	out := slices.DeleteFunc(slices.Clone(environ), func(kv string) bool {
+		return strings.HasPrefix(kv, "KUBECONFIG=")
+	})
+	return append(out, "KUBECONFIG="+path)
+}
@@ -0,0 +1,168 @@
+package kubeconfig
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"filippo.io/age"
+)
+
+// setupHandleTest returns a manager with encrypted kubeconfigs for each env,
+// each pointing at a server named after its environment
+func setupHandleTest(t *testing.T, envs ...string) *Manager {
+	t.Helper()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient := identity.Recipient().String()
+
+	mgr := setupSopsTest(t, encryptForTest(t, testKubeconfig, recipient), identity)
+	for _, env := range envs {
+		plaintext := fmt.Sprintf("apiVersion: v1\nkind: Config\nclusters:\n- name: %[1]s\n  cluster:\n    server: https://%[1]s:6443\n", env)
+		if err := os.WriteFile(mgr.GetEncryptedPath(env), encryptForTest(t, plaintext, recipient), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return mgr
+}
+
+func TestSetupDoesNotTouchProcessEnv(t *testing.T) {
+	t.Setenv("KUBECONFIG", "/original/kubeconfig")
+	mgr := setupHandleTest(t, "production")
+
+	h, err := mgr.Setup(context.Background(), "production")
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	if got := os.Getenv("KUBECONFIG"); got != "/original/kubeconfig" {
+		t.Errorf("expected process KUBECONFIG to be untouched, got %s", got)
+	}
+	if h.Environment != "production" {
+		t.Errorf("expected environment production, got %s", h.Environment)
+	}
+	if !slices.Contains(h.Env, "KUBECONFIG="+h.Path) {
+		t.Error("expected handle env to point KUBECONFIG at the handle's path")
+	}
+	if slices.Contains(h.Env, "KUBECONFIG=/original/kubeconfig") {
+		t.Error("expected original KUBECONFIG to be replaced in handle env")
+	}
+
+	cmd := h.Command(context.Background(), "kubectl", "version")
+	if !slices.Equal(cmd.Env, h.Env) {
+		t.Error("expected command to use the handle's env")
+	}
+
+	info, err := os.Stat(h.Path)
+	if err != nil {
+		t.Fatalf("decrypted kubeconfig missing: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("expected 0600 permissions, got %o", info.Mode().Perm())
+	}
+
+	if err := h.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if err := h.Close(); err != nil {
+		t.Errorf("second close should be a no-op, got %v", err)
+	}
+	if _, err := os.Stat(h.Path); !os.IsNotExist(err) {
+		t.Error("expected decrypted kubeconfig to be removed on close")
+	}
+}
+
+func TestSetupConcurrentEnvironments(t *testing.T) {
+	envs := []string{"production", "staging", "production", "staging"}
+	mgr := setupHandleTest(t, "production", "staging")
+
+	handles := make([]*Handle, len(envs))
+	errs := make([]error, len(envs))
+	var wg sync.WaitGroup
+	for i, env := range envs {
+		wg.Go(func() {
+			handles[i], errs[i] = mgr.Setup(context.Background(), env)
+		})
+	}
+	wg.Wait()
+
+	paths := map[string]bool{}
+	for i, h := range handles {
+		if errs[i] != nil {
+			t.Fatalf("setup %s failed: %v", envs[i], errs[i])
+		}
+		if paths[h.Path] {
+			t.Errorf("handles share path %s", h.Path)
+		}
+		paths[h.Path] = true
+
+		content, err := os.ReadFile(h.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(content, []byte("https://"+envs[i]+":6443")) {
+			t.Errorf("handle for %s has wrong kubeconfig:\n%s", envs[i], content)
+		}
+	}
+
+	// Closing one handle leaves the others usable
+	if err := handles[0].Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range handles[1:] {
+		if _, err := os.Stat(h.Path); err != nil {
+			t.Errorf("expected %s to survive closing another handle: %v", h.Path, err)
+		}
+		_ = h.Close()
+	}
+}
+
+func TestWithKubeconfigClosesHandle(t *testing.T) {
+	mgr := setupHandleTest(t, "production")
+
+	var path string
+	err := mgr.WithKubeconfig(context.Background(), "production", func(h *Handle) error {
+		path = h.Path
+		_, err := os.Stat(h.Path)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WithKubeconfig failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expected decrypted kubeconfig to be removed after WithKubeconfig")
+	}
+}
+
+func TestNewHandleLeavesFileOnClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kind.yaml")
+	if err := os.WriteFile(path, []byte(testKubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHandle("dev", path)
+	if !slices.Contains(h.Env, "KUBECONFIG="+path) {
+		t.Errorf("expected KUBECONFIG=%s in env, got %v", path, h.Env)
+	}
+	if err := h.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("expected kubeconfig to survive closing the handle: %v", err)
+	}
+}
+
+func TestHandleEnvReplacesKubeconfig(t *testing.T) {
+	env := withKubeconfig([]string{"HOME=/home/me", "KUBECONFIG=/a", "PATH=/bin"}, "/b")
+	if !slices.Equal(env, []string{"HOME=/home/me", "PATH=/bin", "KUBECONFIG=/b"}) {
+		t.Errorf("unexpected env: %v", env)
+	}
+}
@@ -0,0 +1,254 @@
+package kubeconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ManagedExtension is the kubeconfig extension name lab uses to mark the
+// cluster, user and context entries it installed
+const ManagedExtension = "lab.homelab/managed"
+
+// ErrUnmanagedConflict means an install would overwrite a kubeconfig entry
+// that lab didn't create
+var ErrUnmanagedConflict = errors.New("entry exists and is not managed by lab")
+
+// managedMarker is the value of the ManagedExtension extension
+type managedMarker struct {
+	Environment string `json:"environment"`
+}
+
+// DefaultContextName returns the context name lab installs an environment as
+func DefaultContextName(env string) string {
+	return "lab-" + env
+}
+
+// Install merges the decrypted kubeconfig for env into the kubeconfig file at
+// target (typically ~/.kube/config) as cluster, user and context contextName.
+// Each entry is marked with ManagedExtension so Uninstall can find it again.
+// Existing lab-managed entries are replaced; unmanaged entries with the same
+// name cause ErrUnmanagedConflict.
+func (m *Manager) Install(ctx context.Context, env, target, contextName string, setCurrent bool) error {
+	content, err := m.Decrypt(ctx, env)
+	if err != nil {
+		return err
+	}
+
+	dst, err := loadKubeconfigFile(target)
+	if err != nil {
+		return err
+	}
+
+	if err := mergeManaged(dst, content, env, contextName); err != nil {
+		return err
+	}
+	if setCurrent {
+		dst.CurrentContext = contextName
+	}
+
+	return writeKubeconfigFile(target, dst)
+}
+
+// Uninstall removes the lab-managed entries for env from the kubeconfig file at
+// target, or every lab-managed entry if env is empty. It returns the names of
+// the removed contexts.
+func Uninstall(target, env string) ([]string, error) {
+	if _, err := os.Stat(target); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	cfg, err := loadKubeconfigFile(target)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := removeManaged(cfg, env)
+	if len(removed) == 0 {
+		return nil, nil
+	}
+
+	return removed, writeKubeconfigFile(target, cfg)
+}
+
+// mergeManaged adds the current context of the kubeconfig in src to dst under
+// contextName, marking every entry as managed by lab for env
+func mergeManaged(dst *clientcmdapi.Config, src []byte, env, contextName string) error {
+	srcCfg, err := clientcmd.Load(src)
+	if err != nil {
+		return fmt.Errorf("parse kubeconfig for %s: %w", env, err)
+	}
+
+	srcContext, ok := srcCfg.Contexts[srcCfg.CurrentContext]
+	if !ok {
+		return fmt.Errorf("kubeconfig for %s has no current context", env)
+	}
+	cluster, ok := srcCfg.Clusters[srcContext.Cluster]
+	if !ok {
+		return fmt.Errorf("kubeconfig for %s has no cluster %q", env, srcContext.Cluster)
+	}
+	user, ok := srcCfg.AuthInfos[srcContext.AuthInfo]
+	if !ok {
+		return fmt.Errorf("kubeconfig for %s has no user %q", env, srcContext.AuthInfo)
+	}
+
+	if c, ok := dst.Clusters[contextName]; ok && !isManaged(c.Extensions) {
+		return fmt.Errorf("cluster %q: %w", contextName, ErrUnmanagedConflict)
+	}
+	if u, ok := dst.AuthInfos[contextName]; ok && !isManaged(u.Extensions) {
+		return fmt.Errorf("user %q: %w", contextName, ErrUnmanagedConflict)
+	}
+	if c, ok := dst.Contexts[contextName]; ok && !isManaged(c.Extensions) {
+		return fmt.Errorf("context %q: %w", contextName, ErrUnmanagedConflict)
+	}
+
+	marker, err := newManagedMarker(env)
+	if err != nil {
+		return err
+	}
+
+	cluster.Extensions = map[string]runtime.Object{ManagedExtension: marker}
+	user.Extensions = map[string]runtime.Object{ManagedExtension: marker}
+	dst.Clusters[contextName] = cluster
+	dst.AuthInfos[contextName] = user
+	dst.Contexts[contextName] = &clientcmdapi.Context{
+		Cluster:    contextName,
+		AuthInfo:   contextName,
+		Namespace:  srcContext.Namespace,
+		Extensions: map[string]runtime.Object{ManagedExtension: marker},
+	}
+
+	return nil
+}
+
+// removeManaged deletes lab-managed entries for env (or all environments if env
+// is empty) and returns the removed context names, sorted
+func removeManaged(cfg *clientcmdapi.Config, env string) []string {
+	var removed []string
+	for name, c := range cfg.Contexts {
+		if matchesManaged(c.Extensions, env) {
+			delete(cfg.Contexts, name)
+			removed = append(removed, name)
+			if cfg.CurrentContext == name {
+				cfg.CurrentContext = ""
+			}
+		}
+	}
+	for name, c := range cfg.Clusters {
+		if matchesManaged(c.Extensions, env) {
+			delete(cfg.Clusters, name)
+		}
+	}
+	for name, u := range cfg.AuthInfos {
+		if matchesManaged(u.Extensions, env) {
+			delete(cfg.AuthInfos, name)
+		}
+	}
+
+	slices.Sort(removed)
+	return removed
+}
+
+// matchesManaged reports whether extensions mark an entry as lab-managed for
+// env, or for any environment if env is empty
+func matchesManaged(extensions map[string]runtime.Object, env string) bool {
+	if !isManaged(extensions) {
+		return false
+	}
+	return env == "" || managedEnv(extensions) == env
+}
+
+// newManagedMarker builds the ManagedExtension value for env
+func newManagedMarker(env string) (*runtime.Unknown, error) {
+	raw, err := json.Marshal(managedMarker{Environment: env})
+	if err != nil {
+		return nil, fmt.Errorf("marshal managed marker: %w", err)
+	}
+	return &runtime.Unknown{Raw: raw, ContentType: runtime.ContentTypeJSON}, nil
+}
+
+// isManaged reports whether extensions carry the lab-managed marker
+func isManaged(extensions map[string]runtime.Object) bool {
+	_, ok := extensions[ManagedExtension]
+	return ok
+}
+
+// managedEnv returns the environment recorded in the lab-managed marker, or ""
+// if the entry isn't managed by lab
+func managedEnv(extensions map[string]runtime.Object) string {
+	unknown, ok := extensions[ManagedExtension].(*runtime.Unknown)
+	if !ok {
+		return ""
+	}
+	var marker managedMarker
+	if err := json.Unmarshal(unknown.Raw, &marker); err != nil {
+		return ""
+	}
+	return marker.Environment
+}
+
+// loadKubeconfigFile reads a kubeconfig file, returning an empty config if it
+// doesn't exist yet
+func loadKubeconfigFile(path string) (*clientcmdapi.Config, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // path is the user's kubeconfig
+	if err != nil {
+		if os.IsNotExist(err) {
+			return clientcmdapi.NewConfig(), nil
+		}
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	cfg, err := clientcmd.Load(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// writeKubeconfigFile writes cfg to path with owner-only permissions. The file
+// is replaced atomically, via a synced temporary file in the same directory,
+// so a crash or full disk can't leave the user's kubeconfig half written. If
+// path is a symlink, its target is replaced.
+func writeKubeconfigFile(path string, cfg *clientcmdapi.Config) error {
+	data, err := clientcmd.Write(*cfg)
+	if err != nil {
+		return fmt.Errorf("serialize kubeconfig: %w", err)
+	}
+
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create kubeconfig directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create temporary kubeconfig: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }() // a no-op once renamed
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("write %s: %w", tmp.Name(), err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replace %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package kubeconfig
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const userKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: work
+  cluster:
+    server: https://work.example.com
+contexts:
+- name: work
+  context:
+    cluster: work
+    user: work
+current-context: work
+users:
+- name: work
+  user:
+    token: secret
+`
+
+const envKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: production
+  cluster:
+    server: https://10.69.80.101:6443
+contexts:
+- name: production
+  context:
+    cluster: production
+    user: production
+current-context: production
+users:
+- name: production
+  user:
+    token: lab-token
+`
+
+func TestInstallAndUninstall(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr := setupSopsTest(t, encryptForTest(t, envKubeconfig, identity.Recipient().String()), identity)
+
+	target := filepath.Join(t.TempDir(), ".kube", "config")
+	if err := os.MkdirAll(filepath.Dir(target), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(target, []byte(userKubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mgr.Install(context.Background(), "test", target, "lab-test", true); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	// Installing again replaces the managed entries rather than conflicting
+	if err := mgr.Install(context.Background(), "test", target, "lab-test", true); err != nil {
+		t.Fatalf("reinstall failed: %v", err)
+	}
+
+	cfg, err := clientcmd.LoadFromFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.CurrentContext != "lab-test" {
+		t.Errorf("expected current-context lab-test, got %q", cfg.CurrentContext)
+	}
+	if cfg.Clusters["lab-test"] == nil || cfg.Clusters["lab-test"].Server != "https://10.69.80.101:6443" {
+		t.Error("expected lab-test cluster to be installed")
+	}
+	if cfg.AuthInfos["lab-test"] == nil || cfg.AuthInfos["lab-test"].Token != "lab-token" {
+		t.Error("expected lab-test user to be installed")
+	}
+	if cfg.Contexts["work"] == nil {
+		t.Error("expected existing context to be preserved")
+	}
+
+	removed, err := Uninstall(target, "test")
+	if err != nil {
+		t.Fatalf("uninstall failed: %v", err)
+	}
+	if len(removed) != 1 || removed[0] != "lab-test" {
+		t.Errorf("expected lab-test to be removed, got %v", removed)
+	}
+
+	cfg, err = clientcmd.LoadFromFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Contexts) != 1 || len(cfg.Clusters) != 1 || len(cfg.AuthInfos) != 1 {
+		t.Errorf("expected only the user's entries to remain, got %d contexts, %d clusters, %d users",
+			len(cfg.Contexts), len(cfg.Clusters), len(cfg.AuthInfos))
+	}
+	if cfg.CurrentContext != "" {
+		t.Errorf("expected current-context to be cleared, got %q", cfg.CurrentContext)
+	}
+}
+
+func TestInstallUnmanagedConflict(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr := setupSopsTest(t, encryptForTest(t, envKubeconfig, identity.Recipient().String()), identity)
+
+	target := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(target, []byte(userKubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	err = mgr.Install(context.Background(), "test", target, "work", false)
+	if !errors.Is(err, ErrUnmanagedConflict) {
+		t.Errorf("expected ErrUnmanagedConflict, got %v", err)
+	}
+}
+
+func TestUninstallLeavesOtherEnvironments(t *testing.T) {
+	dst, err := clientcmd.Load([]byte(userKubeconfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mergeManaged(dst, []byte(envKubeconfig), "production", "lab-production"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mergeManaged(dst, []byte(envKubeconfig), "staging", "lab-staging"); err != nil {
+		t.Fatal(err)
+	}
+
+	removed := removeManaged(dst, "staging")
+	if len(removed) != 1 || removed[0] != "lab-staging" {
+		t.Errorf("expected only lab-staging removed, got %v", removed)
+	}
+	if dst.Contexts["lab-production"] == nil || dst.Clusters["lab-production"] == nil {
+		t.Error("expected lab-production to remain")
+	}
+
+	removed = removeManaged(dst, "")
+	if len(removed) != 1 || removed[0] != "lab-production" {
+		t.Errorf("expected lab-production removed, got %v", removed)
+	}
+	if dst.Contexts["work"] == nil {
+		t.Error("expected unmanaged context to remain")
+	}
+}
+
+func TestUninstallMissingFile(t *testing.T) {
+	removed, err := Uninstall(filepath.Join(t.TempDir(), "config"), "")
+	if err != nil || removed != nil {
+		t.Errorf("expected no-op, got %v, %v", removed, err)
+	}
+}
+
+func TestWriteKubeconfigFileReplacesAtomically(t *testing.T) {
+	dir := t.TempDir()
+	// A kubeconfig managed elsewhere, e.g. by a dotfiles repo, and linked in
+	real := filepath.Join(dir, "dotfiles", "kubeconfig")
+	if err := os.MkdirAll(filepath.Dir(real), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(real, []byte(userKubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(dir, ".kube", "config")
+	if err := os.MkdirAll(filepath.Dir(target), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(real, target); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	cfg, err := clientcmd.Load([]byte(envKubeconfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeKubeconfigFile(target, cfg); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	if info, err := os.Lstat(target); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("expected %s to remain a symlink", target)
+	}
+	written, err := clientcmd.LoadFromFile(real)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written.CurrentContext != "production" {
+		t.Errorf("expected the link target to be replaced, got current-context %q", written.CurrentContext)
+	}
+	info, err := os.Stat(real)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("expected owner-only permissions, got %v", info.Mode().Perm())
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(real))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected no temporary files to be left behind, got %d entries", len(entries))
+	}
+}
@@ -0,0 +1,58 @@
+package kubeconfig
+
+import (
+	"errors"
+	"fmt"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// K3sKubeconfigPath is where k3s servers write their admin kubeconfig
+const K3sKubeconfigPath = "/etc/rancher/k3s/k3s.yaml"
+
+// RewriteK3s converts the admin kubeconfig written by a k3s server into one
+// for env. k3s names its cluster, user and context "default" and points at
+// 127.0.0.1, so the entries are renamed to env and the server is replaced.
+func RewriteK3s(data []byte, env, server string) ([]byte, error) {
+	src, err := clientcmd.Load(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse k3s kubeconfig: %w", err)
+	}
+
+	contextName := src.CurrentContext
+	if contextName == "" && len(src.Contexts) == 1 {
+		for name := range src.Contexts {
+			contextName = name
+		}
+	}
+	srcContext, ok := src.Contexts[contextName]
+	if !ok {
+		return nil, errors.New("k3s kubeconfig has no current context")
+	}
+
+	cluster, ok := src.Clusters[srcContext.Cluster]
+	if !ok {
+		return nil, fmt.Errorf("k3s kubeconfig has no cluster %q", srcContext.Cluster)
+	}
+	user, ok := src.AuthInfos[srcContext.AuthInfo]
+	if !ok {
+		return nil, fmt.Errorf("k3s kubeconfig has no user %q", srcContext.AuthInfo)
+	}
+
+	if server != "" {
+		cluster.Server = server
+	}
+
+	out := clientcmdapi.NewConfig()
+	out.Clusters[env] = cluster
+	out.AuthInfos[env] = user
+	out.Contexts[env] = &clientcmdapi.Context{Cluster: env, AuthInfo: env, Namespace: srcContext.Namespace}
+	out.CurrentContext = env
+
+	result, err := clientcmd.Write(*out)
+	if err != nil {
+		return nil, fmt.Errorf("serialize kubeconfig: %w", err)
+	}
+	return result, nil
+}
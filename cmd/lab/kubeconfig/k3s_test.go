@@ -0,0 +1,85 @@
+package kubeconfig
+
+import (
+	"testing"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const testK3sKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    certificate-authority-data: Y2EK
+    server: https://127.0.0.1:6443
+  name: default
+contexts:
+- context:
+    cluster: default
+    user: default
+  name: default
+current-context: default
+preferences: {}
+users:
+- name: default
+  user:
+    client-certificate-data: Y2VydAo=
+    client-key-data: a2V5Cg==
+`
+
+func TestRewriteK3s(t *testing.T) {
+	out, err := RewriteK3s([]byte(testK3sKubeconfig), "production", "https://10.69.80.101:6443")
+	if err != nil {
+		t.Fatalf("rewrite failed: %v", err)
+	}
+
+	cfg, err := clientcmd.Load(out)
+	if err != nil {
+		t.Fatalf("rewritten kubeconfig does not parse: %v", err)
+	}
+
+	if cfg.CurrentContext != "production" {
+		t.Errorf("expected current-context production, got %q", cfg.CurrentContext)
+	}
+	ctx, ok := cfg.Contexts["production"]
+	if !ok || ctx.Cluster != "production" || ctx.AuthInfo != "production" {
+		t.Errorf("unexpected context: %+v", ctx)
+	}
+	cluster, ok := cfg.Clusters["production"]
+	if !ok {
+		t.Fatal("expected cluster named production")
+	}
+	if cluster.Server != "https://10.69.80.101:6443" {
+		t.Errorf("expected server to be rewritten, got %s", cluster.Server)
+	}
+	if string(cluster.CertificateAuthorityData) != "ca\n" {
+		t.Errorf("expected CA data to be preserved, got %q", cluster.CertificateAuthorityData)
+	}
+	if user, ok := cfg.AuthInfos["production"]; !ok || string(user.ClientKeyData) != "key\n" {
+		t.Error("expected user credentials to be preserved")
+	}
+	if _, ok := cfg.Clusters["default"]; ok {
+		t.Error("expected default cluster to be renamed")
+	}
+}
+
+func TestRewriteK3sKeepsServer(t *testing.T) {
+	out, err := RewriteK3s([]byte(testK3sKubeconfig), "staging", "")
+	if err != nil {
+		t.Fatalf("rewrite failed: %v", err)
+	}
+
+	cfg, err := clientcmd.Load(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Clusters["staging"].Server; got != "https://127.0.0.1:6443" {
+		t.Errorf("expected server to be unchanged, got %s", got)
+	}
+}
+
+func TestRewriteK3sInvalid(t *testing.T) {
+	if _, err := RewriteK3s([]byte("apiVersion: v1\nkind: Config\n"), "production", ""); err == nil {
+		t.Error("expected error for kubeconfig without contexts")
+	}
+}
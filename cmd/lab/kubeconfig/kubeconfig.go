@@ -6,21 +6,19 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"sync"
+	"time"
 
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+	sopsconfig "github.com/getsops/sops/v3/config"
 	"github.com/teekennedy/homelab/cmd/lab/internal/paths"
 )
 
 // Manager handles kubeconfig files for different environments
 type Manager struct {
-	configDir   string
-	cacheDir    string
-	mu          sync.Mutex
-	activeEnv   string
-	tempFile    string
-	originalEnv string
+	configDir string
+	cacheDir  string
+	cacheTTL  time.Duration
 }
 
 // ManagerOption is a functional option for configuring Manager
@@ -40,11 +38,20 @@ func WithCacheDir(dir string) ManagerOption {
 	}
 }
 
+// WithCacheTTL sets how long decrypted kubeconfigs may stay in the cache
+// directory before ExpireCache removes them. Zero or less disables expiry.
+func WithCacheTTL(ttl time.Duration) ManagerOption {
+	return func(m *Manager) {
+		m.cacheTTL = ttl
+	}
+}
+
 // NewManager creates a new kubeconfig manager with XDG-compliant defaults
 func NewManager(opts ...ManagerOption) *Manager {
 	m := &Manager{
 		configDir: paths.ProjectConfigDir(), // Project config is in source control
-		cacheDir:  paths.CacheDir("k8s"),    // Decrypted files go in XDG cache
+		cacheDir:  defaultCacheDir(),        // Decrypted files go in XDG runtime (or cache) dir
+		cacheTTL:  DefaultCacheTTL,
 	}
 
 	for _, opt := range opts {
@@ -70,40 +77,80 @@ func (m *Manager) Exists(env string) bool {
 	return err == nil
 }
 
-// Decrypt decrypts the kubeconfig for the given environment and returns the content
+// Decrypt decrypts the kubeconfig for the given environment and returns the content.
+// Decryption uses the sops Go library, so keys are discovered the same way the sops
+// CLI does (SOPS_AGE_KEY, SOPS_AGE_KEY_FILE, ~/.config/sops/age/keys.txt, gpg-agent)
+// without needing the sops binary. Failures other than ctx being done are
+// returned as a *DecryptError.
 func (m *Manager) Decrypt(ctx context.Context, env string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	encPath := m.GetEncryptedPath(env)
 
-	if _, err := os.Stat(encPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("kubeconfig for environment %q not found at %s", env, encPath)
+	data, err := os.ReadFile(encPath) //nolint:gosec // encPath is derived from the project config dir + env name
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, &DecryptError{Env: env, Path: encPath, Kind: ErrNotFound}
+		}
+		return nil, &DecryptError{Env: env, Path: encPath, Kind: ErrRead, Cause: err}
 	}
 
-	// Use sops to decrypt
-	cmd := exec.CommandContext(ctx, "sops", "decrypt", encPath)
-	output, err := cmd.Output()
+	content, err := decryptSops(ctx, data, formats.FormatForPath(encPath))
 	if err != nil {
-		var exitErr *exec.ExitError
-		if errors.As(err, &exitErr) {
-			return nil, fmt.Errorf("sops decrypt failed: %s", string(exitErr.Stderr))
+		var decErr *DecryptError
+		if errors.As(err, &decErr) {
+			decErr.Env = env
+			decErr.Path = encPath
 		}
-		return nil, fmt.Errorf("sops decrypt failed: %w", err)
+		return nil, err
 	}
 
-	return output, nil
+	return content, nil
 }
 
-// Setup decrypts the kubeconfig and sets up the environment for kubectl/helm commands
-// It writes the decrypted kubeconfig to a temp file and sets KUBECONFIG env var
-// Returns a cleanup function that should be called when done
-func (m *Manager) Setup(ctx context.Context, env string) (cleanup func(), err error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// Encrypt sops-encrypts a plaintext kubeconfig and writes it to the environment's
+// encrypted path. Recipients come from the creation rule matching that path in the
+// nearest .sops.yaml, the same lookup `sops encrypt` performs.
+func (m *Manager) Encrypt(env string, plaintext []byte) error {
+	encPath, err := filepath.Abs(m.GetEncryptedPath(env))
+	if err != nil {
+		return fmt.Errorf("resolve encrypted path: %w", err)
+	}
 
-	// Store original KUBECONFIG
-	m.originalEnv = os.Getenv("KUBECONFIG")
-	m.activeEnv = env
+	confPath, err := sopsconfig.FindConfigFile(filepath.Dir(encPath))
+	if err != nil {
+		return fmt.Errorf("find .sops.yaml: %w", err)
+	}
 
-	// Decrypt the kubeconfig
+	rule, err := sopsconfig.LoadCreationRuleForFile(confPath, encPath, nil)
+	if err != nil {
+		return fmt.Errorf("load sops creation rule for %s: %w", encPath, err)
+	}
+	if rule == nil {
+		return fmt.Errorf("no sops creation rules in %s", confPath)
+	}
+
+	encrypted, err := encryptSops(plaintext, formats.FormatForPath(encPath), rule)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(encPath), 0o750); err != nil {
+		return fmt.Errorf("create kubeconfig directory: %w", err)
+	}
+	if err := os.WriteFile(encPath, encrypted, 0o600); err != nil {
+		return fmt.Errorf("write encrypted kubeconfig: %w", err)
+	}
+
+	return nil
+}
+
+// Setup decrypts the kubeconfig for env into a file of its own and returns a
+// handle to it. The process environment is left alone: run commands through the
+// handle's Env or Command, and Close it when done to remove the decrypted file.
+// Handles for the same or different environments can be used concurrently.
+func (m *Manager) Setup(ctx context.Context, env string) (*Handle, error) {
 	content, err := m.Decrypt(ctx, env)
 	if err != nil {
 		return nil, err
@@ -115,45 +162,29 @@ func (m *Manager) Setup(ctx context.Context, env string) (cleanup func(), err er
 		return nil, fmt.Errorf("create kubeconfig cache dir: %w", err)
 	}
 
-	// Write to temp file with restricted permissions
-	tempPath := m.GetDecryptedPath(env)
-	if err := os.WriteFile(tempPath, content, 0o600); err != nil {
-		return nil, fmt.Errorf("write decrypted kubeconfig: %w", err)
+	// CreateTemp gives each handle its own file with owner-only permissions
+	f, err := os.CreateTemp(kubeconfigCacheDir, env+".*.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("create decrypted kubeconfig: %w", err)
 	}
-	m.tempFile = tempPath
-
-	// Set KUBECONFIG environment variable
-	_ = os.Setenv("KUBECONFIG", tempPath)
+	h := newHandle(env, f.Name())
 
-	// Return cleanup function
-	cleanup = func() {
-		m.mu.Lock()
-		defer m.mu.Unlock()
-
-		// Remove the temp file
-		if m.tempFile != "" {
-			_ = os.Remove(m.tempFile)
-			m.tempFile = ""
-		}
-
-		// Restore original KUBECONFIG
-		if m.originalEnv != "" {
-			_ = os.Setenv("KUBECONFIG", m.originalEnv)
-		} else {
-			_ = os.Unsetenv("KUBECONFIG")
-		}
-		m.activeEnv = ""
+	if _, err := f.Write(content); err != nil {
+		_ = f.Close()
+		_ = h.Close()
+		return nil, fmt.Errorf("write decrypted kubeconfig: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		_ = h.Close()
+		return nil, fmt.Errorf("write decrypted kubeconfig: %w", err)
 	}
 
-	return cleanup, nil
+	return h, nil
 }
 
-// SetupPersistent sets up the kubeconfig without automatic cleanup
-// The decrypted file will persist until explicitly cleaned up
+// SetupPersistent decrypts the kubeconfig to GetDecryptedPath without automatic
+// cleanup. The decrypted file will persist until explicitly cleaned up.
 func (m *Manager) SetupPersistent(ctx context.Context, env string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	// Decrypt the kubeconfig
 	content, err := m.Decrypt(ctx, env)
 	if err != nil {
@@ -167,63 +198,34 @@ func (m *Manager) SetupPersistent(ctx context.Context, env string) error {
 	}
 
 	// Write to file with restricted permissions
-	decPath := m.GetDecryptedPath(env)
-	if err := os.WriteFile(decPath, content, 0o600); err != nil {
+	if err := os.WriteFile(m.GetDecryptedPath(env), content, 0o600); err != nil {
 		return fmt.Errorf("write decrypted kubeconfig: %w", err)
 	}
 
-	// Set KUBECONFIG environment variable
-	_ = os.Setenv("KUBECONFIG", decPath)
-	m.activeEnv = env
-	m.tempFile = decPath
-
 	return nil
 }
 
-// ActiveEnvironment returns the currently active environment
-func (m *Manager) ActiveEnvironment() string {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	return m.activeEnv
-}
-
-// Cleanup removes any decrypted kubeconfig files and restores the environment
-func (m *Manager) Cleanup() {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	if m.tempFile != "" {
-		_ = os.Remove(m.tempFile)
-		m.tempFile = ""
-	}
-
-	if m.originalEnv != "" {
-		_ = os.Setenv("KUBECONFIG", m.originalEnv)
-	} else {
-		_ = os.Unsetenv("KUBECONFIG")
-	}
-	m.activeEnv = ""
-}
-
-// CleanupAll removes all decrypted kubeconfig files from the cache directory
+// CleanupAll securely removes the decrypted kubeconfig files in the cache
+// directory. Per-handle copies younger than the cache TTL are left alone, since
+// a running command may still be using them; with expiry disabled, all of them
+// are. Their commands remove them on exit.
 func (m *Manager) CleanupAll() error {
-	kubeconfigCacheDir := filepath.Join(m.cacheDir, "kubeconfig")
-	if _, err := os.Stat(kubeconfigCacheDir); os.IsNotExist(err) {
-		return nil
-	}
-
-	entries, err := os.ReadDir(kubeconfigCacheDir)
+	cached, err := m.ListCached()
 	if err != nil {
-		return fmt.Errorf("read kubeconfig cache dir: %w", err)
+		return err
 	}
 
-	for _, entry := range entries {
-		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".yaml" {
-			_ = os.Remove(filepath.Join(kubeconfigCacheDir, entry.Name()))
+	var errs []error
+	for _, c := range cached {
+		if c.Handle && !c.Expired {
+			continue
+		}
+		if err := secureRemove(c.Path); err != nil {
+			errs = append(errs, err)
 		}
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
 // ListEnvironments returns a list of environments that have kubeconfig files
@@ -253,16 +255,16 @@ func (m *Manager) ListEnvironments() ([]string, error) {
 	return envs, nil
 }
 
-// WithKubeconfig executes a function with the kubeconfig for the given environment
-// The kubeconfig is automatically set up and cleaned up
-func (m *Manager) WithKubeconfig(ctx context.Context, env string, fn func() error) error {
-	cleanup, err := m.Setup(ctx, env)
+// WithKubeconfig executes a function with a handle to the kubeconfig for the given
+// environment. The handle is automatically set up and closed.
+func (m *Manager) WithKubeconfig(ctx context.Context, env string, fn func(*Handle) error) error {
+	h, err := m.Setup(ctx, env)
 	if err != nil {
 		return err
 	}
-	defer cleanup()
+	defer func() { _ = h.Close() }()
 
-	return fn()
+	return fn(h)
 }
 
 // GetKubeconfigEnv returns the KUBECONFIG path for the given environment
@@ -182,15 +182,6 @@ func TestCleanupAll(t *testing.T) {
 	}
 }
 
-func TestActiveEnvironment(t *testing.T) {
-	mgr := NewManager(WithConfigDir("/config"), WithCacheDir("/cache"))
-
-	// Initially should be empty
-	if mgr.ActiveEnvironment() != "" {
-		t.Error("expected active environment to be empty initially")
-	}
-}
-
 func TestDecryptMissingFile(t *testing.T) {
 	// Create a temp directory structure
 	tmpDir, err := os.MkdirTemp("", "kubeconfig-test")
@@ -246,56 +237,3 @@ func TestSetupPersistentCreatesDir(t *testing.T) {
 		t.Log("Cache directory not created (expected if decrypt fails early)")
 	}
 }
-
-func TestCleanup(t *testing.T) {
-	// Create a temp directory structure
-	tmpDir, err := os.MkdirTemp("", "kubeconfig-test")
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer func() { _ = os.RemoveAll(tmpDir) }()
-
-	configDir := filepath.Join(tmpDir, "config")
-	cacheDir := filepath.Join(tmpDir, "cache")
-	kubeconfigCacheDir := filepath.Join(cacheDir, "kubeconfig")
-
-	// Create the kubeconfig cache directory
-	if err := os.MkdirAll(kubeconfigCacheDir, 0o750); err != nil {
-		t.Fatal(err)
-	}
-
-	// Create a test file
-	testFile := filepath.Join(kubeconfigCacheDir, "test.yaml")
-	if err := os.WriteFile(testFile, []byte("test"), 0o600); err != nil {
-		t.Fatal(err)
-	}
-
-	mgr := NewManager(WithConfigDir(configDir), WithCacheDir(cacheDir))
-	mgr.tempFile = testFile
-	mgr.activeEnv = "test"
-
-	// Set an original env var
-	origKubeconfig := os.Getenv("KUBECONFIG")
-	if err := os.Setenv("KUBECONFIG", "/some/path"); err != nil {
-		t.Fatal(err)
-	}
-	mgr.originalEnv = origKubeconfig
-
-	// Run cleanup
-	mgr.Cleanup()
-
-	// Verify file is removed
-	if _, err := os.Stat(testFile); !os.IsNotExist(err) {
-		t.Error("expected temp file to be removed")
-	}
-
-	// Verify active env is cleared
-	if mgr.activeEnv != "" {
-		t.Error("expected active env to be cleared")
-	}
-
-	// Verify temp file path is cleared
-	if mgr.tempFile != "" {
-		t.Error("expected temp file path to be cleared")
-	}
-}
@@ -0,0 +1,162 @@
+package kubeconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/getsops/sops/v3"
+	"github.com/getsops/sops/v3/aes"
+	"github.com/getsops/sops/v3/cmd/sops/common"
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+	"github.com/getsops/sops/v3/config"
+	"github.com/getsops/sops/v3/version"
+)
+
+// Decryption failure kinds. Use errors.Is to check which one a *DecryptError is.
+var (
+	// ErrNotFound means the encrypted kubeconfig file doesn't exist
+	ErrNotFound = errors.New("kubeconfig not found")
+	// ErrRead means the encrypted kubeconfig file exists but can't be read
+	ErrRead = errors.New("kubeconfig can't be read")
+	// ErrNotEncrypted means the file has no sops metadata or can't be parsed
+	ErrNotEncrypted = errors.New("kubeconfig is not a sops-encrypted file")
+	// ErrNoMatchingKey means none of the available age/PGP keys can decrypt the data key
+	ErrNoMatchingKey = errors.New("no matching decryption key")
+	// ErrDecrypt means a value or the stored MAC couldn't be decrypted with the data key
+	ErrDecrypt = errors.New("decryption failed")
+	// ErrMACMismatch means the decrypted content failed the sops integrity check
+	ErrMACMismatch = errors.New("MAC mismatch")
+)
+
+// DecryptError describes why an environment's kubeconfig couldn't be decrypted
+type DecryptError struct {
+	Env  string
+	Path string
+	// Kind is one of ErrNotFound, ErrRead, ErrNotEncrypted, ErrNoMatchingKey,
+	// ErrDecrypt or ErrMACMismatch
+	Kind error
+	// Cause is the underlying error, if any
+	Cause error
+}
+
+func (e *DecryptError) Error() string {
+	msg := fmt.Sprintf("decrypt kubeconfig for environment %q: %v", e.Env, e.Kind)
+	if e.Path != "" {
+		msg += " (" + e.Path + ")"
+	}
+	if e.Cause != nil {
+		msg += ": " + causeMessage(e.Cause)
+	}
+	return msg
+}
+
+// Unwrap exposes both Kind and Cause to errors.Is/errors.As
+func (e *DecryptError) Unwrap() []error {
+	if e.Cause == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Cause}
+}
+
+// causeMessage prefers sops' user-facing message, which lists the keys it tried
+func causeMessage(err error) string {
+	var userErr interface{ UserError() string }
+	if errors.As(err, &userErr) {
+		return userErr.UserError()
+	}
+	return err.Error()
+}
+
+// decryptSops decrypts a sops document in the given format, mirroring
+// `sops decrypt` but classifying each failure. ctx is checked before the data
+// key lookup, which may talk to gpg-agent or a key service.
+func decryptSops(ctx context.Context, data []byte, format formats.Format) ([]byte, error) {
+	store := common.StoreForFormat(format, config.NewStoresConfig())
+
+	tree, err := store.LoadEncryptedFile(data)
+	if err != nil {
+		return nil, &DecryptError{Kind: ErrNotEncrypted, Cause: err}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	key, err := tree.Metadata.GetDataKey()
+	if err != nil {
+		return nil, &DecryptError{Kind: ErrNoMatchingKey, Cause: err}
+	}
+
+	cipher := aes.NewCipher()
+	mac, err := tree.Decrypt(key, cipher)
+	if err != nil {
+		return nil, &DecryptError{Kind: ErrDecrypt, Cause: err}
+	}
+
+	originalMac, err := cipher.Decrypt(
+		tree.Metadata.MessageAuthenticationCode,
+		key,
+		tree.Metadata.LastModified.Format(time.RFC3339),
+	)
+	if err != nil {
+		return nil, &DecryptError{Kind: ErrDecrypt, Cause: err}
+	}
+	if originalMac != mac {
+		return nil, &DecryptError{Kind: ErrMACMismatch}
+	}
+
+	out, err := store.EmitPlainFile(tree.Branches)
+	if err != nil {
+		return nil, fmt.Errorf("emit decrypted kubeconfig: %w", err)
+	}
+	return out, nil
+}
+
+// encryptSops encrypts a plaintext document in the given format for the key
+// groups and selectors of a sops creation rule, mirroring `sops encrypt`
+func encryptSops(plaintext []byte, format formats.Format, rule *config.Config) ([]byte, error) {
+	store := common.StoreForFormat(format, config.NewStoresConfig())
+
+	branches, err := store.LoadPlainFile(plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("parse kubeconfig: %w", err)
+	}
+
+	tree := sops.Tree{
+		Branches: branches,
+		Metadata: sops.Metadata{
+			KeyGroups:               rule.KeyGroups,
+			ShamirThreshold:         rule.ShamirThreshold,
+			UnencryptedSuffix:       rule.UnencryptedSuffix,
+			EncryptedSuffix:         rule.EncryptedSuffix,
+			UnencryptedRegex:        rule.UnencryptedRegex,
+			EncryptedRegex:          rule.EncryptedRegex,
+			UnencryptedCommentRegex: rule.UnencryptedCommentRegex,
+			EncryptedCommentRegex:   rule.EncryptedCommentRegex,
+			MACOnlyEncrypted:        rule.MACOnlyEncrypted,
+			Version:                 version.Version,
+		},
+	}
+
+	// Like the sops CLI, leave *_unencrypted keys in plaintext unless the rule picks a selector
+	if rule.UnencryptedSuffix == "" && rule.EncryptedSuffix == "" && rule.UnencryptedRegex == "" &&
+		rule.EncryptedRegex == "" && rule.UnencryptedCommentRegex == "" && rule.EncryptedCommentRegex == "" {
+		tree.Metadata.UnencryptedSuffix = sops.DefaultUnencryptedSuffix
+	}
+
+	dataKey, errs := tree.GenerateDataKey()
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("generate data key: %w", errors.Join(errs...))
+	}
+
+	if err := common.EncryptTree(common.EncryptTreeOpts{Tree: &tree, Cipher: aes.NewCipher(), DataKey: dataKey}); err != nil {
+		return nil, fmt.Errorf("encrypt kubeconfig: %w", err)
+	}
+
+	out, err := store.EmitEncryptedFile(tree)
+	if err != nil {
+		return nil, fmt.Errorf("emit encrypted kubeconfig: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,270 @@
+package kubeconfig
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/getsops/sops/v3"
+	"github.com/getsops/sops/v3/aes"
+	sopsage "github.com/getsops/sops/v3/age"
+	"github.com/getsops/sops/v3/cmd/sops/common"
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+	"github.com/getsops/sops/v3/config"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: https://127.0.0.1:6443
+comment_unencrypted: original
+`
+
+// encryptForTest sops-encrypts plaintext YAML for the given age recipient
+func encryptForTest(t *testing.T, plaintext, recipient string) []byte {
+	t.Helper()
+
+	store := common.StoreForFormat(formats.Yaml, config.NewStoresConfig())
+	branches, err := store.LoadPlainFile([]byte(plaintext))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := sopsage.MasterKeysFromRecipients(recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var group sops.KeyGroup
+	for _, k := range keys {
+		group = append(group, k)
+	}
+
+	tree := sops.Tree{
+		Branches: branches,
+		Metadata: sops.Metadata{
+			KeyGroups:         []sops.KeyGroup{group},
+			UnencryptedSuffix: "_unencrypted",
+			Version:           "3.13.3",
+		},
+	}
+	dataKey, errs := tree.GenerateDataKey()
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if err := common.EncryptTree(common.EncryptTreeOpts{Tree: &tree, Cipher: aes.NewCipher(), DataKey: dataKey}); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := store.EmitEncryptedFile(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// setupSopsTest writes an encrypted "test" kubeconfig and returns a manager for it.
+// The environment is isolated so only the age identity passed via SOPS_AGE_KEY is used.
+func setupSopsTest(t *testing.T, encrypted []byte, identity *age.X25519Identity) *Manager {
+	t.Helper()
+
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(tmpDir, ".config"))
+	t.Setenv("SOPS_AGE_KEY_FILE", "")
+	t.Setenv("SOPS_AGE_KEY", identity.String())
+
+	kubeconfigDir := filepath.Join(tmpDir, "config", "kubeconfig")
+	if err := os.MkdirAll(kubeconfigDir, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(kubeconfigDir, "test.enc.yaml"), encrypted, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewManager(WithConfigDir(filepath.Join(tmpDir, "config")), WithCacheDir(filepath.Join(tmpDir, "cache")))
+}
+
+func TestDecryptWithAgeKey(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr := setupSopsTest(t, encryptForTest(t, testKubeconfig, identity.Recipient().String()), identity)
+
+	content, err := mgr.Decrypt(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("decrypt failed: %v", err)
+	}
+	if !bytes.Contains(content, []byte("server: https://127.0.0.1:6443")) {
+		t.Errorf("unexpected decrypted content:\n%s", content)
+	}
+}
+
+func TestDecryptNoMatchingKey(t *testing.T) {
+	recipient, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr := setupSopsTest(t, encryptForTest(t, testKubeconfig, recipient.Recipient().String()), other)
+
+	_, err = mgr.Decrypt(context.Background(), "test")
+	if !errors.Is(err, ErrNoMatchingKey) {
+		t.Errorf("expected ErrNoMatchingKey, got %v", err)
+	}
+}
+
+func TestDecryptMACMismatch(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := encryptForTest(t, testKubeconfig, identity.Recipient().String())
+	tampered := bytes.Replace(encrypted, []byte("comment_unencrypted: original"), []byte("comment_unencrypted: tampered"), 1)
+	mgr := setupSopsTest(t, tampered, identity)
+
+	_, err = mgr.Decrypt(context.Background(), "test")
+	if !errors.Is(err, ErrMACMismatch) {
+		t.Errorf("expected ErrMACMismatch, got %v", err)
+	}
+}
+
+func TestDecryptValueFailure(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := encryptForTest(t, testKubeconfig, identity.Recipient().String())
+	// Swap the GCM tag of the first encrypted value for an all-zero one
+	tag := regexp.MustCompile(`tag:[A-Za-z0-9+/=]+`)
+	loc := tag.FindIndex(encrypted)
+	if loc == nil {
+		t.Fatalf("no encrypted value in:\n%s", encrypted)
+	}
+	tampered := slices.Concat(encrypted[:loc[0]], []byte("tag:AAAAAAAAAAAAAAAAAAAAAA=="), encrypted[loc[1]:])
+	mgr := setupSopsTest(t, tampered, identity)
+
+	_, err = mgr.Decrypt(context.Background(), "test")
+	if !errors.Is(err, ErrDecrypt) {
+		t.Errorf("expected ErrDecrypt, got %v", err)
+	}
+	if errors.Is(err, ErrMACMismatch) {
+		t.Errorf("expected a value decryption failure not to be reported as a MAC mismatch, got %v", err)
+	}
+}
+
+func TestDecryptNotEncrypted(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr := setupSopsTest(t, []byte(testKubeconfig), identity)
+
+	_, err = mgr.Decrypt(context.Background(), "test")
+	if !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("expected ErrNotEncrypted, got %v", err)
+	}
+}
+
+func TestDecryptNotFound(t *testing.T) {
+	mgr := NewManager(WithConfigDir(t.TempDir()), WithCacheDir(t.TempDir()))
+
+	_, err := mgr.Decrypt(context.Background(), "nonexistent")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	var decErr *DecryptError
+	if !errors.As(err, &decErr) || decErr.Env != "nonexistent" {
+		t.Errorf("expected DecryptError for nonexistent, got %v", err)
+	}
+}
+
+func TestDecryptReadError(t *testing.T) {
+	configDir := t.TempDir()
+	mgr := NewManager(WithConfigDir(configDir), WithCacheDir(t.TempDir()))
+	// A directory in place of the file fails with EISDIR rather than ENOENT
+	if err := os.MkdirAll(mgr.GetEncryptedPath("test"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := mgr.Decrypt(context.Background(), "test")
+	if !errors.Is(err, ErrRead) {
+		t.Errorf("expected ErrRead, got %v", err)
+	}
+	if errors.Is(err, ErrNotFound) {
+		t.Errorf("expected an unreadable file not to be reported as missing, got %v", err)
+	}
+}
+
+func TestDecryptCanceled(t *testing.T) {
+	mgr := NewManager(WithConfigDir(t.TempDir()), WithCacheDir(t.TempDir()))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := mgr.Decrypt(ctx, "test"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr := setupSopsTest(t, []byte(testKubeconfig), identity)
+
+	// Encrypt looks up the creation rule from the nearest .sops.yaml
+	sopsConfig := "creation_rules:\n  - path_regex: config/kubeconfig/.*\\.enc\\.yaml\n    age: " + identity.Recipient().String() + "\n"
+	if err := os.WriteFile(filepath.Join(filepath.Dir(mgr.configDir), ".sops.yaml"), []byte(sopsConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mgr.Encrypt("test", []byte(testKubeconfig)); err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+
+	encrypted, err := os.ReadFile(mgr.GetEncryptedPath("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(encrypted, []byte("https://127.0.0.1:6443")) {
+		t.Error("server address was not encrypted")
+	}
+
+	content, err := mgr.Decrypt(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("decrypt failed: %v", err)
+	}
+	if !bytes.Contains(content, []byte("server: https://127.0.0.1:6443")) {
+		t.Errorf("unexpected decrypted content:\n%s", content)
+	}
+}
+
+func TestEncryptNoMatchingRule(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr := setupSopsTest(t, []byte(testKubeconfig), identity)
+
+	sopsConfig := "creation_rules:\n  - path_regex: terraform/.*\\.sops\\.yaml\n    age: " + identity.Recipient().String() + "\n"
+	if err := os.WriteFile(filepath.Join(filepath.Dir(mgr.configDir), ".sops.yaml"), []byte(sopsConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mgr.Encrypt("test", []byte(testKubeconfig)); err == nil {
+		t.Error("expected error when no creation rule matches")
+	}
+}
@@ -9,6 +9,21 @@ _clusterDefaults: {
 			service_cidr: "10.43.0.0/16"
 		}
 	}
+
+	// Objects k3s and controllers create without owner references that lab
+	// can't recognise itself. Objects k3s applies from its server manifests
+	// carry objectset labels and are skipped without an entry here.
+	drift: ignore: [
+		{kind: "*.k3s.cattle.io"},
+		{kind: "*.helm.cattle.io"},
+		{kind: "*.longhorn.io", namespace: "longhorn-system"},
+		// k3s node passwords, serving certificate and etcd snapshot records
+		{kind: "Secret", namespace: "kube-system", name: "*.node-password.k3s"},
+		{kind: "Secret", namespace: "kube-system", name: "k3s-serving"},
+		{kind: "ConfigMap", namespace: "kube-system", name: "k3s-etcd-snapshot*"},
+		// k3s ServiceLB pods for LoadBalancer Services
+		{kind: "DaemonSet", namespace: "kube-system", name: "svclb-*"},
+	]
 }
 
 // _productionApps is the full application stack for production
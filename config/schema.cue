@@ -47,13 +47,28 @@ package homelab
 	apps: {[string]: bool}
 }
 
+// DriftIgnore matches live objects `lab k8s drift` should not report.
+// Each field is a glob; omitted fields match anything. kind matches either
+// the bare kind or kind.group, e.g. "Secret" or "*.longhorn.io".
+#DriftIgnore: {
+	kind?:      string
+	namespace?: string
+	name?:      string
+}
+
+// Drift configures drift detection between git and the cluster
+#Drift: {
+	ignore: [...#DriftIgnore]
+}
+
 // Environment represents a complete environment configuration
 #Environment: {
 	name:      string
 	inherits?: string
 	cluster:   #Cluster
 	hosts: [...#Host]
-	apps: #Apps
+	apps:   #Apps
+	drift?: #Drift
 
 	// Validation: at least one host must have clusterInit if any hosts exist
 	_hasClusterInit: or([for h in hosts if h.k3s.clusterInit == true {true}]) | len(hosts) == 0